@@ -0,0 +1,156 @@
+// Package alertmanager receives Prometheus Alertmanager webhook notifications
+// and decides which of them should become Flares.
+package alertmanager
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBodyBytes bounds the notifications accepted.
+const maxBodyBytes = 1 << 20
+
+// Notification statuses.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Notification is the body of an Alertmanager webhook, version 4.
+type Notification struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []*Alert          `json:"alerts"`
+}
+
+// Alert is one alert in a notification.
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// GroupID is a short, stable ID for the notification's alert group, fit for
+// storing as an appProperty.
+func (n *Notification) GroupID() string {
+	sum := sha256.Sum256([]byte(n.Receiver + "/" + n.GroupKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Firing are the notification's alerts that are firing.
+func (n *Notification) Firing() []*Alert {
+	firing := []*Alert{}
+	for _, alert := range n.Alerts {
+		if alert.Status == StatusFiring {
+			firing = append(firing, alert)
+		}
+	}
+	return firing
+}
+
+// Summary describes the alert group in a line: the summary annotation if
+// the alerts share one, or the alert name and group labels.
+func (n *Notification) Summary() string {
+	for _, key := range []string{"summary", "title", "description"} {
+		if text := n.CommonAnnotations[key]; text != "" {
+			return text
+		}
+	}
+
+	name := n.CommonLabels["alertname"]
+	if name == "" {
+		name = "Alert"
+	}
+	labels := []string{}
+	for key, value := range n.GroupLabels {
+		if key != "alertname" {
+			labels = append(labels, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	sort.Strings(labels)
+	if len(labels) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(labels, ", "))
+}
+
+// Describe lists the notification's alerts for Slack, one per line.
+func (n *Notification) Describe() string {
+	lines := []string{fmt.Sprintf("*%s* (%d %s): %s", strings.ToUpper(n.Status), len(n.Alerts), plural(len(n.Alerts), "alert"), n.Summary())}
+	for _, alert := range n.Alerts {
+		text := alert.Annotations["summary"]
+		if text == "" {
+			text = alert.Labels["alertname"]
+		}
+		line := fmt.Sprintf("• [%s] %s", alert.Status, text)
+		if alert.GeneratorURL != "" {
+			line = fmt.Sprintf("• [%s] <%s|%s>", alert.Status, alert.GeneratorURL, text)
+		}
+		lines = append(lines, line)
+	}
+	if n.TruncatedAlerts > 0 {
+		lines = append(lines, fmt.Sprintf("• and %d more", n.TruncatedAlerts))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+// Handler receives Alertmanager webhooks and passes them to receive. If token
+// isn't "", requests must carry it as a bearer token, which Alertmanager sends
+// with http_config.authorization.credentials.
+func Handler(token string, receive func(*Notification)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		notification := &Notification{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(notification); err != nil {
+			http.Error(w, fmt.Sprintf("not an Alertmanager notification: %s", err), http.StatusBadRequest)
+			return
+		}
+		if notification.GroupKey == "" {
+			http.Error(w, "not an Alertmanager notification: no groupKey", http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Alertmanager notification for %s: %s, %d alerts", notification.GroupKey, notification.Status, len(notification.Alerts))
+		// firing a Flare takes longer than Alertmanager waits, so answer first
+		go receive(notification)
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
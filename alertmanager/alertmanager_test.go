@@ -0,0 +1,66 @@
+package alertmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const notificationJSON = `{"version": "4", "groupKey": "{}:{alertname=\"HighErrorRate\"}", "status": "firing", "receiver": "flarebot", "alerts": [{"status": "firing", "labels": {"alertname": "HighErrorRate"}}]}`
+
+func TestHandlerToken(t *testing.T) {
+	received := make(chan *Notification, 1)
+	handler := Handler("secret", func(n *Notification) { received <- n })
+
+	tests := []struct {
+		authorization string
+		status        int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusAccepted},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/alertmanager", strings.NewReader(notificationJSON))
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("Authorization %q: status %d, want %d", test.authorization, w.Code, test.status)
+		}
+	}
+
+	if n := <-received; n.GroupKey != `{}:{alertname="HighErrorRate"}` {
+		t.Errorf("received group %q", n.GroupKey)
+	}
+	select {
+	case n := <-received:
+		t.Errorf("an unauthorized notification was received: %+v", n)
+	default:
+	}
+}
+
+func TestRulesAct(t *testing.T) {
+	tests := []struct {
+		config string
+		act    bool
+	}{
+		{``, false},
+		{`[{"match": {"team": "data"}, "action": "ignore"}]`, false},
+		{`[{"match": {"team": "data"}, "action": "ignore"}, {"match": {"severity": "warning"}, "action": "prompt"}]`, true},
+		{`[{"match": {"severity": "critical"}, "action": "fire"}]`, true},
+	}
+	for _, test := range tests {
+		rules, err := NewRulesFromConfig(test.config)
+		if err != nil {
+			t.Fatalf("%s: %s", test.config, err)
+		}
+		if rules.Act() != test.act {
+			t.Errorf("%s: Act() = %t, want %t", test.config, rules.Act(), test.act)
+		}
+	}
+}
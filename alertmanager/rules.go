@@ -0,0 +1,139 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Actions a rule can take.
+const (
+	// ActionFire fires a Flare right away.
+	ActionFire = "fire"
+	// ActionPrompt asks the Flares channel whether to fire one.
+	ActionPrompt = "prompt"
+	// ActionIgnore does nothing.
+	ActionIgnore = "ignore"
+)
+
+// Rule decides what to do about alert groups whose common labels match.
+type Rule struct {
+	// Match are labels that must have exactly these values.
+	Match map[string]string `json:"match,omitempty"`
+	// MatchRE are labels whose whole value must match these regexps.
+	MatchRE map[string]string `json:"match_re,omitempty"`
+	Action  string            `json:"action"`
+	// Priority is the Flare priority, e.g. "P1", unless PriorityLabel says
+	// otherwise.
+	Priority string `json:"priority,omitempty"`
+	// PriorityLabel is a label holding the priority, as "P1", "p1" or "1".
+	PriorityLabel string `json:"priority_label,omitempty"`
+
+	matchRE map[string]*regexp.Regexp
+}
+
+func (r *Rule) compile() error {
+	switch r.Action {
+	case ActionFire, ActionPrompt, ActionIgnore:
+	default:
+		return fmt.Errorf("unknown action %q, expected %s, %s or %s", r.Action, ActionFire, ActionPrompt, ActionIgnore)
+	}
+	if r.Priority == "" {
+		r.Priority = "P2"
+	}
+	if normalizePriority(r.Priority) == "" {
+		return fmt.Errorf("unknown priority %q, expected P0, P1 or P2", r.Priority)
+	}
+
+	r.matchRE = map[string]*regexp.Regexp{}
+	for label, pattern := range r.MatchRE {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("bad match_re for %s: %s", label, err)
+		}
+		r.matchRE[label] = re
+	}
+	return nil
+}
+
+func (r *Rule) matches(labels map[string]string) bool {
+	for label, value := range r.Match {
+		if labels[label] != value {
+			return false
+		}
+	}
+	for label, re := range r.matchRE {
+		if !re.MatchString(labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// PriorityFor is the Flare priority for a notification matching the rule.
+func (r *Rule) PriorityFor(n *Notification) string {
+	if r.PriorityLabel != "" {
+		if priority := normalizePriority(n.CommonLabels[r.PriorityLabel]); priority != "" {
+			return priority
+		}
+	}
+	return normalizePriority(r.Priority)
+}
+
+// normalizePriority turns "P1", "p1" or "1" into "P1", and anything else into
+// "".
+func normalizePriority(value string) string {
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "P")
+	switch value {
+	case "0", "1", "2":
+		return "P" + value
+	}
+	return ""
+}
+
+// Rules are checked in order; the first that matches a notification decides.
+type Rules []*Rule
+
+// NewRulesFromConfig reads the ALERT_RULES configuration value, a JSON array
+// of rules.
+func NewRulesFromConfig(configJSON string) (Rules, error) {
+	rules := Rules{}
+	if configJSON == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(configJSON), &rules); err != nil {
+		return nil, fmt.Errorf("ALERT_RULES is not a JSON array of rules: %s", err)
+	}
+	for i, rule := range rules {
+		if rule == nil {
+			return nil, fmt.Errorf("alert rule %d is empty", i)
+		}
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid alert rule %d: %s", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// Act reports whether any rule fires Flares or asks about them, rather than
+// only ignoring alerts.
+func (rules Rules) Act() bool {
+	for _, rule := range rules {
+		if rule.Action == ActionFire || rule.Action == ActionPrompt {
+			return true
+		}
+	}
+	return false
+}
+
+// For returns the first rule matching the notification's common labels, or
+// nil if none does.
+func (rules Rules) For(n *Notification) *Rule {
+	for _, rule := range rules {
+		if rule.matches(n.CommonLabels) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package api is an HTTP API for firing and querying Flares, for tools that
+// aren't in Slack.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxBodyBytes bounds the requests accepted.
+const maxBodyBytes = 1 << 16
+
+var (
+	// ErrNotFound is returned by a Service when there's no such Flare.
+	ErrNotFound = errors.New("no such Flare")
+	// ErrInvalid is returned by a Service when a request doesn't make sense,
+	// wrapped with why.
+	ErrInvalid = errors.New("invalid request")
+)
+
+// Flare is a Flare as the API shows it.
+type Flare struct {
+	Number    string `json:"number"`
+	ChannelID string `json:"channel_id,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Priority  string `json:"priority"`
+	Summary   string `json:"summary"`
+	State     string `json:"state"`
+	Type      string `json:"type,omitempty"`
+	Lead      string `json:"lead,omitempty"`
+	Reporter  string `json:"reporter,omitempty"`
+	// FiredAt, MitigatedAt and ResolvedAt are RFC 3339 times, or "" if the
+	// Flare hasn't got there.
+	FiredAt     string `json:"fired_at,omitempty"`
+	MitigatedAt string `json:"mitigated_at,omitempty"`
+	ResolvedAt  string `json:"resolved_at,omitempty"`
+	// Links are URLs by what they are, e.g. "channel", "flare_doc".
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// FireRequest is the body of POST /flares.
+type FireRequest struct {
+	// Priority is "P0", "P1" or "P2".
+	Priority    string `json:"priority"`
+	Topic       string `json:"topic"`
+	Retroactive bool   `json:"retroactive,omitempty"`
+	Preemptive  bool   `json:"preemptive,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+	// Reporter is who's firing the Flare, by Slack name. It defaults to the
+	// API client's name.
+	Reporter string `json:"reporter,omitempty"`
+}
+
+// TransitionRequest is the body of POST /flares/{n}/transitions.
+type TransitionRequest struct {
+	// State is "mitigated", "resolved" or "not_a_flare".
+	State string `json:"state"`
+	// Actor is who moved the Flare along, by Slack name. It defaults to the
+	// API client's name.
+	Actor string `json:"actor,omitempty"`
+}
+
+// Service does what the API is asked to.
+type Service interface {
+	FireFlare(req *FireRequest) (*Flare, error)
+	// ListFlares returns the Flares in any of states, newest first.
+	ListFlares(states []string) ([]*Flare, error)
+	GetFlare(number string) (*Flare, error)
+	TransitionFlare(number string, state string, actor string) (*Flare, error)
+}
+
+// States that GET /flares lists by default.
+var defaultListStates = []string{"fired", "mitigated"}
+
+// Server serves the API to clients holding a token.
+type Server struct {
+	Service Service
+	// Tokens are the API clients' bearer tokens, by client name.
+	Tokens map[string]string
+}
+
+// New returns a Server for service.
+func New(service Service, tokens map[string]string) *Server {
+	return &Server{Service: service, Tokens: tokens}
+}
+
+// NewFromConfig returns a Server with the API_TOKENS configuration value, a
+// JSON object of client name to token. It returns nil if there are none, since
+// the API is optional.
+func NewFromConfig(service Service, tokensJSON string) (*Server, error) {
+	if tokensJSON == "" {
+		return nil, nil
+	}
+
+	tokens := map[string]string{}
+	if err := json.Unmarshal([]byte(tokensJSON), &tokens); err != nil {
+		return nil, fmt.Errorf("API_TOKENS is not a JSON object of client names to tokens: %s", err)
+	}
+	for name, token := range tokens {
+		if len(token) < 16 {
+			return nil, fmt.Errorf("the API token of %s is too short, it needs at least 16 characters", name)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	return New(service, tokens), nil
+}
+
+// Register adds the API's routes to mux.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.Handle("/flares", s.Authenticate(http.HandlerFunc(s.flares)))
+	mux.Handle("/flares/", s.Authenticate(http.HandlerFunc(s.flare)))
+}
+
+// clientKey is the request context key of the API client's name.
+type clientKey struct{}
+
+// clientName is the name of the API client that made an authenticated
+// request.
+func clientName(r *http.Request) string {
+	name, _ := r.Context().Value(clientKey{}).(string)
+	return name
+}
+
+// Authenticate lets through requests carrying one of the tokens as a bearer
+// token.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := s.client(r)
+		if client == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="flarebot"`)
+			writeError(w, http.StatusUnauthorized, "a valid API token is needed")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, client)))
+	})
+}
+
+// client returns the name of the client whose token the request carries, or
+// "".
+func (s *Server) client(r *http.Request) string {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || given == "" {
+		return ""
+	}
+	found := ""
+	for name, token := range s.Tokens {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			found = name
+		}
+	}
+	return found
+}
+
+// flares serves /flares.
+func (s *Server) flares(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		states := defaultListStates
+		if query := r.URL.Query()["state"]; len(query) > 0 {
+			states = []string{}
+			for _, value := range query {
+				states = append(states, strings.Split(value, ",")...)
+			}
+		}
+		flares, err := s.Service.ListFlares(states)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"flares": flares})
+
+	case http.MethodPost:
+		req := &FireRequest{}
+		if !readJSON(w, r, req) {
+			return
+		}
+		if req.Reporter == "" {
+			req.Reporter = clientName(r)
+		}
+		log.Printf("API client %s is firing a %s Flare", clientName(r), req.Priority)
+		flare, err := s.Service.FireFlare(req)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, flare)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or POST")
+	}
+}
+
+// flare serves /flares/{n} and /flares/{n}/transitions.
+func (s *Server) flare(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/flares/"), "/"), "/")
+	number := parts[0]
+
+	switch {
+	case len(parts) == 1 && number != "":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		flare, err := s.Service.GetFlare(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, flare)
+
+	case len(parts) == 2 && parts[1] == "transitions":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		req := &TransitionRequest{}
+		if !readJSON(w, r, req) {
+			return
+		}
+		if req.Actor == "" {
+			req.Actor = clientName(r)
+		}
+		log.Printf("API client %s is marking Flare %s %s", clientName(r), number, req.State)
+		flare, err := s.Service.TransitionFlare(number, req.State, req.Actor)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, flare)
+
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// readJSON decodes the request body into v, answering the request if it
+// can't.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("the body isn't valid: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Couldn't write API response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeServiceError answers with the status matching a Service error.
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalid):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		log.Printf("API request failed: %s", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
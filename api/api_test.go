@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeService answers for Flare 7 only, and records transitions.
+type fakeService struct {
+	transitions []string
+	err         error
+}
+
+func (s *fakeService) FireFlare(req *FireRequest) (*Flare, error) {
+	return &Flare{Number: "7", Priority: req.Priority, Summary: req.Topic, Reporter: req.Reporter, State: "fired"}, nil
+}
+
+func (s *fakeService) ListFlares(states []string) ([]*Flare, error) {
+	return []*Flare{{Number: "7", State: strings.Join(states, ",")}}, nil
+}
+
+func (s *fakeService) GetFlare(number string) (*Flare, error) {
+	if number != "7" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, number)
+	}
+	return &Flare{Number: "7", State: "fired"}, nil
+}
+
+func (s *fakeService) TransitionFlare(number string, state string, actor string) (*Flare, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if number != "7" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, number)
+	}
+	if state != "mitigated" {
+		return nil, fmt.Errorf("%w: state must be mitigated", ErrInvalid)
+	}
+	s.transitions = append(s.transitions, fmt.Sprintf("%s %s by %s", number, state, actor))
+	return &Flare{Number: number, State: state}, nil
+}
+
+const testToken = "0123456789abcdef"
+
+func newTestServer(t *testing.T, service Service) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	New(service, map[string]string{"deploy-pipeline": testToken}).Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAPI(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		// response is a part of the response body.
+		response string
+	}{
+		{"no token", http.MethodGet, "/flares", "", "", http.StatusUnauthorized, `"a valid API token is needed"`},
+		{"wrong token", http.MethodGet, "/flares/7", "fedcba9876543210", "", http.StatusUnauthorized, `"a valid API token is needed"`},
+		{"list", http.MethodGet, "/flares", testToken, "", http.StatusOK, `"state":"fired,mitigated"`},
+		{"list by state", http.MethodGet, "/flares?state=resolved,not_a_flare&state=fired", testToken, "", http.StatusOK, `"state":"resolved,not_a_flare,fired"`},
+		{"fire", http.MethodPost, "/flares", testToken, `{"priority": "P1", "topic": "checkout is down"}`, http.StatusCreated, `"reporter":"deploy-pipeline"`},
+		{"unknown field", http.MethodPost, "/flares", testToken, `{"priority": "P1", "topic": "checkout is down", "severity": "high"}`, http.StatusBadRequest, `unknown field \"severity\"`},
+		{"not JSON", http.MethodPost, "/flares", testToken, `priority=P1`, http.StatusBadRequest, `the body isn't valid`},
+		{"get", http.MethodGet, "/flares/7", testToken, "", http.StatusOK, `"number":"7"`},
+		{"not found", http.MethodGet, "/flares/8", testToken, "", http.StatusNotFound, `"no such Flare: 8"`},
+		{"transition", http.MethodPost, "/flares/7/transitions", testToken, `{"state": "mitigated"}`, http.StatusOK, `"state":"mitigated"`},
+		{"transition unknown Flare", http.MethodPost, "/flares/8/transitions", testToken, `{"state": "mitigated"}`, http.StatusNotFound, `"no such Flare: 8"`},
+		{"invalid transition", http.MethodPost, "/flares/7/transitions", testToken, `{"state": "fired"}`, http.StatusUnprocessableEntity, `"invalid request: state must be mitigated"`},
+		{"transition unknown field", http.MethodPost, "/flares/7/transitions", testToken, `{"state": "mitigated", "who": "ada"}`, http.StatusBadRequest, `unknown field \"who\"`},
+		{"get transitions", http.MethodGet, "/flares/7/transitions", testToken, "", http.StatusMethodNotAllowed, `"use POST"`},
+		{"post a Flare", http.MethodPost, "/flares/7", testToken, `{}`, http.StatusMethodNotAllowed, `"use GET"`},
+		{"unknown endpoint", http.MethodGet, "/flares/7/timeline", testToken, "", http.StatusNotFound, `"no such endpoint"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &fakeService{}
+			server := newTestServer(t, service)
+
+			req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body := json.RawMessage{}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("answered with something other than JSON: %s", err)
+			}
+			if resp.StatusCode != test.status || !strings.Contains(string(body), test.response) {
+				t.Errorf("got %d %s, want %d with %s", resp.StatusCode, body, test.status, test.response)
+			}
+			if test.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("didn't say how to authenticate")
+			}
+		})
+	}
+}
+
+func TestTransitionActor(t *testing.T) {
+	service := &fakeService{}
+	server := newTestServer(t, service)
+
+	for _, body := range []string{`{"state": "mitigated"}`, `{"state": "mitigated", "actor": "ada"}`} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/flares/7/transitions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	want := []string{"7 mitigated by deploy-pipeline", "7 mitigated by ada"}
+	if fmt.Sprint(service.transitions) != fmt.Sprint(want) {
+		t.Errorf("transitioned %v, want %v", service.transitions, want)
+	}
+}
+
+func TestServiceFailure(t *testing.T) {
+	server := newTestServer(t, &fakeService{err: errors.New("drive: service unavailable")})
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/flares/7/transitions", strings.NewReader(`{"state": "mitigated"}`))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("got %d, want 502", resp.StatusCode)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		server bool
+		fails  bool
+	}{
+		{"", false, false},
+		{"{}", false, false},
+		{`{"deploy-pipeline": "0123456789abcdef"}`, true, false},
+		{`{"deploy-pipeline": "short"}`, false, true},
+		{`["0123456789abcdef"]`, false, true},
+	}
+	for _, test := range tests {
+		server, err := NewFromConfig(&fakeService{}, test.config)
+		if (err != nil) != test.fails || (server != nil) != test.server {
+			t.Errorf("%q: got %v, %v", test.config, server, err)
+		}
+	}
+}
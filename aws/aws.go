@@ -34,6 +34,18 @@ func InitializeAWSClient() error {
 	return nil
 }
 
+// S3Counter numbers Flares with the counter file in S3. The client must have
+// been initialized with InitializeAWSClient.
+type S3Counter struct{}
+
+func (S3Counter) Next() (string, error) {
+	return GetChannelIDFromS3()
+}
+
+func (S3Counter) Increment() error {
+	return IncrementChannelIDInS3()
+}
+
 func GetChannelIDFromS3() (string, error) {
 	bucket := os.Getenv("S3_BUCKET_NAME")
 	file := os.Getenv("S3_FILE_NAME")
@@ -0,0 +1,157 @@
+// jira-cli exercises flarebot's JIRA integration without firing a Flare. It
+// reads the same JIRA_* configuration as flarebot.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/modern-pet/flarebot/jira"
+)
+
+const usage = `Usage: jira-cli <command> [arguments]
+
+Commands:
+  create -priority P1 -summary "..." [-description "..."] [-assignee email]
+      file a Flare ticket in JIRA_PROJECT_ID
+  get <key>
+      show a ticket's summary, status, priority and assignee
+  transitions <key>
+      list the workflow transitions a ticket can take
+  transition <key> <name or id>
+      move a ticket along a transition
+  comment <key> <text>
+      comment on a ticket
+
+Configuration is read from the environment (and .env): JIRA_ORIGIN,
+JIRA_USERNAME, JIRA_PASSWORD, JIRA_PRIORITIES, JIRA_PROJECT_ID and
+JIRA_ISSUETYPE_ID.
+`
+
+func main() {
+	godotenv.Load()
+
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Print(usage)
+		return
+	}
+
+	client, err := jira.NewFromEnv()
+	if err != nil {
+		fail(err)
+	}
+	if client == nil {
+		fail(fmt.Errorf("JIRA_ORIGIN must be set"))
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "create":
+		err = create(client, args)
+	case "get":
+		err = get(client, args)
+	case "transitions":
+		err = transitions(client, args)
+	case "transition":
+		if len(args) != 2 {
+			err = fmt.Errorf("usage: jira-cli transition <key> <name or id>")
+			break
+		}
+		if err = client.Transition(args[0], args[1]); err == nil {
+			fmt.Printf("%s moved along %s\n", args[0], args[1])
+		}
+	case "comment":
+		if len(args) < 2 {
+			err = fmt.Errorf("usage: jira-cli comment <key> <text>")
+			break
+		}
+		if err = client.Comment(args[0], strings.Join(args[1:], " ")); err == nil {
+			fmt.Printf("Commented on %s\n", args[0])
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "jira-cli: %s\n", err)
+	os.Exit(1)
+}
+
+func create(client *jira.Client, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	priority := flags.String("priority", "P2", "Flare priority, P0, P1 or P2")
+	summary := flags.String("summary", "", "ticket summary")
+	description := flags.String("description", "", "ticket description")
+	assignee := flags.String("assignee", "", "email of the JIRA user to assign the ticket to")
+	flags.Parse(args)
+
+	if *summary == "" {
+		return fmt.Errorf("-summary is required")
+	}
+
+	issue, err := client.CreateFlareIssue(&jira.NewFlare{
+		Summary:       *summary,
+		Description:   *description,
+		Priority:      *priority,
+		AssigneeEmail: *assignee,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s: %s\n", issue.Key, client.BrowseURL(issue.Key))
+	return nil
+}
+
+func get(client *jira.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: jira-cli get <key>")
+	}
+
+	issue, err := client.GetIssue(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %s\n", issue.Key, issue.Fields.Summary)
+	fmt.Printf("  URL:      %s\n", client.BrowseURL(issue.Key))
+	if issue.Fields.Status != nil {
+		fmt.Printf("  Status:   %s\n", issue.Fields.Status.Name)
+	}
+	if issue.Fields.Priority != nil {
+		fmt.Printf("  Priority: %s (%s)\n", issue.Fields.Priority.Name, issue.Fields.Priority.ID)
+	}
+	if issue.Fields.Assignee != nil {
+		fmt.Printf("  Assignee: %s\n", issue.Fields.Assignee.DisplayName)
+	}
+	return nil
+}
+
+func transitions(client *jira.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: jira-cli transitions <key>")
+	}
+
+	all, err := client.Transitions(args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, t := range all {
+		to := ""
+		if t.To != nil {
+			to = fmt.Sprintf(" -> %s", t.To.Name)
+		}
+		fmt.Printf("%s\t%s%s\n", t.ID, t.Name, to)
+	}
+	return nil
+}
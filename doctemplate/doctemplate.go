@@ -0,0 +1,236 @@
+// Package doctemplate fills the [PLACEHOLDERS] in flare document templates and
+// derives Drive file properties from the same flare data.
+package doctemplate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Variable is a placeholder that templates may use, written as [NAME].
+type Variable struct {
+	Name        string
+	Description string
+}
+
+// Variables is the documented set of placeholders.
+var Variables = []Variable{
+	{"FLARE-NUMBER", "the Flare number, e.g. 179"},
+	{"FLARE-CHANNEL", "the Flare channel name, e.g. flare-179"},
+	{"PRIORITY", "the Flare priority, e.g. P1"},
+	{"SUMMARY", "the description given when the Flare was fired"},
+	{"CHANNEL-LINK", "a link to the Flare channel"},
+	{"LEAD", "the incident lead"},
+	{"ROLES", "everyone who has a role in the Flare"},
+	{"REPORTER", "who fired the Flare"},
+	{"START-DATE", "when the Flare was fired (Jakarta time)"},
+	{"STATUS-PAGE", "a link to the status page"},
+	{"TICKET", "a link to the Flare ticket"},
+	{"HISTORY-DOC", "a link to the Slack history sheet"},
+	{"FLARE-DOC", "a link to the Flare doc"},
+	{"TIME-TO-LEAD", "how long after firing someone became incident lead"},
+	{"TIME-TO-MITIGATE", "how long after firing the Flare was mitigated"},
+	{"TIMELINE", "the Flare's timeline, one event per line"},
+	{"STATUS", "the Flare's state, priority, lead and last update"},
+}
+
+// placeholderRegexp matches [NAME] placeholders. Names are upper case so
+// ordinary bracketed text in a doc is left alone.
+var placeholderRegexp = regexp.MustCompile(`\[([A-Z][A-Z0-9]*(?:-[A-Z0-9]+)*)\]`)
+
+// Unset is written for documented variables that have no value yet, like the
+// lead of a Flare that was just fired.
+const Unset = "TBD"
+
+// Value is what a placeholder is replaced with. If Link is set the value is
+// rendered as a link labelled with Text.
+type Value struct {
+	Text string
+	Link string
+}
+
+// Values maps variable names to their values.
+type Values map[string]Value
+
+// Flare is the data a flare document is filled from.
+type Flare struct {
+	Number          string
+	ChannelName     string
+	ChannelLink     string
+	Priority        string
+	Topic           string
+	Lead            string
+	Roles           map[string]string
+	Reporter        string
+	StartTime       time.Time
+	StatusPageURL   string
+	TicketKey       string
+	TicketURL       string
+	HistoryDocTitle string
+	HistoryDocURL   string
+	FlareDocTitle   string
+	FlareDocURL     string
+	LeadTime        time.Time
+	MitigatedTime   time.Time
+	Timeline        []TimelineEntry
+	Status          string
+}
+
+// TimelineEntry is something that happened during a Flare.
+type TimelineEntry struct {
+	Time time.Time
+	Text string
+}
+
+// Values returns the template variables for the Flare.
+func (f *Flare) Values() Values {
+	values := Values{
+		"FLARE-NUMBER":  {Text: f.Number},
+		"FLARE-CHANNEL": {Text: f.ChannelName, Link: f.ChannelLink},
+		"PRIORITY":      {Text: f.Priority},
+		"SUMMARY":       {Text: f.Topic},
+		"CHANNEL-LINK":  {Text: f.ChannelLink, Link: f.ChannelLink},
+		"LEAD":          {Text: f.Lead},
+		"ROLES":         {Text: formatRoles(f.Roles)},
+		"REPORTER":      {Text: f.Reporter},
+		"STATUS-PAGE":   {Text: f.StatusPageURL, Link: f.StatusPageURL},
+		"TICKET":        {Text: f.TicketKey, Link: f.TicketURL},
+		"HISTORY-DOC":   {Text: f.HistoryDocTitle, Link: f.HistoryDocURL},
+		"FLARE-DOC":     {Text: f.FlareDocTitle, Link: f.FlareDocURL},
+		"TIMELINE":      {Text: formatTimeline(f.Timeline)},
+		"STATUS":        {Text: f.Status},
+	}
+	if !f.StartTime.IsZero() {
+		values["START-DATE"] = Value{Text: f.StartTime.Format("Monday, 2 January 2006 15:04 MST")}
+		if !f.LeadTime.IsZero() {
+			values["TIME-TO-LEAD"] = Value{Text: FormatDuration(f.LeadTime.Sub(f.StartTime))}
+		}
+		if !f.MitigatedTime.IsZero() {
+			values["TIME-TO-MITIGATE"] = Value{Text: FormatDuration(f.MitigatedTime.Sub(f.StartTime))}
+		}
+	}
+	if values["TICKET"].Text == "" {
+		values["TICKET"] = Value{Text: f.TicketURL, Link: f.TicketURL}
+	}
+
+	return values
+}
+
+func formatRoles(roles map[string]string) string {
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, role := range names {
+		parts = append(parts, fmt.Sprintf("%s: %s", role, roles[role]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// FormatDuration writes a duration in hours and minutes, e.g. "1h 5m".
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+// timelineTimeFormat is how timeline entries are stamped.
+const timelineTimeFormat = "2 Jan 15:04 MST"
+
+func formatTimeline(timeline []TimelineEntry) string {
+	entries := append([]TimelineEntry{}, timeline...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf("%s – %s", entry.Time.Format(timelineTimeFormat), entry.Text))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// maxPropertyBytes is Drive's limit on the combined size of a property's key
+// and value.
+const maxPropertyBytes = 124
+
+// Properties returns the values as Drive file properties, keyed by the
+// lower-cased variable name with underscores, e.g. flare_number. Empty values
+// and link-only or multi-line variables are left out, and long values are
+// truncated to fit.
+func (v Values) Properties() map[string]string {
+	properties := map[string]string{}
+	for name, value := range v {
+		if value.Text == "" || name == "HISTORY-DOC" || name == "FLARE-DOC" || name == "CHANNEL-LINK" || name == "TIMELINE" || name == "STATUS" {
+			continue
+		}
+		key := strings.ToLower(strings.Replace(name, "-", "_", -1))
+		text := value.Text
+		for len(key)+len(text) > maxPropertyBytes {
+			runes := []rune(text)
+			text = string(runes[:len(runes)-1])
+		}
+		properties[key] = text
+	}
+
+	return properties
+}
+
+// Placeholders returns the distinct placeholder names used in text, in order of
+// first appearance.
+func Placeholders(text string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+
+	return names
+}
+
+func isVariable(name string) bool {
+	for _, v := range Variables {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve works out what each placeholder in text is replaced with, keyed by
+// placeholder name. It also returns the placeholders that couldn't be filled:
+// unknown names are left out of the result so they stay in the doc, and
+// documented variables without a value resolve to Unset.
+func Resolve(text string, values Values) (Values, []string) {
+	resolved := Values{}
+	missing := []string{}
+	for _, name := range Placeholders(text) {
+		value, ok := values[name]
+		if !ok && !isVariable(name) {
+			missing = append(missing, name)
+			continue
+		}
+		if value.Text == "" {
+			missing = append(missing, name)
+			value = Value{Text: Unset}
+		}
+		resolved[name] = value
+	}
+
+	return resolved, missing
+}
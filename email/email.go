@@ -0,0 +1,228 @@
+// Package email tells stakeholders who don't live in Slack about big Flares,
+// by emailing distribution lists through SMTP.
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of notification.
+const (
+	KindFired           = "fired"
+	KindPriorityChanged = "priority_changed"
+	KindResolved        = "resolved"
+)
+
+// Config is how flarebot sends email, and who to.
+type Config struct {
+	// Addr is the SMTP server's host:port.
+	Addr string
+	// Username and Password log in to the SMTP server. Without a username
+	// flarebot doesn't log in.
+	Username string
+	Password string
+	From     string
+	// Lists are the addresses emailed about Flares of a priority, e.g.
+	// {"P0": ["leadership@example.com"]}.
+	Lists map[string][]string
+}
+
+// ConfigFromEnv reads the SMTP_* and EMAIL_* configuration. It returns nil if
+// SMTP_ADDR isn't set, meaning no email is sent.
+func ConfigFromEnv() (*Config, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	config := &Config{
+		Addr:     addr,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("EMAIL_FROM"),
+		Lists:    map[string][]string{},
+	}
+	if config.From == "" {
+		return nil, errors.New("EMAIL_FROM must be set when SMTP_ADDR is")
+	}
+	if lists := os.Getenv("EMAIL_LISTS"); lists != "" {
+		if err := json.Unmarshal([]byte(lists), &config.Lists); err != nil {
+			return nil, fmt.Errorf("EMAIL_LISTS is not a JSON object of priority => addresses: %s", err)
+		}
+	}
+
+	return config, nil
+}
+
+// Flare is a Flare as described in an email.
+type Flare struct {
+	Number   string
+	Channel  string
+	Priority string
+	Summary  string
+	State    string
+	Lead     string
+	Reporter string
+	// ChannelURL, FlareDocURL and TicketURL are links to include, if set.
+	ChannelURL  string
+	FlareDocURL string
+	TicketURL   string
+}
+
+// Notification is something that happened to a Flare.
+type Notification struct {
+	Kind  string
+	Flare *Flare
+	// Actor is who made it happen, by Slack name.
+	Actor string
+	// PreviousPriority is the Flare's priority before a priority change.
+	PreviousPriority string
+	Time             time.Time
+}
+
+// Notifier emails notifications about Flares.
+type Notifier struct {
+	Config *Config
+	// SendMail sends a message, smtp.SendMail by default.
+	SendMail func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// New returns a Notifier sending through the configured SMTP server.
+func New(config *Config) *Notifier {
+	return &Notifier{Config: config, SendMail: smtp.SendMail}
+}
+
+// NewFromEnv returns a Notifier configured by the SMTP_* and EMAIL_*
+// variables, or nil if email isn't configured.
+func NewFromEnv() (*Notifier, error) {
+	config, err := ConfigFromEnv()
+	if err != nil || config == nil {
+		return nil, err
+	}
+	return New(config), nil
+}
+
+// Recipients are the distinct addresses on the lists for any of the
+// priorities.
+func (n *Notifier) Recipients(priorities ...string) []string {
+	seen := map[string]bool{}
+	recipients := []string{}
+	for _, priority := range priorities {
+		for _, address := range n.Config.Lists[strings.ToUpper(priority)] {
+			if !seen[strings.ToLower(address)] {
+				seen[strings.ToLower(address)] = true
+				recipients = append(recipients, address)
+			}
+		}
+	}
+	sort.Strings(recipients)
+	return recipients
+}
+
+// Notify emails the lists for the Flare's priority. For a priority change,
+// the lists for the previous priority hear about it too. Nothing is sent if
+// no list is configured for the priorities.
+func (n *Notifier) Notify(notification *Notification) error {
+	if n == nil {
+		return nil
+	}
+
+	recipients := n.Recipients(notification.Flare.Priority, notification.PreviousPriority)
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	message, err := n.message(notification, recipients)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.Config.Username != "" {
+		host := n.Config.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", n.Config.Username, n.Config.Password, host)
+	}
+
+	return n.SendMail(n.Config.Addr, auth, n.Config.From, recipients, message)
+}
+
+// message builds a multipart/alternative email with plain text and HTML
+// bodies.
+func (n *Notifier) message(notification *Notification, recipients []string) ([]byte, error) {
+	subject, text, html, err := render(notification)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	when := notification.Time
+	if when.IsZero() {
+		when = time.Now()
+	}
+	domain := "flarebot"
+	if i := strings.LastIndex(n.Config.From, "@"); i >= 0 {
+		domain = strings.Trim(n.Config.From[i+1:], ">")
+	}
+
+	var message bytes.Buffer
+	headers := [][2]string{
+		{"From", n.Config.From},
+		{"To", strings.Join(recipients, ", ")},
+		{"Subject", mime.QEncoding.Encode("UTF-8", subject)},
+		{"Date", when.Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", uuid.New().String(), domain)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%s", parts.Boundary())},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,176 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sent is a message handed to SendMail.
+type sent struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	msg  []byte
+}
+
+func newTestNotifier(config *Config) (*Notifier, *[]sent) {
+	messages := []sent{}
+	notifier := New(config)
+	notifier.SendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		messages = append(messages, sent{addr, auth, from, to, msg})
+		return nil
+	}
+	return notifier, &messages
+}
+
+// parts returns the decoded bodies of a multipart message by content type.
+func parts(t *testing.T, message *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", message.Header.Get("Content-Type"), err)
+	}
+
+	bodies := map[string]string{}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return bodies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// quoted-printable parts are decoded by the reader
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[part.Header.Get("Content-Type")] = string(data)
+	}
+}
+
+func TestNotifyPriorityChange(t *testing.T) {
+	notifier, messages := newTestNotifier(&Config{
+		Addr:     "smtp.example.com:587",
+		Username: "flarebot",
+		Password: "secret",
+		From:     "Flarebot <flarebot@example.com>",
+		Lists: map[string][]string{
+			"P0": {"leadership@example.com", "support@example.com"},
+			"P2": {"Support@example.com", "engineering@example.com"},
+		},
+	})
+
+	err := notifier.Notify(&Notification{
+		Kind: KindPriorityChanged,
+		Flare: &Flare{
+			Number:      "7",
+			Channel:     "flare-7",
+			Priority:    "P0",
+			Summary:     "checkout is down for everyone",
+			State:       "fired",
+			Reporter:    "ada",
+			ChannelURL:  "https://modernpet.slack.com/archives/C7",
+			FlareDocURL: "https://docs.google.com/document/d/1/edit",
+			TicketURL:   "https://example.atlassian.net/browse/FLARE-7",
+		},
+		Actor:            "grace",
+		PreviousPriority: "p2",
+		Time:             time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(*messages))
+	}
+	sent := (*messages)[0]
+
+	recipients := []string{"engineering@example.com", "leadership@example.com", "support@example.com"}
+	if !reflect.DeepEqual(sent.to, recipients) {
+		t.Errorf("sent to %v, want %v", sent.to, recipients)
+	}
+	if sent.addr != "smtp.example.com:587" || sent.from != "Flarebot <flarebot@example.com>" || sent.auth == nil {
+		t.Errorf("sent through %s from %s with auth %v", sent.addr, sent.from, sent.auth)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(string(sent.msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := message.Header.Get("To"); to != strings.Join(recipients, ", ") {
+		t.Errorf("To: %s", to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != "[P0] Flare flare-7 changed from p2 to P0: checkout is down for everyone" {
+		t.Errorf("Subject: %q, %v", subject, err)
+	}
+	if date, err := message.Header.Date(); err != nil || !date.Equal(time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Date: %v, %v", date, err)
+	}
+	if id := message.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID: %s", id)
+	}
+
+	bodies := parts(t, message)
+	text := bodies["text/plain; charset=UTF-8"]
+	html := bodies["text/html; charset=UTF-8"]
+	for _, want := range []string{
+		"The priority of flare-7 changed from p2 to P0, by grace.",
+		"Incident lead: not yet",
+		"Slack channel: https://modernpet.slack.com/archives/C7",
+		"Flare doc:     https://docs.google.com/document/d/1/edit",
+		"Ticket:        https://example.atlassian.net/browse/FLARE-7",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("the text body doesn't have %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{
+		"<strong>The priority of flare-7 changed from p2 to P0, by grace.</strong>",
+		`<a href="https://modernpet.slack.com/archives/C7">Slack channel</a>`,
+		`<a href="https://docs.google.com/document/d/1/edit">Flare doc</a>`,
+		`<a href="https://example.atlassian.net/browse/FLARE-7">Ticket</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("the HTML body doesn't have %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestNotifyWithoutLists(t *testing.T) {
+	notifier, messages := newTestNotifier(&Config{
+		Addr:  "localhost:25",
+		From:  "flarebot@example.com",
+		Lists: map[string][]string{"P0": {"leadership@example.com"}},
+	})
+
+	for _, notification := range []*Notification{
+		{Kind: KindFired, Flare: &Flare{Priority: "P2", Summary: "checkout is slow"}},
+		{Kind: KindPriorityChanged, Flare: &Flare{Priority: "P1", Summary: "checkout is slow"}, PreviousPriority: "P2"},
+	} {
+		if err := notifier.Notify(notification); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*messages) != 0 {
+		t.Errorf("sent %d messages without a list for the priority", len(*messages))
+	}
+
+	if err := notifier.Notify(&Notification{Kind: KindResolved, Flare: &Flare{Priority: "P0", Summary: "checkout is down"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*messages) != 1 || (*messages)[0].auth != nil {
+		t.Errorf("sent %+v, want one message without logging in", *messages)
+	}
+}
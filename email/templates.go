@@ -0,0 +1,88 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+)
+
+// subjects are the subject line templates, by kind.
+var subjects = map[string]*template.Template{
+	KindFired:           template.Must(template.New("fired").Parse("[{{.Flare.Priority}}] Flare fired: {{.Flare.Summary}}")),
+	KindPriorityChanged: template.Must(template.New("priority_changed").Parse("[{{.Flare.Priority}}] Flare {{.Flare.Channel}} changed from {{.PreviousPriority}} to {{.Flare.Priority}}: {{.Flare.Summary}}")),
+	KindResolved:        template.Must(template.New("resolved").Parse("[{{.Flare.Priority}}] Flare resolved: {{.Flare.Summary}}")),
+}
+
+// headlines are the first line of the body, by kind.
+var headlines = map[string]*template.Template{
+	KindFired:           template.Must(template.New("fired").Parse("A {{.Flare.Priority}} Flare was fired{{with .Actor}} by {{.}}{{end}}.")),
+	KindPriorityChanged: template.Must(template.New("priority_changed").Parse("The priority of {{.Flare.Channel}} changed from {{.PreviousPriority}} to {{.Flare.Priority}}{{with .Actor}}, by {{.}}{{end}}.")),
+	KindResolved:        template.Must(template.New("resolved").Parse("{{.Flare.Channel}} was resolved{{with .Actor}} by {{.}}{{end}}.")),
+}
+
+var textBody = template.Must(template.New("text").Parse(`{{.Headline}}
+
+Summary:       {{.Flare.Summary}}
+Priority:      {{.Flare.Priority}}
+State:         {{.Flare.State}}
+Incident lead: {{or .Flare.Lead "not yet"}}
+Reported by:   {{.Flare.Reporter}}
+{{with .Flare.ChannelURL}}
+Slack channel: {{.}}{{end}}{{with .Flare.FlareDocURL}}
+Flare doc:     {{.}}{{end}}{{with .Flare.TicketURL}}
+Ticket:        {{.}}{{end}}
+
+Sent by Flarebot. Follow the Flare channel for the latest.
+`))
+
+var htmlBody = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<p><strong>{{.Headline}}</strong></p>
+<table>
+<tr><td>Summary</td><td>{{.Flare.Summary}}</td></tr>
+<tr><td>Priority</td><td>{{.Flare.Priority}}</td></tr>
+<tr><td>State</td><td>{{.Flare.State}}</td></tr>
+<tr><td>Incident lead</td><td>{{or .Flare.Lead "not yet"}}</td></tr>
+<tr><td>Reported by</td><td>{{.Flare.Reporter}}</td></tr>
+</table>
+<p>
+{{with .Flare.ChannelURL}}<a href="{{.}}">Slack channel</a><br>{{end}}
+{{with .Flare.FlareDocURL}}<a href="{{.}}">Flare doc</a><br>{{end}}
+{{with .Flare.TicketURL}}<a href="{{.}}">Ticket</a><br>{{end}}
+</p>
+<p style="color: #888">Sent by Flarebot. Follow the Flare channel for the latest.</p>
+</body>
+</html>
+`))
+
+// render returns the subject and plain text and HTML bodies of a notification.
+func render(notification *Notification) (string, string, string, error) {
+	subject, ok := subjects[notification.Kind]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown kind of notification %s", notification.Kind)
+	}
+
+	var buf bytes.Buffer
+	if err := headlines[notification.Kind].Execute(&buf, notification); err != nil {
+		return "", "", "", err
+	}
+	data := struct {
+		*Notification
+		Headline string
+	}{notification, buf.String()}
+
+	var subjectBuf, textBuf, htmlBuf bytes.Buffer
+	if err := subject.Execute(&subjectBuf, data); err != nil {
+		return "", "", "", err
+	}
+	if err := textBody.Execute(&textBuf, data); err != nil {
+		return "", "", "", err
+	}
+	if err := htmlBody.Execute(&htmlBuf, data); err != nil {
+		return "", "", "", err
+	}
+
+	return subjectBuf.String(), textBuf.String(), htmlBuf.String(), nil
+}
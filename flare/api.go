@@ -0,0 +1,158 @@
+package flare
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/modern-pet/flarebot/api"
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// apiTransitionStates are the states the API can move a Flare to.
+var apiTransitionStates = map[string]bool{
+	StateMitigated: true,
+	StateNotAFlare: true,
+	StateResolved:  true,
+}
+
+// apiFlare describes a Flare for the API, from the appProperties of its files.
+func (s *Service) apiFlare(properties map[string]string, flareDoc *googledocs.Doc) *api.Flare {
+	described := s.webhookFlare(properties[googledocs.PropertyChannelID], properties, flareDoc)
+	return &api.Flare{
+		Number:      described.Number,
+		ChannelID:   described.ChannelID,
+		Channel:     described.Channel,
+		Priority:    described.Priority,
+		Summary:     described.Summary,
+		State:       described.State,
+		Type:        described.Type,
+		Lead:        described.Lead,
+		Reporter:    described.Reporter,
+		FiredAt:     properties[googledocs.PropertyFiredAt],
+		MitigatedAt: properties[googledocs.PropertyMitigatedAt],
+		ResolvedAt:  properties[googledocs.PropertyResolvedAt],
+		Links:       described.Links,
+	}
+}
+
+// FireFlare fires a Flare for the API, announced in the Flares channel like
+// one fired there.
+func (s *Service) FireFlare(req *api.FireRequest) (*api.Flare, error) {
+	priority := strings.ToUpper(req.Priority)
+	switch priority {
+	case "P0", "P1", "P2":
+	default:
+		return nil, fmt.Errorf("%w: priority must be P0, P1 or P2", api.ErrInvalid)
+	}
+	topic := strings.TrimSpace(req.Topic)
+	if topic == "" {
+		return nil, fmt.Errorf("%w: a Flare needs a topic", api.ErrInvalid)
+	}
+
+	// a reporter with a chat account gets the ticket and the credit
+	reporterID := ""
+	if user, err := s.Chat.UserByName(req.Reporter); err == nil {
+		reporterID = user.ID
+	}
+
+	channelID := s.Fire(&Request{
+		ChannelID:   s.FlaresChannel,
+		Priority:    priority,
+		Topic:       topic,
+		Retroactive: req.Retroactive,
+		Preemptive:  req.Preemptive,
+		Sensitive:   req.Sensitive,
+		ReporterID:  reporterID,
+		Reporter:    req.Reporter,
+	})
+	if channelID == "" {
+		return nil, fmt.Errorf("%s couldn't create the Flare channel", s.Chat.Name())
+	}
+
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		// the Flare was fired, Google just didn't keep up
+		return &api.Flare{
+			ChannelID: channelID,
+			Priority:  priority,
+			Summary:   topic,
+			State:     StateFired,
+			Links:     map[string]string{"channel": s.Chat.ChannelLink(channelID)},
+		}, nil
+	}
+	return s.apiFlare(record.Properties, record.FlareDoc), nil
+}
+
+// ListFlares lists the Flares in any of states for the API, newest first.
+func (s *Service) ListFlares(states []string) ([]*api.Flare, error) {
+	flares := []*api.Flare{}
+	for _, state := range states {
+		if _, ok := stateNames[state]; !ok {
+			return nil, fmt.Errorf("%w: unknown state %s", api.ErrInvalid, state)
+		}
+		docs, err := googledocs.ListFlaresByState(s.GoogleDocsServer, state)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			flares = append(flares, s.apiFlare(doc.File.AppProperties, doc))
+		}
+	}
+
+	sort.SliceStable(flares, func(i, j int) bool {
+		a, _ := strconv.Atoi(flares[i].Number)
+		b, _ := strconv.Atoi(flares[j].Number)
+		return a > b
+	})
+	return flares, nil
+}
+
+// GetFlare describes a Flare for the API.
+func (s *Service) GetFlare(number string) (*api.Flare, error) {
+	record, err := s.findFlareByNumber(number)
+	if errors.Is(err, ErrNoFlareDocs) {
+		return nil, fmt.Errorf("%w: %s", api.ErrNotFound, number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.apiFlare(record.Properties, record.FlareDoc), nil
+}
+
+// TransitionFlare moves a Flare to a state for the API, just like the
+// commands in its channel do.
+func (s *Service) TransitionFlare(number string, state string, actor string) (*api.Flare, error) {
+	if !apiTransitionStates[state] {
+		return nil, fmt.Errorf("%w: state must be %s, %s or %s", api.ErrInvalid, StateMitigated, StateResolved, StateNotAFlare)
+	}
+
+	record, err := s.findFlareByNumber(number)
+	if errors.Is(err, ErrNoFlareDocs) {
+		return nil, fmt.Errorf("%w: %s", api.ErrNotFound, number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	channelID := record.Properties[googledocs.PropertyChannelID]
+	if channelID == "" {
+		return nil, fmt.Errorf("%w: Flare %s has no channel", api.ErrInvalid, number)
+	}
+	if record.Properties[googledocs.PropertyState] == state {
+		return nil, fmt.Errorf("%w: Flare %s is already %s", api.ErrInvalid, number, state)
+	}
+
+	err = s.Transition(channelID, actor, state)
+	switch {
+	case errors.Is(err, ErrNoFlareDocs):
+		return nil, fmt.Errorf("%w: %s", api.ErrNotFound, number)
+	case errors.Is(err, ErrSameState):
+		return nil, fmt.Errorf("%w: Flare %s is already %s", api.ErrInvalid, number, state)
+	case err != nil:
+		return nil, err
+	}
+
+	return s.GetFlare(number)
+}
@@ -0,0 +1,84 @@
+package flare
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modern-pet/flarebot/api"
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// readOnlyDocs can't set appProperties, like Drive when it's down.
+type readOnlyDocs struct {
+	*googledocs.FakeGoogleDocsServer
+}
+
+func (d *readOnlyDocs) UpdateAppProperties(doc *googledocs.Doc, properties map[string]string) error {
+	return &googledocs.Error{Op: "drive.files.update", Kind: googledocs.ErrUnavailable, Err: errors.New("backend error")}
+}
+
+func TestTransitionFlare(t *testing.T) {
+	service, chat, _ := newTestService(t)
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"})
+
+	tests := []struct {
+		name   string
+		number string
+		state  string
+		err    error
+	}{
+		{"unknown state", "7", StateFired, api.ErrInvalid},
+		{"unknown Flare", "8", StateMitigated, api.ErrNotFound},
+		{"mitigated", "7", StateMitigated, nil},
+		{"again", "7", StateMitigated, api.ErrInvalid},
+		{"resolved", "7", StateResolved, nil},
+	}
+	for _, test := range tests {
+		flare, err := service.TransitionFlare(test.number, test.state, "deploy-pipeline")
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if flare.Number != "7" || flare.State != test.state {
+			t.Errorf("%s: got %+v", test.name, flare)
+		}
+	}
+
+	if !contains(chat.posted(channelID), "The Flare is resolved") {
+		t.Errorf("the channel wasn't told: %v", chat.posted(channelID))
+	}
+}
+
+func TestTransitionFlareFailure(t *testing.T) {
+	service, chat, docs := newTestService(t)
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"})
+	service.GoogleDocsServer = &readOnlyDocs{docs}
+
+	mux := http.NewServeMux()
+	api.New(service, map[string]string{"deploy-pipeline": "0123456789abcdef"}).Register(mux)
+	req := httptest.NewRequest(http.MethodPost, "/flares/7/transitions", strings.NewReader(`{"state": "mitigated"}`))
+	req.Header.Set("Authorization", "Bearer 0123456789abcdef")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadGateway || !strings.Contains(recorder.Body.String(), "backend error") {
+		t.Errorf("got %d %s, want a 502", recorder.Code, recorder.Body)
+	}
+	if contains(chat.posted(channelID), "much rejoicing") || contains(chat.posted(flaresChannel), "Flare has been mitigated") {
+		t.Error("the Flare was announced as mitigated")
+	}
+	if !contains(chat.posted(channelID), "mark the Flare Mitigated") {
+		t.Errorf("the failure wasn't explained: %v", chat.posted(channelID))
+	}
+	if state := docs.Docs()[1].Properties[googledocs.PropertyState]; state != StateFired {
+		t.Errorf("the Flare is %s, want fired", state)
+	}
+}
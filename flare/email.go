@@ -0,0 +1,43 @@
+package flare
+
+import (
+	"log"
+	"time"
+
+	"github.com/modern-pet/flarebot/email"
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// emailFlare emails the distribution lists about the Flare in a channel. It's
+// sent in the background, since SMTP can be slow.
+func (s *Service) emailFlare(kind string, who string, channelID string, properties map[string]string, flareDoc *googledocs.Doc, previousPriority string) {
+	if s.Email == nil {
+		return
+	}
+
+	described := s.webhookFlare(channelID, properties, flareDoc)
+	notification := &email.Notification{
+		Kind: kind,
+		Flare: &email.Flare{
+			Number:      described.Number,
+			Channel:     described.Channel,
+			Priority:    described.Priority,
+			Summary:     described.Summary,
+			State:       stateNames[described.State],
+			Lead:        described.Lead,
+			Reporter:    described.Reporter,
+			ChannelURL:  described.Links["channel"],
+			FlareDocURL: described.Links["flare_doc"],
+			TicketURL:   described.Links["ticket"],
+		},
+		Actor:            who,
+		PreviousPriority: previousPriority,
+		Time:             time.Now(),
+	}
+
+	go func() {
+		if err := s.Email.Notify(notification); err != nil {
+			log.Printf("Couldn't email about %s: %s", described.Channel, err)
+		}
+	}()
+}
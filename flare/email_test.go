@@ -0,0 +1,46 @@
+package flare
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modern-pet/flarebot/email"
+)
+
+func TestResolvedEmail(t *testing.T) {
+	sent := make(chan string, 10)
+	notifier := email.New(&email.Config{
+		Addr:  "localhost:25",
+		From:  "flarebot@example.com",
+		Lists: map[string][]string{"P1": {"leadership@example.com"}},
+	})
+	notifier.SendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent <- string(msg)
+		return nil
+	}
+
+	service, _, _ := newTestService(t)
+	service.Email = notifier
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P1", Topic: "checkout is down", Retroactive: true, ReporterID: "U1"})
+
+	service.Transition(channelID, "grace", StateResolved)
+	service.Transition(channelID, "grace", StateResolved)
+	service.Transition(channelID, "ada", StateMitigated)
+
+	select {
+	case msg := <-sent:
+		if !strings.Contains(msg, "Flare resolved") {
+			t.Errorf("sent %q, want the resolved email", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the resolved email wasn't sent")
+	}
+	// emails go out in the background, so give a repeat the time to show up
+	select {
+	case msg := <-sent:
+		t.Errorf("sent another email: %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,431 @@
+package flare
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/modern-pet/flarebot/doctemplate"
+	"github.com/modern-pet/flarebot/email"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/helpers"
+	"github.com/modern-pet/flarebot/webhooks"
+)
+
+// Request is a request to fire a Flare.
+type Request struct {
+	// ChannelID is where the Flare was asked for. Progress is posted there,
+	// and the Flare is announced there.
+	ChannelID   string
+	Priority    string
+	Topic       string
+	Retroactive bool
+	Preemptive  bool
+	// Sensitive Flares' documents may be shared more narrowly
+	Sensitive bool
+	// ReporterID is the chat user firing the Flare. Without one, Reporter
+	// names what fired it.
+	ReporterID string
+	Reporter   string
+}
+
+// Fired is a Flare whose channel was just set up.
+type Fired struct {
+	ChannelID string
+	Type      string
+	Priority  string
+	// Topic is the Flare's topic, with secrets redacted.
+	Topic       string
+	StartTime   time.Time
+	Retroactive bool
+	// Folder, FlareDoc and HistoryDoc are the Flare's files, or nil if they
+	// couldn't be created.
+	Folder     *googledocs.Doc
+	FlareDoc   *googledocs.Doc
+	HistoryDoc *googledocs.Doc
+}
+
+// Fire creates the documents and channel for a new Flare, and returns the
+// channel's ID, or "" if the channel couldn't be created.
+func (s *Service) Fire(req *Request) string {
+	s.fireMu.Lock()
+	defer s.fireMu.Unlock()
+
+	isRetroactive := req.Retroactive
+	isPreemptive := req.Preemptive
+	isSensitive := req.Sensitive
+
+	flareType := TypeStandard
+	switch {
+	case isSensitive:
+		flareType = TypeSensitive
+	case isRetroactive:
+		flareType = TypeRetroactive
+	case isPreemptive:
+		flareType = TypePreemptive
+	}
+
+	if isRetroactive {
+		s.Chat.PostMessage(req.ChannelID, "OK, let me quietly set up the Flare documents. Nobody freak out, this is retroactive.")
+	} else if isPreemptive {
+		s.Chat.PostMessage(req.ChannelID, "OK, let me quietly set up the Flare documents. Nobody freak out, this is preemptive.")
+	} else {
+		s.Chat.PostMessage(req.ChannelID, "OK, let me get my flaregun")
+	}
+
+	topic := req.Topic
+
+	// the topic ends up in doc titles and the doc body, so scrub it first
+	docTopic, topicRedactions := s.Redactor.Redact(topic)
+
+	log.Printf("Attempting to get the flare number")
+	channelID, err := s.Counter.Next()
+	if err != nil || channelID == "" {
+		log.Printf("Failed to get the flare number with error: %v", err)
+		s.Chat.PostMessage(req.ChannelID, "I couldn't get a number for this Flare, so I haven't fired it. Please try again in a minute.")
+		return ""
+	}
+	// the ticket, docs and page all carry the number, so it's taken before
+	// any of them exist, even if the channel can't be created later
+	if err = s.Counter.Increment(); err != nil {
+		log.Printf("Failed to increment the flare number with error: %s", err)
+		s.Chat.PostMessage(req.ChannelID, "I couldn't reserve a number for this Flare, so I haven't fired it. Please try again in a minute.")
+		return ""
+	}
+	flareID := fmt.Sprintf("flare-%s", channelID)
+
+	reporter, reporterEmail := req.Reporter, ""
+	if req.ReporterID != "" {
+		reporter = req.ReporterID
+		if author, err := s.Chat.User(req.ReporterID); err == nil {
+			reporter = author.Name
+			reporterEmail = author.Email
+		}
+	}
+	flare := &doctemplate.Flare{
+		Number:        channelID,
+		ChannelName:   flareID,
+		Priority:      req.Priority,
+		Topic:         docTopic,
+		Reporter:      reporter,
+		StartTime:     time.Now().In(helpers.JakartaLocation()),
+		StatusPageURL: s.StatusPageURL,
+	}
+
+	// the ticket key is stored with the docs, so file it first
+	s.fileFlareTicket(req.ChannelID, reporterEmail, flare)
+
+	log.Printf("Attempting to create flare folder")
+	folderID := s.GoogleParentFolderID
+	flareFolder, folderErr := s.GoogleDocsServer.CreateFolder(fmt.Sprintf("%s – %s", flareID, docTopic), s.GoogleParentFolderID)
+	if folderErr != nil {
+		log.Printf("No flare folder created, using the parent folder: %s", folderErr)
+	} else {
+		log.Printf("Flare folder created")
+		folderID = flareFolder.File.Id
+		s.tagFlareDocs([]*googledocs.Doc{flareFolder}, flareProperties(flare, flareType, googledocs.DocTypeFolder))
+	}
+
+	flareDocTitle := fmt.Sprintf("%s: %s", "Flare", docTopic)
+
+	if isRetroactive {
+		flareDocTitle = fmt.Sprintf("%s - Retroactive", flareDocTitle)
+	}
+
+	log.Printf("Attempting to create flare doc")
+	flareDoc, flareDocErr := s.GoogleDocsServer.CreateFromTemplate(flareDocTitle, s.GoogleFlareDocID, folderID, flareProperties(flare, flareType, googledocs.DocTypeFlareDoc))
+
+	if flareDocErr != nil {
+		s.Chat.PostMessage(req.ChannelID, GoogleErrorMessage(flareDocErr, "make a flare doc for tracking"))
+		log.Printf("No google flare doc created: %s", flareDocErr)
+	} else {
+		log.Printf("Flare doc created")
+		flare.FlareDocTitle = flareDocTitle
+		flare.FlareDocURL = flareDoc.File.WebViewLink
+	}
+
+	log.Printf("Attempting to create history doc")
+	historyDocTitle := fmt.Sprintf("%s: %s (%s History)", "Flare", docTopic, s.Chat.Name())
+	historyDoc, historyDocErr := s.GoogleDocsServer.CreateFromTemplate(historyDocTitle, s.GoogleHistoryDocID, folderID, flareProperties(flare, flareType, googledocs.DocTypeHistory))
+
+	if historyDocErr != nil {
+		log.Printf("No google history doc created: %s", historyDocErr)
+	} else {
+		log.Printf("Google history doc created")
+		flare.HistoryDocTitle = historyDocTitle
+		flare.HistoryDocURL = historyDoc.File.WebViewLink
+	}
+
+	log.Printf("Attempting to create flare channel")
+	// set up the Flare room
+	log.Printf("Using channel ID: %s", flareID)
+	channel, channelErr := s.Chat.CreateChannel(flareID)
+	flareDocs := []*googledocs.Doc{}
+	if folderErr == nil {
+		flareDocs = append(flareDocs, flareFolder)
+	}
+	if flareDocErr == nil {
+		flareDocs = append(flareDocs, flareDoc)
+	}
+	if historyDocErr == nil {
+		flareDocs = append(flareDocs, historyDoc)
+	}
+
+	flareChannelID := ""
+	if channelErr == nil {
+		flare.ChannelLink = s.Chat.ChannelLink(channel.ID)
+		flareChannelID = channel.ID
+
+		// the channel is how later commands find the Flare's files
+		s.tagFlareDocs(flareDocs, map[string]string{googledocs.PropertyChannelID: channel.ID})
+	}
+
+	s.shareFlareDocs(flareChannelID, flareDocs, map[string]string{
+		googledocs.PropertyFlareType: flareType,
+		googledocs.PropertyPriority:  flare.Priority,
+	})
+
+	var record *Record
+	if len(flareDocs) > 0 {
+		record = &Record{Docs: flareDocs, Folder: flareFolder, FlareDoc: flareDoc, HistoryDoc: historyDoc}
+		record.refresh()
+	}
+
+	var missingPlaceholders []string
+	if flareDocErr == nil {
+		// update the google doc with some basic information
+		text, err := s.GoogleDocsServer.GetDocText(flareDoc)
+		if err != nil {
+			log.Printf("unexpected errror getting content from the flare doc: %s", err)
+		} else {
+			var resolved doctemplate.Values
+			resolved, missingPlaceholders = doctemplate.Resolve(text, flare.Values())
+			missingPlaceholders = withoutPlaceholders(missingPlaceholders, placeholdersUnsetAtFire)
+			if len(missingPlaceholders) > 0 {
+				log.Printf("Flare doc template has placeholders without values: %s", strings.Join(missingPlaceholders, ", "))
+			}
+			// the status placeholder becomes a block flarebot keeps rewriting
+			delete(resolved, "STATUS")
+
+			if err = s.GoogleDocsServer.ReplaceAllText(flareDoc, placeholderReplacements(resolved)); err != nil {
+				log.Printf("Couldn't fill in the flare doc: %s", err)
+			}
+			if strings.Contains(text, statusPlaceholder) {
+				if err = s.GoogleDocsServer.NameText(flareDoc, statusPlaceholder, statusRangeName); err != nil {
+					log.Printf("Couldn't set up the flare doc status: %s", err)
+				}
+			}
+
+			s.recordFlareEvent(record, flare.StartTime, reporter, fmt.Sprintf("Flare fired as %s: %s", flare.Priority, docTopic), nil)
+		}
+	}
+
+	// big Flares wake people up, wherever the Flare ends up being discussed
+	if !isRetroactive && s.pages(flare.Priority) {
+		pageChannelID := req.ChannelID
+		if flareChannelID != "" {
+			pageChannelID = flareChannelID
+		}
+		s.pageFlare(pageChannelID, record, reporter, newFlarePage(flare))
+	}
+
+	// other tools react to Flares too
+	if s.Webhooks != nil {
+		s.Webhooks.Send(webhooks.EventFired, reporter, s.webhookFlare(flareChannelID, flareProperties(flare, flareType, ""), flareDoc), nil)
+	}
+	if !isRetroactive {
+		s.emailFlare(email.KindFired, reporter, flareChannelID, flareProperties(flare, flareType, ""), flareDoc, "")
+	}
+
+	if channelErr != nil {
+		s.Chat.PostMessage(req.ChannelID, s.Chat.Name()+" is giving me some trouble right now, so I couldn't create a channel for you. It could be that the channel already exists, but hopefully no one did that already. If you need to make a new channel to discuss, please don't use the next flare-number channel, that'll confuse me later on.")
+		log.Printf("Couldn't create Flare channel: %s", channelErr)
+	} else {
+		log.Printf("Flare channel created")
+
+		if isRetroactive {
+			s.Chat.PostMessage(channel.ID, "This is a RETROACTIVE Flare. All is well.")
+		}
+
+		// whoever fired the Flare is in the middle of it
+		if req.ReporterID != "" {
+			if err := s.Chat.Invite(channel.ID, req.ReporterID); err != nil {
+				log.Printf("Couldn't invite %s to the Flare channel: %s", reporter, err)
+			}
+		}
+
+		if err := s.Chat.SetTopic(channel.ID, docTopic); err != nil {
+			log.Printf("Couldn't set the Flare channel topic: %s", err)
+		}
+		s.ReportRedactions(channel.ID, "the Flare description", topicRedactions)
+
+		if flareDocErr == nil {
+			s.postAndPin(channel.ID, fmt.Sprintf("Flare doc: %s", flareDoc.File.WebViewLink))
+		}
+		if flare.TicketKey != "" {
+			s.postAndPin(channel.ID, fmt.Sprintf("JIRA ticket: %s", flare.TicketURL))
+		}
+		if len(missingPlaceholders) > 0 {
+			s.Chat.PostMessage(channel.ID, fmt.Sprintf("Heads up: I couldn't fill these placeholders in the Flare doc: [%s]", strings.Join(missingPlaceholders, "], [")))
+		}
+		if folderErr == nil {
+			s.Chat.PostMessage(channel.ID, fmt.Sprintf("Flare folder: %s", flareFolder.File.WebViewLink))
+		}
+
+		// the platform has its own touches, like help and resources
+		if s.OnChannelCreated != nil {
+			fired := &Fired{
+				ChannelID:   channel.ID,
+				Type:        flareType,
+				Priority:    flare.Priority,
+				Topic:       docTopic,
+				StartTime:   flare.StartTime,
+				Retroactive: isRetroactive,
+			}
+			if folderErr == nil {
+				fired.Folder = flareFolder
+			}
+			if flareDocErr == nil {
+				fired.FlareDoc = flareDoc
+			}
+			if historyDocErr == nil {
+				fired.HistoryDoc = historyDoc
+			}
+			s.OnChannelCreated(fired)
+		}
+
+		// let people know that they can rename this channel
+		s.Chat.PostMessage(channel.ID, fmt.Sprintf("NOTE: you can rename this channel as long as it starts with %s", channel.Name))
+
+		// announce the specific Flare room in the overall Flares room
+		target := s.Chat.MentionEveryone()
+
+		if isRetroactive || isPreemptive {
+			target = reporter
+			if req.ReporterID != "" {
+				target = s.Chat.MentionUser(req.ReporterID)
+			}
+		}
+
+		s.Chat.PostMessage(req.ChannelID, fmt.Sprintf("%s: Flare fired. Please visit %s -- %s", target, s.Chat.MentionChannel(channel.ID), topic))
+	}
+
+	return flareChannelID
+}
+
+// placeholdersUnsetAtFire are template variables that are expected to be empty
+// when a Flare is fired, so they aren't worth a warning.
+var placeholdersUnsetAtFire = []string{"TICKET", "LEAD", "ROLES", "TIME-TO-LEAD", "TIME-TO-MITIGATE", "TIMELINE", "STATUS"}
+
+func withoutPlaceholders(names []string, exclude []string) []string {
+	kept := []string{}
+	for _, name := range names {
+		excluded := false
+		for _, e := range exclude {
+			if name == e {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// placeholderReplacements turns resolved template values into doc
+// replacements keyed by the literal [PLACEHOLDER].
+func placeholderReplacements(values doctemplate.Values) map[string]googledocs.DocText {
+	replacements := map[string]googledocs.DocText{}
+	for name, value := range values {
+		replacements["["+name+"]"] = googledocs.DocText{Text: value.Text, Link: value.Link}
+	}
+	return replacements
+}
+
+// GoogleErrorMessage explains a failed Google call to the channel. what says
+// what flarebot was trying to do, e.g. "make a flare doc for tracking".
+func GoogleErrorMessage(err error, what string) string {
+	switch {
+	case errors.Is(err, googledocs.ErrNotFound):
+		return fmt.Sprintf("Google couldn't find the document I need, so I can't %s. The template or doc ID in my configuration may be wrong.", what)
+	case errors.Is(err, googledocs.ErrPermissionDenied):
+		return fmt.Sprintf("Google says I don't have permission, so I can't %s. Someone should check that my service account can access the templates.", what)
+	case errors.Is(err, googledocs.ErrQuota):
+		return fmt.Sprintf("Google is rate limiting me right now, so I can't %s. I'll try my best to recover.", what)
+	default:
+		return fmt.Sprintf("I'm having trouble connecting to google docs right now, so I can't %s. I'll try my best to recover.", what)
+	}
+}
+
+// Transition moves the Flare in a channel to a state, and tells its channel
+// and the Flares channel. A Flare already in the state is left alone, with
+// ErrSameState.
+func (s *Service) Transition(channelID string, who string, state string) error {
+	// chat and the API can move the same Flare at once
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		log.Printf("Couldn't find the docs for %s: %s", channelID, err)
+		if errors.Is(err, ErrNoFlareDocs) {
+			s.Chat.PostMessage(channelID, fmt.Sprintf("I can't find the documents of a Flare in this channel, so I can't mark it %s.", stateNames[state]))
+		} else {
+			s.Chat.PostMessage(channelID, GoogleErrorMessage(err, fmt.Sprintf("mark the Flare %s", stateNames[state])))
+		}
+		return err
+	}
+	if record.Properties[googledocs.PropertyState] == state {
+		s.Chat.PostMessage(channelID, fmt.Sprintf("This Flare is already marked %s.", stateNames[state]))
+		return ErrSameState
+	}
+
+	if err = s.setFlareState(record, channelID, who, state); err != nil {
+		s.Chat.PostMessage(channelID, GoogleErrorMessage(err, fmt.Sprintf("mark the Flare %s", stateNames[state])))
+		return err
+	}
+
+	switch state {
+	case StateMitigated:
+		s.Chat.PostMessage(channelID, "... and the Flare was mitigated, and there was much rejoicing throughout the land.")
+		s.Chat.PostMessage(s.FlaresChannel, "Flare has been mitigated")
+	case StateNotAFlare:
+		s.Chat.PostMessage(channelID, "turns out this is not a flare")
+		s.Chat.PostMessage(s.FlaresChannel, "turns out this is not a flare")
+	case StateResolved:
+		s.Chat.PostMessage(channelID, "The Flare is resolved. Time to write up what happened.")
+		s.Chat.PostMessage(s.FlaresChannel, "Flare has been resolved")
+		s.StartPostmortem(channelID)
+	}
+	return nil
+}
+
+// ReportRedactions lets a channel know that secrets were scrubbed from
+// something before flarebot saved it.
+func (s *Service) ReportRedactions(channel string, what string, count int) {
+	if count == 0 {
+		return
+	}
+
+	noun := "secret"
+	if count > 1 {
+		noun = "secrets"
+	}
+	s.Chat.PostMessage(channel, fmt.Sprintf(":lock: I redacted %d %s from %s before saving it. Anything pasted here should be rotated.", count, noun, what))
+}
+
+// postAndPin posts text in a channel and pins it.
+func (s *Service) postAndPin(channelID string, text string) {
+	messageID, err := s.Chat.PostMessage(channelID, text)
+	if err != nil {
+		log.Printf("Couldn't post %q: %s", text, err)
+		return
+	}
+	if err = s.Chat.Pin(channelID, messageID); err != nil {
+		log.Printf("Couldn't pin %q: %s", text, err)
+	}
+}
@@ -0,0 +1,129 @@
+package flare
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/sharing"
+)
+
+func TestFireCreatesTheFlareDocs(t *testing.T) {
+	service, chat, docs := newTestService(t)
+	docs.Templates["flare-template"] = "Flare [FLARE-NUMBER] ([PRIORITY]): [SUMMARY], reported by [REPORTER] in [FLARE-CHANNEL]. [OWNER]\n[STATUS]"
+
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P1", Topic: "checkout is down", ReporterID: "U1"})
+
+	created := docs.Docs()
+	if len(created) != 3 {
+		t.Fatalf("created %d docs, want a folder, a flare doc and a history doc", len(created))
+	}
+	folder, flareDoc, historyDoc := created[0], created[1], created[2]
+
+	tests := []struct {
+		doc        *googledocs.FakeDoc
+		name       string
+		templateID string
+		folderID   string
+		docType    string
+	}{
+		{folder, "flare-7 – checkout is down", "", "flares-folder", googledocs.DocTypeFolder},
+		{flareDoc, "Flare: checkout is down", "flare-template", folder.Doc.File.Id, googledocs.DocTypeFlareDoc},
+		{historyDoc, "Flare: checkout is down (Fake History)", "history-template", folder.Doc.File.Id, googledocs.DocTypeHistory},
+	}
+	for _, test := range tests {
+		if test.doc.Doc.File.Name != test.name || test.doc.TemplateID != test.templateID || test.doc.FolderID != test.folderID {
+			t.Errorf("created %q from %q in %q, want %q from %q in %q", test.doc.Doc.File.Name, test.doc.TemplateID, test.doc.FolderID, test.name, test.templateID, test.folderID)
+		}
+		properties := test.doc.Properties
+		if properties[googledocs.PropertyDocType] != test.docType || properties[googledocs.PropertyChannelID] != channelID || properties[googledocs.PropertyFlareNumber] != "7" {
+			t.Errorf("%s has properties %v", test.name, properties)
+		}
+		// webhooks, the API and postmortems read these back
+		if properties[googledocs.PropertyChannelName] != "flare-7" || properties[googledocs.PropertySummary] != "checkout is down" || properties[googledocs.PropertyReporter] != "ada" {
+			t.Errorf("%s doesn't describe the Flare: %v", test.name, properties)
+		}
+	}
+
+	// [OWNER] isn't a template variable, so it's left in and called out, and
+	// [STATUS] becomes the status block
+	want := "Flare 7 (P1): checkout is down, reported by ada in flare-7. [OWNER]\nState: Fired\nPriority: P1\nIncident lead: TBD\nLast update: "
+	if !strings.HasPrefix(flareDoc.Content, want) || !strings.HasSuffix(flareDoc.Content, "Flare fired as P1: checkout is down") {
+		t.Errorf("flare doc reads %q, want %q and the last update", flareDoc.Content, want)
+	}
+	if status, ok := flareDoc.NamedRanges[statusRangeName]; !ok || !strings.HasSuffix(flareDoc.Content, status) {
+		t.Errorf("the status block %q isn't named", status)
+	}
+	if !contains(chat.posted(channelID), "couldn't fill these placeholders in the Flare doc: [OWNER]") {
+		t.Errorf("the missing placeholder wasn't mentioned: %v", chat.posted(channelID))
+	}
+
+	timeline := flareDoc.Tables[timelineHeading]
+	if len(timeline) != 1 || timeline[0][1] != "ada" || timeline[0][2] != "Flare fired as P1: checkout is down" {
+		t.Errorf("timeline %v", timeline)
+	}
+}
+
+func TestFireSharesTheFlareDocs(t *testing.T) {
+	policies, err := sharing.New(map[string]*sharing.Policy{
+		"sensitive": {Groups: map[string]string{"Security@example.com": "writer"}, Restricted: true},
+		"P0":        {Domain: "commenter", Groups: map[string]string{"leads@example.com": "writer"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		req    *Request
+		shares []googledocs.FakeShare
+	}{
+		{
+			name:   "default",
+			req:    &Request{Priority: "P2", Topic: "checkout is slow"},
+			shares: []googledocs.FakeShare{{Type: "domain", Value: "example.com", Role: "writer"}},
+		},
+		{
+			name: "by priority",
+			req:  &Request{Priority: "P0", Topic: "everything is down"},
+			shares: []googledocs.FakeShare{
+				{Type: "domain", Value: "example.com", Role: "commenter"},
+				{Type: "group", Value: "leads@example.com", Role: "writer"},
+			},
+		},
+		{
+			name:   "sensitive",
+			req:    &Request{Priority: "P0", Topic: "leaked keys", Sensitive: true},
+			shares: []googledocs.FakeShare{{Type: "group", Value: "security@example.com", Role: "writer"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, _, docs := newTestService(t)
+			service.SharingPolicies = policies
+			test.req.ChannelID = flaresChannel
+			test.req.ReporterID = "U1"
+
+			service.Fire(test.req)
+
+			created := docs.Docs()
+			if len(created) != 3 {
+				t.Fatalf("created %d docs, want 3", len(created))
+			}
+			for _, doc := range created {
+				shares := []googledocs.FakeShare{}
+				for _, share := range doc.Shares {
+					share.ID = ""
+					shares = append(shares, share)
+				}
+				if !reflect.DeepEqual(shares, test.shares) {
+					t.Errorf("%s is shared with %+v, want %+v", doc.Doc.File.Name, shares, test.shares)
+				}
+				if doc.Properties[googledocs.PropertySharingPolicy] == "" {
+					t.Errorf("%s doesn't record its sharing policy", doc.Doc.File.Name)
+				}
+			}
+		})
+	}
+}
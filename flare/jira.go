@@ -0,0 +1,50 @@
+package flare
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/modern-pet/flarebot/doctemplate"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/jira"
+)
+
+// fileFlareTicket files the JIRA ticket for a new Flare, assigned to the
+// reporter by their email, and sets its key and link on the flare.
+func (s *Service) fileFlareTicket(channelID string, reporterEmail string, flare *doctemplate.Flare) {
+	if s.Jira == nil {
+		return
+	}
+
+	log.Printf("Attempting to create JIRA ticket")
+	issue, err := s.Jira.CreateFlareIssue(&jira.NewFlare{
+		Summary:       fmt.Sprintf("%s: %s", flare.ChannelName, flare.Topic),
+		Description:   fmt.Sprintf("%s Flare reported by %s at %s.", flare.Priority, flare.Reporter, flare.StartTime.Format("2 Jan 2006 15:04 MST")),
+		Priority:      flare.Priority,
+		AssigneeEmail: reporterEmail,
+	})
+	if err != nil {
+		log.Printf("No JIRA ticket created: %s", err)
+		s.Chat.PostMessage(channelID, "JIRA is giving me some trouble right now, so this Flare doesn't have a ticket.")
+		return
+	}
+	log.Printf("JIRA ticket %s created", issue.Key)
+
+	flare.TicketKey = issue.Key
+	flare.TicketURL = s.Jira.BrowseURL(issue.Key)
+}
+
+// syncFlareTicket comments on a Flare's ticket that it reached a state, and
+// moves the ticket along the transition configured for that state.
+func (s *Service) syncFlareTicket(channelID string, record *Record, who string, state string) {
+	key := record.Properties[googledocs.PropertyTicket]
+	if s.Jira == nil || key == "" {
+		return
+	}
+
+	comment := fmt.Sprintf("Flare marked %s by %s in %s.", stateNames[state], who, s.Chat.Name())
+	if err := s.Jira.FlareStateChanged(key, state, comment); err != nil {
+		log.Printf("Couldn't update JIRA ticket %s: %s", key, err)
+		s.Chat.PostMessage(channelID, fmt.Sprintf("I couldn't update the JIRA ticket %s, please update it by hand: %s", key, s.Jira.BrowseURL(key)))
+	}
+}
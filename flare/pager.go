@@ -0,0 +1,112 @@
+package flare
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/modern-pet/flarebot/doctemplate"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/pager"
+)
+
+// defaultPagePriorities are the priorities paged for without PAGE_PRIORITIES.
+const defaultPagePriorities = "P0"
+
+// parsePagePriorities reads a comma-separated list of priorities, e.g.
+// "P0,P1".
+func parsePagePriorities(value string) map[string]bool {
+	if value == "" {
+		value = defaultPagePriorities
+	}
+	priorities := map[string]bool{}
+	for _, priority := range strings.Split(value, ",") {
+		priorities[strings.ToUpper(strings.TrimSpace(priority))] = true
+	}
+	return priorities
+}
+
+// pagePrioritiesFromEnv is the PAGE_PRIORITIES configuration.
+func pagePrioritiesFromEnv() map[string]bool {
+	return parsePagePriorities(os.Getenv("PAGE_PRIORITIES"))
+}
+
+// pages is whether Flares of a priority page people.
+func (s *Service) pages(priority string) bool {
+	return s.Pager != nil && s.PagePriorities[priority]
+}
+
+// newFlarePage is the page for a Flare.
+func newFlarePage(flare *doctemplate.Flare) *pager.Page {
+	page := &pager.Page{
+		DedupKey: pager.DedupKey(flare.Number),
+		Summary:  fmt.Sprintf("%s %s: %s", flare.Priority, flare.ChannelName, flare.Topic),
+		Priority: flare.Priority,
+		Links:    map[string]string{},
+		Details:  map[string]string{"reporter": flare.Reporter},
+	}
+	if flare.ChannelLink != "" {
+		page.Links["Flare channel"] = flare.ChannelLink
+	}
+	if flare.FlareDocURL != "" {
+		page.Links["Flare doc"] = flare.FlareDocURL
+	}
+	if flare.TicketURL != "" {
+		page.Links["JIRA ticket"] = flare.TicketURL
+	}
+	return page
+}
+
+// pageFlare pages people about a Flare and tells channelID. The page is
+// recorded on the Flare's files, if it has any, so it can be acknowledged and
+// resolved later.
+func (s *Service) pageFlare(channelID string, record *Record, who string, page *pager.Page) {
+	// without a number the dedup key would fold the page into another Flare's
+	if page.DedupKey == pager.DedupKey("") {
+		log.Printf("Not paging for a Flare without a number")
+		s.Chat.PostMessage(channelID, fmt.Sprintf("I can't page anyone for this %s Flare because it has no number, please page on-call by hand.", page.Priority))
+		return
+	}
+
+	if err := s.Pager.Trigger(page); err != nil {
+		log.Printf("Couldn't page for %s: %s", page.DedupKey, err)
+		s.Chat.PostMessage(channelID, fmt.Sprintf("I couldn't page anyone for this %s Flare, please page on-call by hand.", page.Priority))
+		return
+	}
+
+	if record != nil {
+		s.recordFlareEvent(record, time.Now(), who, fmt.Sprintf("Paged on-call for a %s Flare", page.Priority), map[string]string{googledocs.PropertyPage: page.DedupKey})
+	}
+	s.Chat.PostMessage(channelID, fmt.Sprintf(":rotating_light: I've paged on-call for this %s Flare.", page.Priority))
+}
+
+// acknowledgePage tells the pager someone is handling the Flare.
+func (s *Service) acknowledgePage(record *Record, who string) {
+	key := record.Properties[googledocs.PropertyPage]
+	if s.Pager == nil || key == "" || record.Properties[googledocs.PropertyPageResolvedAt] != "" {
+		return
+	}
+
+	if err := s.Pager.Acknowledge(key); err != nil {
+		log.Printf("Couldn't acknowledge the page for %s: %s", key, err)
+		return
+	}
+	s.recordFlareEvent(record, time.Now(), who, "Page acknowledged", nil)
+}
+
+// resolvePage closes the Flare's page once it's mitigated or over.
+func (s *Service) resolvePage(channelID string, record *Record, who string, state string) {
+	key := record.Properties[googledocs.PropertyPage]
+	if s.Pager == nil || key == "" || record.Properties[googledocs.PropertyPageResolvedAt] != "" || state == StateFired {
+		return
+	}
+
+	if err := s.Pager.Resolve(key); err != nil {
+		log.Printf("Couldn't resolve the page for %s: %s", key, err)
+		s.Chat.PostMessage(channelID, "I couldn't resolve the page for this Flare, please resolve it by hand.")
+		return
+	}
+	s.recordFlareEvent(record, time.Now(), who, "Page resolved", map[string]string{googledocs.PropertyPageResolvedAt: time.Now().UTC().Format(time.RFC3339)})
+}
@@ -0,0 +1,50 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/modern-pet/flarebot/pager"
+)
+
+// fakePager records the pages it's sent.
+type fakePager struct {
+	triggered []*pager.Page
+}
+
+func (p *fakePager) Trigger(page *pager.Page) error {
+	p.triggered = append(p.triggered, page)
+	return nil
+}
+func (p *fakePager) Acknowledge(dedupKey string) error { return nil }
+func (p *fakePager) Resolve(dedupKey string) error     { return nil }
+
+func TestFirePages(t *testing.T) {
+	service, chat, _ := newTestService(t)
+	fake := &fakePager{}
+	service.Pager = fake
+	service.PagePriorities = map[string]bool{"P0": true}
+
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P0", Topic: "checkout is down", ReporterID: "U1"})
+
+	if len(fake.triggered) != 1 || fake.triggered[0].DedupKey != "flare-7" {
+		t.Fatalf("triggered %+v, want one page for flare-7", fake.triggered)
+	}
+	if !contains(chat.posted(channelID), "I've paged on-call") {
+		t.Errorf("the page wasn't mentioned: %v", chat.posted(channelID))
+	}
+}
+
+func TestPageWithoutANumber(t *testing.T) {
+	service, chat, _ := newTestService(t)
+	fake := &fakePager{}
+	service.Pager = fake
+
+	service.pageFlare("C1", nil, "ada", &pager.Page{DedupKey: pager.DedupKey(""), Priority: "P0"})
+
+	if len(fake.triggered) != 0 {
+		t.Errorf("triggered %+v for a Flare without a number", fake.triggered)
+	}
+	if !contains(chat.posted("C1"), "please page on-call by hand") {
+		t.Errorf("the missing page wasn't explained: %v", chat.posted("C1"))
+	}
+}
@@ -0,0 +1,48 @@
+package flare
+
+// ChatPlatform is where Flares are discussed, e.g. Slack. It's all the Flare
+// workflow needs from a chat service; anything fancier, like buttons, is up
+// to the platform's own front end.
+type ChatPlatform interface {
+	// Name is what people call the platform, e.g. "Slack".
+	Name() string
+
+	// PostMessage posts text in a channel, and returns the message's ID.
+	PostMessage(channelID string, text string) (string, error)
+	// Pin pins a message posted in a channel.
+	Pin(channelID string, messageID string) error
+
+	CreateChannel(name string) (*Channel, error)
+	SetTopic(channelID string, topic string) error
+	// Invite adds people to a channel.
+	Invite(channelID string, userIDs ...string) error
+	Channel(channelID string) (*Channel, error)
+	// ChannelMembers are the people in a channel, including bots.
+	ChannelMembers(channelID string) ([]*User, error)
+
+	User(userID string) (*User, error)
+	UserByName(name string) (*User, error)
+
+	// ChannelLink is a web link to a channel.
+	ChannelLink(channelID string) string
+	// MentionChannel, MentionUser and MentionEveryone are mentions in the
+	// platform's markup, for use in messages.
+	MentionChannel(channelID string) string
+	MentionUser(userID string) string
+	MentionEveryone() string
+}
+
+// User is a person, or bot, on a chat platform.
+type User struct {
+	ID    string
+	Name  string
+	Email string
+	IsBot bool
+}
+
+// Channel is a channel on a chat platform.
+type Channel struct {
+	ID    string
+	Name  string
+	Topic string
+}
@@ -0,0 +1,140 @@
+package flare
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/modern-pet/flarebot/doctemplate"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/helpers"
+)
+
+// postmortemFlare rebuilds the template data for a Flare from what was
+// recorded on its files.
+func (s *Service) postmortemFlare(channelID string, record *Record) *doctemplate.Flare {
+	properties := record.Properties
+	jakarta := helpers.JakartaLocation()
+
+	flare := &doctemplate.Flare{
+		Number:        properties[googledocs.PropertyFlareNumber],
+		ChannelName:   properties[googledocs.PropertyChannelName],
+		ChannelLink:   s.Chat.ChannelLink(channelID),
+		Priority:      properties[googledocs.PropertyPriority],
+		Topic:         properties[googledocs.PropertySummary],
+		Lead:          properties[googledocs.PropertyLead],
+		Reporter:      properties[googledocs.PropertyReporter],
+		StartTime:     record.propertyTime(googledocs.PropertyFiredAt).In(jakarta),
+		LeadTime:      record.propertyTime(googledocs.PropertyLeadAt).In(jakarta),
+		MitigatedTime: record.propertyTime(googledocs.PropertyMitigatedAt).In(jakarta),
+		StatusPageURL: s.StatusPageURL,
+		TicketKey:     properties[googledocs.PropertyTicket],
+	}
+	if flare.TicketKey != "" && s.Jira != nil {
+		flare.TicketURL = s.Jira.BrowseURL(flare.TicketKey)
+	}
+	// the property may have been truncated, the channel topic is the whole thing
+	if channel, err := s.Chat.Channel(channelID); err == nil && channel.Topic != "" {
+		flare.Topic = channel.Topic
+	}
+	flare.Roles = flareRoles(properties)
+	flare.Status = flareStatusText(record, "Postmortem started")
+	if record.FlareDoc != nil {
+		flare.FlareDocTitle = record.FlareDoc.File.Name
+		flare.FlareDocURL = record.FlareDoc.File.WebViewLink
+	}
+	if record.HistoryDoc != nil {
+		flare.HistoryDocTitle = record.HistoryDoc.File.Name
+		flare.HistoryDocURL = record.HistoryDoc.File.WebViewLink
+	}
+
+	timeline, err := s.readTimeline(record)
+	if err != nil {
+		log.Printf("Couldn't read the flare doc timeline: %s", err)
+	}
+	if len(timeline) > 0 {
+		flare.Timeline = timeline
+		return flare
+	}
+
+	// without a timeline table, the lifecycle is all there is to go on
+	events := []struct {
+		key  string
+		text string
+	}{
+		{googledocs.PropertyFiredAt, fmt.Sprintf("Flare fired as %s by %s", flare.Priority, flare.Reporter)},
+		{googledocs.PropertyLeadAt, fmt.Sprintf("%s became incident lead", flare.Lead)},
+		{googledocs.PropertyMitigatedAt, "Flare mitigated"},
+		{googledocs.PropertyResolvedAt, "Flare resolved"},
+	}
+	for _, event := range events {
+		if t := record.propertyTime(event.key); !t.IsZero() {
+			flare.Timeline = append(flare.Timeline, doctemplate.TimelineEntry{Time: t.In(jakarta), Text: event.text})
+		}
+	}
+
+	return flare
+}
+
+// StartPostmortem creates the postmortem doc for the Flare in a channel from
+// the postmortem template, and posts and pins it there.
+func (s *Service) StartPostmortem(channelID string) {
+	if s.GooglePostmortemDocID == "" {
+		s.Chat.PostMessage(channelID, "I don't have a postmortem template configured, so I can't start a postmortem doc.")
+		return
+	}
+
+	record, err := s.FindFlare(channelID)
+	if err == ErrNoFlareDocs {
+		s.Chat.PostMessage(channelID, "I couldn't find the documents for this Flare, so I can't start a postmortem doc.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to find flare docs: %s", err)
+		s.Chat.PostMessage(channelID, GoogleErrorMessage(err, "start a postmortem doc"))
+		return
+	}
+	if record.Postmortem != nil {
+		s.Chat.PostMessage(channelID, fmt.Sprintf("This Flare already has a postmortem doc: %s", record.Postmortem.File.WebViewLink))
+		return
+	}
+
+	flare := s.postmortemFlare(channelID, record)
+
+	folderID := s.GoogleParentFolderID
+	if record.Folder != nil {
+		folderID = record.Folder.File.Id
+	}
+	properties := map[string]string{}
+	for k, v := range record.Properties {
+		properties[k] = v
+	}
+	properties[googledocs.PropertyDocType] = googledocs.DocTypePostmortem
+
+	log.Printf("Attempting to create postmortem doc")
+	postmortemDoc, err := s.GoogleDocsServer.CreateFromTemplate(fmt.Sprintf("Postmortem: %s", flare.Topic), s.GooglePostmortemDocID, folderID, properties)
+	if err != nil {
+		log.Printf("No postmortem doc created: %s", err)
+		s.Chat.PostMessage(channelID, GoogleErrorMessage(err, "make a postmortem doc"))
+		return
+	}
+
+	var missingPlaceholders []string
+	text, err := s.GoogleDocsServer.GetDocText(postmortemDoc)
+	if err != nil {
+		log.Printf("unexpected errror getting content from the postmortem doc: %s", err)
+	} else {
+		var resolved doctemplate.Values
+		resolved, missingPlaceholders = doctemplate.Resolve(text, flare.Values())
+		if err = s.GoogleDocsServer.ReplaceAllText(postmortemDoc, placeholderReplacements(resolved)); err != nil {
+			log.Printf("Couldn't fill in the postmortem doc: %s", err)
+		}
+	}
+
+	s.shareFlareDocs(channelID, []*googledocs.Doc{postmortemDoc}, properties)
+
+	s.postAndPin(channelID, fmt.Sprintf("Postmortem doc: %s", postmortemDoc.File.WebViewLink))
+	if len(missingPlaceholders) > 0 {
+		s.Chat.PostMessage(channelID, fmt.Sprintf("Heads up: I couldn't fill these placeholders in the postmortem doc: [%s]", strings.Join(missingPlaceholders, "], [")))
+	}
+}
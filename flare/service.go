@@ -0,0 +1,118 @@
+// Package flare is the Flare workflow: firing Flares, moving them through
+// their states, and keeping their documents and the tools around them up to
+// date. Chat platforms like Slack are front ends to it.
+package flare
+
+import (
+	"os"
+	"sync"
+
+	"github.com/modern-pet/flarebot/email"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/jira"
+	"github.com/modern-pet/flarebot/pager"
+	"github.com/modern-pet/flarebot/redact"
+	"github.com/modern-pet/flarebot/sharing"
+	"github.com/modern-pet/flarebot/statuspage"
+	"github.com/modern-pet/flarebot/webhooks"
+)
+
+// Counter numbers Flares. Flare channels are named after the numbers.
+type Counter interface {
+	// Next returns the number the next Flare gets.
+	Next() (string, error)
+	// Increment moves on past the number Next returned, once a Flare has it.
+	Increment() error
+}
+
+// Config is how the Flare workflow is set up.
+type Config struct {
+	// FlaresChannel is the channel Flares are fired from and announced in.
+	FlaresChannel         string
+	GoogleDomain          string
+	GoogleFlareDocID      string
+	GoogleHistoryDocID    string
+	GoogleParentFolderID  string
+	GooglePostmortemDocID string
+	StatusPageURL         string
+	Redactor              *redact.Redactor
+	SharingPolicies       *sharing.Policies
+	// Jira files a ticket for each Flare. It's nil if JIRA isn't configured.
+	Jira *jira.Client
+	// StatusPage opens public incidents for Flares. It's nil if no status
+	// page is configured.
+	StatusPage *statuspage.Client
+	// Pager pages people for Flares of PagePriorities. It's nil if paging
+	// isn't configured.
+	Pager          pager.Pager
+	PagePriorities map[string]bool
+	// Webhooks tells other tools about Flares. It's nil if no webhooks are
+	// configured.
+	Webhooks *webhooks.Dispatcher
+	// Email tells distribution lists about big Flares. It's nil if email
+	// isn't configured.
+	Email *email.Notifier
+	// Counter numbers Flares.
+	Counter Counter
+}
+
+// ConfigFromEnv reads the parts of the configuration that are plain
+// environment variables. The rest is up to the caller.
+func ConfigFromEnv() *Config {
+	return &Config{
+		FlaresChannel:         os.Getenv("SLACK_CHANNEL"),
+		GoogleDomain:          os.Getenv("GOOGLE_DOMAIN"),
+		GoogleFlareDocID:      os.Getenv("GOOGLE_TEMPLATE_DOC_ID"),
+		GoogleHistoryDocID:    os.Getenv("GOOGLE_TEMPLATE_SLACK_HISTORY_DOC_ID"),
+		GoogleParentFolderID:  os.Getenv("GOOGLE_PARENT_FOLDER_ID"),
+		GooglePostmortemDocID: os.Getenv("GOOGLE_TEMPLATE_POSTMORTEM_DOC_ID"),
+		StatusPageURL:         os.Getenv("STATUS_PAGE_URL"),
+		PagePriorities:        pagePrioritiesFromEnv(),
+	}
+}
+
+// Service runs the Flare workflow on a chat platform.
+type Service struct {
+	*Config
+	Chat             ChatPlatform
+	GoogleDocsServer googledocs.GoogleDocsService
+
+	// OnChannelCreated, if set, is called when a new Flare's channel has been
+	// set up, just before the Flare is announced, so the chat platform can add
+	// its own touches.
+	OnChannelCreated func(fired *Fired)
+
+	// fireMu makes sure one Flare is fired at a time, since Flares can be
+	// fired from chat, alerts and the API at once.
+	fireMu sync.Mutex
+	// stateMu makes sure a Flare's state is checked and changed in one go.
+	stateMu sync.Mutex
+	// timelineLocks hold a lock per flare doc, by file ID, while a row is
+	// added to its timeline: that takes two writes, which another row added
+	// in between would end up in. They're created behind timelineMu.
+	timelineMu    sync.Mutex
+	timelineLocks map[string]*sync.Mutex
+}
+
+// New returns a Service running the Flare workflow on chat.
+func New(chat ChatPlatform, googleDocsServer googledocs.GoogleDocsService, config *Config) *Service {
+	return &Service{
+		Config:           config,
+		Chat:             chat,
+		GoogleDocsServer: googleDocsServer,
+		timelineLocks:    map[string]*sync.Mutex{},
+	}
+}
+
+// timelineLock returns the lock on a flare doc's timeline.
+func (s *Service) timelineLock(docID string) *sync.Mutex {
+	s.timelineMu.Lock()
+	defer s.timelineMu.Unlock()
+
+	lock, ok := s.timelineLocks[docID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.timelineLocks[docID] = lock
+	}
+	return lock
+}
@@ -0,0 +1,370 @@
+package flare
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// fakeChat is an in-memory ChatPlatform recording what was posted.
+type fakeChat struct {
+	mu       sync.Mutex
+	users    map[string]*User
+	channels map[string]*Channel
+	// messages are the texts posted, by channel, and pins the texts pinned.
+	messages map[string][]string
+	pins     map[string][]string
+	invites  map[string][]string
+	// createErr makes CreateChannel fail.
+	createErr error
+}
+
+func newFakeChat(users ...*User) *fakeChat {
+	chat := &fakeChat{
+		users:    map[string]*User{},
+		channels: map[string]*Channel{},
+		messages: map[string][]string{},
+		pins:     map[string][]string{},
+		invites:  map[string][]string{},
+	}
+	for _, user := range users {
+		chat.users[user.ID] = user
+	}
+	return chat
+}
+
+func (c *fakeChat) Name() string { return "Fake" }
+
+func (c *fakeChat) PostMessage(channelID string, text string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages[channelID] = append(c.messages[channelID], text)
+	return fmt.Sprintf("%s/%d", channelID, len(c.messages[channelID])-1), nil
+}
+
+func (c *fakeChat) Pin(channelID string, messageID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i, err := strconv.Atoi(strings.TrimPrefix(messageID, channelID+"/"))
+	if err != nil || i >= len(c.messages[channelID]) {
+		return fmt.Errorf("no message %s", messageID)
+	}
+	c.pins[channelID] = append(c.pins[channelID], c.messages[channelID][i])
+	return nil
+}
+
+func (c *fakeChat) CreateChannel(name string) (*Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.createErr != nil {
+		return nil, c.createErr
+	}
+	channel := &Channel{ID: "C-" + name, Name: name}
+	c.channels[channel.ID] = channel
+	return channel, nil
+}
+
+func (c *fakeChat) SetTopic(channelID string, topic string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channel, ok := c.channels[channelID]
+	if !ok {
+		return fmt.Errorf("no channel %s", channelID)
+	}
+	channel.Topic = topic
+	return nil
+}
+
+func (c *fakeChat) Invite(channelID string, userIDs ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invites[channelID] = append(c.invites[channelID], userIDs...)
+	return nil
+}
+
+func (c *fakeChat) Channel(channelID string) (*Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channel, ok := c.channels[channelID]
+	if !ok {
+		return nil, fmt.Errorf("no channel %s", channelID)
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+func (c *fakeChat) ChannelMembers(channelID string) ([]*User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members := []*User{}
+	for _, id := range c.invites[channelID] {
+		if user, ok := c.users[id]; ok {
+			members = append(members, user)
+		}
+	}
+	return members, nil
+}
+
+func (c *fakeChat) User(userID string) (*User, error) {
+	if user, ok := c.users[userID]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("no user %s", userID)
+}
+
+func (c *fakeChat) UserByName(name string) (*User, error) {
+	for _, user := range c.users {
+		if user.Name == name {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("no user %s", name)
+}
+
+func (c *fakeChat) ChannelLink(channelID string) string {
+	return "https://chat.example.com/" + channelID
+}
+
+func (c *fakeChat) MentionChannel(channelID string) string { return "#" + channelID }
+func (c *fakeChat) MentionUser(userID string) string       { return "@" + userID }
+func (c *fakeChat) MentionEveryone() string                { return "@everyone" }
+
+// posted returns the messages posted in a channel.
+func (c *fakeChat) posted(channelID string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.messages[channelID]...)
+}
+
+// fakeCounter numbers Flares from next, or fails with err.
+type fakeCounter struct {
+	next int
+	err  error
+}
+
+func (c *fakeCounter) Next() (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return strconv.Itoa(c.next), nil
+}
+
+func (c *fakeCounter) Increment() error {
+	if c.err != nil {
+		return c.err
+	}
+	c.next++
+	return nil
+}
+
+const flaresChannel = "C-flares"
+
+// newTestService returns a Service on fake chat and Google, with Flares
+// numbered from 7.
+func newTestService(t *testing.T) (*Service, *fakeChat, *googledocs.FakeGoogleDocsServer) {
+	t.Helper()
+	chat := newFakeChat(
+		&User{ID: "U1", Name: "ada", Email: "ada@example.com"},
+		&User{ID: "U2", Name: "grace", Email: "grace@example.com"},
+	)
+	docs := googledocs.NewFakeGoogleDocsServer()
+	config := &Config{
+		FlaresChannel:         flaresChannel,
+		GoogleDomain:          "example.com",
+		GoogleFlareDocID:      "flare-template",
+		GoogleHistoryDocID:    "history-template",
+		GoogleParentFolderID:  "flares-folder",
+		GooglePostmortemDocID: "postmortem-template",
+		Counter:               &fakeCounter{next: 7},
+	}
+	return New(chat, docs, config), chat, docs
+}
+
+func contains(texts []string, part string) bool {
+	for _, text := range texts {
+		if strings.Contains(text, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFireSetsUpTheChannel(t *testing.T) {
+	service, chat, _ := newTestService(t)
+	var fired *Fired
+	service.OnChannelCreated = func(f *Fired) { fired = f }
+
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P1", Topic: "checkout is down", ReporterID: "U1"})
+	if channelID != "C-flare-7" {
+		t.Fatalf("fired in %q, want C-flare-7", channelID)
+	}
+
+	channel, _ := chat.Channel(channelID)
+	if channel.Topic != "checkout is down" {
+		t.Errorf("topic %q", channel.Topic)
+	}
+	if invites := chat.invites[channelID]; len(invites) != 1 || invites[0] != "U1" {
+		t.Errorf("invited %v, want the reporter", invites)
+	}
+	if !contains(chat.pins[channelID], "Flare doc: https://docs.google.com/") {
+		t.Errorf("the flare doc isn't pinned: %v", chat.pins[channelID])
+	}
+	if !contains(chat.posted(flaresChannel), "@everyone: Flare fired. Please visit #C-flare-7 -- checkout is down") {
+		t.Errorf("not announced: %v", chat.posted(flaresChannel))
+	}
+
+	if fired == nil || fired.ChannelID != channelID || fired.Priority != "P1" || fired.FlareDoc == nil || fired.HistoryDoc == nil || fired.Folder == nil {
+		t.Errorf("OnChannelCreated got %+v", fired)
+	}
+	if next, _ := service.Counter.Next(); next != "8" {
+		t.Errorf("the counter is at %s, want 8", next)
+	}
+
+	record, err := service.FindFlare(channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Properties[googledocs.PropertyState] != StateFired || record.Properties[googledocs.PropertyPriority] != "P1" {
+		t.Errorf("properties %v", record.Properties)
+	}
+}
+
+func TestFireRetroactiveMentionsTheReporter(t *testing.T) {
+	service, chat, _ := newTestService(t)
+
+	service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "the hottub", Retroactive: true, ReporterID: "U2"})
+
+	if !contains(chat.posted(flaresChannel), "@U2: Flare fired.") {
+		t.Errorf("the reporter wasn't mentioned: %v", chat.posted(flaresChannel))
+	}
+	if contains(chat.posted(flaresChannel), "@everyone") {
+		t.Errorf("a retroactive Flare woke everyone: %v", chat.posted(flaresChannel))
+	}
+}
+
+func TestFireWithoutAChannel(t *testing.T) {
+	service, chat, _ := newTestService(t)
+	chat.createErr = errors.New("name_taken")
+	called := false
+	service.OnChannelCreated = func(*Fired) { called = true }
+
+	if channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"}); channelID != "" {
+		t.Errorf("fired in %q without a channel", channelID)
+	}
+	if !contains(chat.posted(flaresChannel), "Fake is giving me some trouble right now") {
+		t.Errorf("the failure wasn't explained: %v", chat.posted(flaresChannel))
+	}
+	if called {
+		t.Error("OnChannelCreated was called without a channel")
+	}
+	// the ticket and docs already carry 7, so the next Flare mustn't reuse it
+	if next, _ := service.Counter.Next(); next != "8" {
+		t.Errorf("the counter is at %s after a Flare without a channel, want 8", next)
+	}
+}
+
+func TestFireWithoutANumber(t *testing.T) {
+	service, chat, docs := newTestService(t)
+	service.Counter = &fakeCounter{err: errors.New("AccessDenied")}
+
+	if channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"}); channelID != "" {
+		t.Errorf("fired in %q without a number", channelID)
+	}
+	if !contains(chat.posted(flaresChannel), "couldn't get a number for this Flare") {
+		t.Errorf("the failure wasn't explained: %v", chat.posted(flaresChannel))
+	}
+	if created := docs.Docs(); len(created) != 0 {
+		t.Errorf("created %d docs without a number", len(created))
+	}
+}
+
+func TestFlareLifecycle(t *testing.T) {
+	service, chat, docs := newTestService(t)
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"})
+
+	service.TakeLead(channelID, "U2")
+	service.SetRole(channelID, "U1", "comms")
+	service.SetPriority(channelID, "ada", "P1")
+	service.Transition(channelID, "grace", StateMitigated)
+
+	record, err := service.FindFlare(channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		googledocs.PropertyLead:      "grace",
+		rolePropertyPrefix + "comms": "ada",
+		googledocs.PropertyPriority:  "P1",
+		googledocs.PropertyState:     StateMitigated,
+	}
+	for key, value := range want {
+		if record.Properties[key] != value {
+			t.Errorf("%s is %q, want %q", key, record.Properties[key], value)
+		}
+	}
+	if record.Properties[googledocs.PropertyLeadAt] == "" || record.Properties[googledocs.PropertyMitigatedAt] == "" {
+		t.Errorf("times weren't recorded: %v", record.Properties)
+	}
+
+	if !contains(chat.posted(channelID), "@U2 is now incident lead") {
+		t.Errorf("the lead wasn't announced: %v", chat.posted(channelID))
+	}
+	if !contains(chat.posted(flaresChannel), "#C-flare-7 changed from P2 to P1") || !contains(chat.posted(flaresChannel), "Flare has been mitigated") {
+		t.Errorf("the Flares channel wasn't told: %v", chat.posted(flaresChannel))
+	}
+
+	// saying it again changes nothing
+	mitigatedAt := record.Properties[googledocs.PropertyMitigatedAt]
+	timeline := len(docs.FakeDoc(record.FlareDoc.File.Id).Tables[timelineHeading])
+	announced := len(chat.posted(flaresChannel))
+
+	time.Sleep(time.Second)
+	service.Transition(channelID, "ada", StateMitigated)
+
+	again, err := service.FindFlare(channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Properties[googledocs.PropertyMitigatedAt] != mitigatedAt {
+		t.Errorf("mitigated_at moved from %s to %s", mitigatedAt, again.Properties[googledocs.PropertyMitigatedAt])
+	}
+	if n := len(docs.FakeDoc(record.FlareDoc.File.Id).Tables[timelineHeading]); n != timeline {
+		t.Errorf("the timeline grew from %d to %d rows", timeline, n)
+	}
+	if n := len(chat.posted(flaresChannel)); n != announced {
+		t.Errorf("the Flares channel was told again: %v", chat.posted(flaresChannel)[announced:])
+	}
+	if !contains(chat.posted(channelID), "This Flare is already marked Mitigated.") {
+		t.Errorf("the repeat wasn't answered: %v", chat.posted(channelID))
+	}
+
+	// mitigated again after being resolved still counts from the first time
+	service.Transition(channelID, "grace", StateResolved)
+	service.Transition(channelID, "grace", StateMitigated)
+	last, err := service.FindFlare(channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Properties[googledocs.PropertyState] != StateMitigated || last.Properties[googledocs.PropertyMitigatedAt] != mitigatedAt {
+		t.Errorf("state %s mitigated at %s, want mitigated at %s", last.Properties[googledocs.PropertyState], last.Properties[googledocs.PropertyMitigatedAt], mitigatedAt)
+	}
+}
+
+func TestTransitionOutsideAFlare(t *testing.T) {
+	service, chat, _ := newTestService(t)
+
+	service.Transition("C-random", "grace", StateResolved)
+
+	if !contains(chat.posted("C-random"), "I can't find the documents of a Flare in this channel") {
+		t.Errorf("posted %v", chat.posted("C-random"))
+	}
+	if len(chat.posted(flaresChannel)) != 0 {
+		t.Errorf("the Flares channel was told: %v", chat.posted(flaresChannel))
+	}
+}
@@ -0,0 +1,129 @@
+package flare
+
+import (
+	"log"
+	"regexp"
+
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/sharing"
+)
+
+// Flare types, as stored in the flare_type appProperty. Sharing policies can
+// be configured per type.
+const (
+	TypeStandard    = "standard"
+	TypeRetroactive = "retroactive"
+	TypePreemptive  = "preemptive"
+	TypeSensitive   = "sensitive"
+)
+
+// sharingPolicyFor returns the sharing policy for a Flare with the given
+// appProperties.
+func (s *Service) sharingPolicyFor(properties map[string]string) *sharing.Policy {
+	return s.SharingPolicies.For(properties[googledocs.PropertyFlareType], properties[googledocs.PropertyPriority])
+}
+
+// shareFlareDocs applies the Flare's sharing policy to its files, and records
+// which version of the policy they were shared under.
+func (s *Service) shareFlareDocs(channelID string, docs []*googledocs.Doc, properties map[string]string) {
+	policy := s.sharingPolicyFor(properties)
+
+	var members []string
+	if policy.ChannelMembers != "" && !policy.Restricted && channelID != "" {
+		var err error
+		if members, err = s.channelMemberEmails(channelID); err != nil {
+			log.Printf("Couldn't list the members of %s to share with: %s", channelID, err)
+		}
+	}
+	grants := policy.Grants(s.GoogleDomain, members)
+
+	shared := []*googledocs.Doc{}
+	for _, doc := range docs {
+		if err := sharing.Apply(s.GoogleDocsServer, doc, policy, grants); err != nil {
+			// It's OK if we continue here, and don't error out
+			log.Printf("Couldn't share %s: %s", doc.File.Name, err)
+			continue
+		}
+		shared = append(shared, doc)
+	}
+
+	s.tagFlareDocs(shared, map[string]string{googledocs.PropertySharingPolicy: policy.Fingerprint()})
+}
+
+// reshareFlare applies the current sharing policy to all of a Flare's files.
+func (s *Service) reshareFlare(channelID string) {
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		log.Printf("Couldn't find the docs for %s: %s", channelID, err)
+		return
+	}
+
+	s.shareFlareDocs(channelID, record.Docs, record.Properties)
+}
+
+// ReapplySharingPolicies shares again every Flare file that was shared under a
+// policy that has since changed.
+func (s *Service) ReapplySharingPolicies() {
+	stale := map[string]bool{}
+	for _, docType := range []string{googledocs.DocTypeFolder, googledocs.DocTypeFlareDoc, googledocs.DocTypeHistory, googledocs.DocTypePostmortem} {
+		docs, err := s.GoogleDocsServer.FindDocs(map[string]string{googledocs.PropertyDocType: docType})
+		if err != nil {
+			log.Printf("Couldn't list flare files to check their sharing: %s", err)
+			return
+		}
+
+		for _, doc := range docs {
+			properties := doc.File.AppProperties
+			if properties[googledocs.PropertySharingPolicy] == s.sharingPolicyFor(properties).Fingerprint() {
+				continue
+			}
+			if channelID := properties[googledocs.PropertyChannelID]; channelID != "" {
+				stale[channelID] = true
+			} else {
+				s.shareFlareDocs("", []*googledocs.Doc{doc}, properties)
+			}
+		}
+	}
+
+	for channelID := range stale {
+		log.Printf("Sharing policy changed, sharing the files for %s again", channelID)
+		s.reshareFlare(channelID)
+	}
+}
+
+// ShareWithNewMember shares a Flare's files with someone who joins its
+// channel, if its policy shares with channel members.
+func (s *Service) ShareWithNewMember(channelID string) {
+	channel, err := s.Chat.Channel(channelID)
+	if err != nil || !regexp.MustCompile("^flare-").Match([]byte(channel.Name)) {
+		return
+	}
+
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		return
+	}
+	if policy := s.sharingPolicyFor(record.Properties); policy.ChannelMembers == "" || policy.Restricted {
+		return
+	}
+
+	s.shareFlareDocs(channelID, record.Docs, record.Properties)
+}
+
+// channelMemberEmails returns the profile email of every person in a channel.
+// Bots and people without an email are skipped.
+func (s *Service) channelMemberEmails(channelID string) ([]string, error) {
+	members, err := s.Chat.ChannelMembers(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := []string{}
+	for _, user := range members {
+		if user.IsBot || user.Email == "" {
+			continue
+		}
+		emails = append(emails, user.Email)
+	}
+	return emails, nil
+}
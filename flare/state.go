@@ -0,0 +1,228 @@
+package flare
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/modern-pet/flarebot/doctemplate"
+	"github.com/modern-pet/flarebot/email"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/webhooks"
+)
+
+// States a Flare can be in, as stored in the state appProperty of its files.
+const (
+	StateFired     = "fired"
+	StateMitigated = "mitigated"
+	StateNotAFlare = "not_a_flare"
+	StateResolved  = "resolved"
+)
+
+// stateTimeProperties are the appProperties recording when a Flare reached a
+// state.
+var stateTimeProperties = map[string]string{
+	StateMitigated: googledocs.PropertyMitigatedAt,
+	StateResolved:  googledocs.PropertyResolvedAt,
+}
+
+// stateNames are how states are written in the flare doc.
+var stateNames = map[string]string{
+	StateFired:     "Fired",
+	StateMitigated: "Mitigated",
+	StateNotAFlare: "Not a Flare",
+	StateResolved:  "Resolved",
+}
+
+// ErrNoFlareDocs is returned when a Flare's files can't be found.
+var ErrNoFlareDocs = errors.New("no flare documents for this channel")
+
+// ErrSameState is returned when a Flare is moved to the state it's in.
+var ErrSameState = errors.New("the Flare is already in that state")
+
+// Record is a Flare as recorded on the Drive files created for it.
+type Record struct {
+	Docs       []*googledocs.Doc
+	Folder     *googledocs.Doc
+	FlareDoc   *googledocs.Doc
+	HistoryDoc *googledocs.Doc
+	Postmortem *googledocs.Doc
+	// Properties are the flare doc's appProperties, or those of any of the
+	// Flare's files if it has no flare doc.
+	Properties map[string]string
+}
+
+// refresh picks up the properties of the Flare's files after they changed.
+func (r *Record) refresh() {
+	r.Properties = r.Docs[0].File.AppProperties
+	if r.FlareDoc != nil {
+		r.Properties = r.FlareDoc.File.AppProperties
+	}
+}
+
+// propertyTime parses a timestamp property, returning the zero time if it
+// isn't set.
+func (r *Record) propertyTime(key string) time.Time {
+	t, err := time.Parse(time.RFC3339, r.Properties[key])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// FindFlare looks up the Flare whose channel is channelID by the appProperties
+// on its files.
+func (s *Service) FindFlare(channelID string) (*Record, error) {
+	docs, err := s.GoogleDocsServer.FindDocs(map[string]string{googledocs.PropertyChannelID: channelID})
+	if err != nil {
+		return nil, err
+	}
+	return newFlareRecord(docs)
+}
+
+// findFlareByNumber looks up a Flare by its number.
+func (s *Service) findFlareByNumber(number string) (*Record, error) {
+	docs, err := googledocs.FindFlareDocs(s.GoogleDocsServer, number)
+	if err != nil {
+		return nil, err
+	}
+	return newFlareRecord(docs)
+}
+
+// newFlareRecord sorts the files of a Flare by what they're for.
+func newFlareRecord(docs []*googledocs.Doc) (*Record, error) {
+	if len(docs) == 0 {
+		return nil, ErrNoFlareDocs
+	}
+
+	record := &Record{Docs: docs}
+	for _, doc := range docs {
+		switch doc.File.AppProperties[googledocs.PropertyDocType] {
+		case googledocs.DocTypeFolder:
+			record.Folder = doc
+		case googledocs.DocTypeFlareDoc:
+			record.FlareDoc = doc
+		case googledocs.DocTypeHistory:
+			record.HistoryDoc = doc
+		case googledocs.DocTypePostmortem:
+			record.Postmortem = doc
+		}
+	}
+	record.refresh()
+
+	return record, nil
+}
+
+// flareProperties are the appProperties a new Flare file is created with.
+func flareProperties(flare *doctemplate.Flare, flareType string, docType string) map[string]string {
+	properties := flare.Values().Properties()
+	properties[googledocs.PropertyFlareType] = flareType
+	properties[googledocs.PropertyState] = StateFired
+	properties[googledocs.PropertyFiredAt] = flare.StartTime.UTC().Format(time.RFC3339)
+	properties[googledocs.PropertyDocType] = docType
+	return properties
+}
+
+// tagFlareDocs sets appProperties on every file created for a Flare. Every
+// file is tried, and failures are logged; the last one is returned.
+func (s *Service) tagFlareDocs(docs []*googledocs.Doc, properties map[string]string) error {
+	var failed error
+	for _, doc := range docs {
+		if err := s.GoogleDocsServer.UpdateAppProperties(doc, properties); err != nil {
+			log.Printf("Couldn't update properties of %s: %s", doc.File.Name, err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// FlareEvent records something that happened to the Flare in a channel: the
+// properties are set on all of its files, and the event is added to the
+// timeline and status block of its flare doc.
+func (s *Service) FlareEvent(channelID string, who string, text string, properties map[string]string) (*Record, error) {
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		log.Printf("Couldn't find the docs for %s: %s", channelID, err)
+		return nil, err
+	}
+
+	s.recordFlareEvent(record, time.Now(), who, text, properties)
+	return record, nil
+}
+
+// recordFlareEvent records an event on a Flare's files, returning whether
+// setting the properties failed. The timeline and status block are best
+// effort.
+func (s *Service) recordFlareEvent(record *Record, when time.Time, who string, text string, properties map[string]string) error {
+	var err error
+	if len(properties) > 0 {
+		err = s.tagFlareDocs(record.Docs, properties)
+		record.refresh()
+	}
+	s.addTimelineEntry(record, when, who, text)
+	s.refreshFlareStatus(record, text)
+	return err
+}
+
+// setFlareState records a Flare's new state, and when it first got there:
+// durations like time to mitigate are measured to the first time. If the
+// state couldn't be saved, nothing else is told about it.
+func (s *Service) setFlareState(record *Record, channelID string, who string, state string) error {
+	previous := record.Properties[googledocs.PropertyState]
+	properties := map[string]string{googledocs.PropertyState: state}
+	if key, ok := stateTimeProperties[state]; ok && record.Properties[key] == "" {
+		properties[key] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if err := s.recordFlareEvent(record, time.Now(), who, fmt.Sprintf("Flare marked %s", stateNames[state]), properties); err != nil {
+		return err
+	}
+	s.syncFlareTicket(channelID, record, who, state)
+	s.syncStatusPage(channelID, record, who, state)
+	s.resolvePage(channelID, record, who, state)
+	// other tools act on these, e.g. unfreezing deploys, so only a real
+	// change is sent
+	if event, ok := stateEvents[state]; ok && previous != state {
+		s.sendWebhook(event, who, channelID, record, map[string]string{"state": previous})
+	}
+	if state == StateResolved && previous != state {
+		s.emailFlare(email.KindResolved, who, channelID, record.Properties, record.FlareDoc, "")
+	}
+	return nil
+}
+
+// setFlareLead records the incident lead. The time of the first lead is kept,
+// since that's what time to lead is measured by.
+func (s *Service) setFlareLead(channelID string, lead string) {
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		log.Printf("Couldn't find the docs for %s: %s", channelID, err)
+		return
+	}
+
+	firstLead := record.Properties[googledocs.PropertyLeadAt] == ""
+	properties := map[string]string{googledocs.PropertyLead: lead}
+	if firstLead {
+		properties[googledocs.PropertyLeadAt] = time.Now().UTC().Format(time.RFC3339)
+	}
+	previous := map[string]string{googledocs.PropertyLead: record.Properties[googledocs.PropertyLead]}
+	s.recordFlareEvent(record, time.Now(), lead, fmt.Sprintf("%s became incident lead", lead), properties)
+	s.sendWebhook(webhooks.EventLeadAssigned, lead, channelID, record, previous)
+
+	// someone's on it, so the page can stop
+	if firstLead {
+		s.acknowledgePage(record, lead)
+	}
+}
+
+// TakeLead makes someone the incident lead of the Flare in a channel.
+func (s *Service) TakeLead(channelID string, userID string) {
+	name := userID
+	if user, err := s.Chat.User(userID); err == nil {
+		name = user.Name
+	}
+
+	s.Chat.PostMessage(channelID, fmt.Sprintf("Oh Captain My Captain! %s is now incident lead. Please confirm all actions with them.", s.Chat.MentionUser(userID)))
+	s.setFlareLead(channelID, name)
+}
@@ -0,0 +1,116 @@
+package flare
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/statuspage"
+)
+
+// statusPageFirstUpdate is the first update posted on a new incident.
+const statusPageFirstUpdate = "We're investigating an issue and will post updates here."
+
+// statusPageStateUpdates are the status an incident moves to, and the update
+// posted, when its Flare reaches a state.
+var statusPageStateUpdates = map[string]struct {
+	status string
+	body   string
+}{
+	StateMitigated: {statuspage.StatusMonitoring, "A fix has been implemented and we're monitoring the results."},
+	StateResolved:  {statuspage.StatusResolved, "This incident has been resolved."},
+	StateNotAFlare: {statuspage.StatusResolved, "This incident has been resolved."},
+}
+
+// statusPageEvent adds a status page call to the Flare's timeline, whether it
+// worked or not.
+func (s *Service) statusPageEvent(record *Record, who string, text string, err error, properties map[string]string) {
+	if err != nil {
+		log.Printf("%s failed: %s", text, err)
+		text = fmt.Sprintf("%s failed: %s", text, err)
+		properties = nil
+	}
+	s.recordFlareEvent(record, time.Now(), who, text, properties)
+}
+
+// OpenStatusPageIncident opens a public incident for the Flare in a channel,
+// titled with the channel topic.
+func (s *Service) OpenStatusPageIncident(channelID string, who string) {
+	if s.StatusPage == nil {
+		s.Chat.PostMessage(channelID, "I don't have a status page configured, so I can't open an incident.")
+		return
+	}
+
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		s.Chat.PostMessage(channelID, "I couldn't find the documents for this Flare, so I can't open a status page incident.")
+		return
+	}
+	if record.Properties[googledocs.PropertyStatusIncident] != "" {
+		s.Chat.PostMessage(channelID, "This Flare already has a status page incident. Post to it with statuspage update <text>.")
+		return
+	}
+
+	name := record.Properties[googledocs.PropertySummary]
+	if channel, err := s.Chat.Channel(channelID); err == nil && channel.Topic != "" {
+		name, _ = s.Redactor.Redact(channel.Topic)
+	}
+
+	incident, err := s.StatusPage.CreateIncident(name, statusPageFirstUpdate)
+	if err != nil {
+		s.statusPageEvent(record, who, "Opening a status page incident", err, nil)
+		s.Chat.PostMessage(channelID, fmt.Sprintf("The status page is giving me some trouble, so I couldn't open an incident: %s", err))
+		return
+	}
+	s.statusPageEvent(record, who, fmt.Sprintf("Status page incident opened: %s", name), nil, map[string]string{googledocs.PropertyStatusIncident: incident.ID})
+
+	link := incident.Shortlink
+	if link == "" {
+		link = s.StatusPageURL
+	}
+	s.Chat.PostMessage(channelID, fmt.Sprintf("Opened a status page incident: %s\nPost updates to it with statuspage update <text>.", link))
+}
+
+// syncStatusPage moves the Flare's status page incident along when the Flare
+// reaches a state.
+func (s *Service) syncStatusPage(channelID string, record *Record, who string, state string) {
+	id := record.Properties[googledocs.PropertyStatusIncident]
+	update, ok := statusPageStateUpdates[state]
+	if s.StatusPage == nil || id == "" || !ok {
+		return
+	}
+
+	_, err := s.StatusPage.UpdateIncident(id, update.status, update.body)
+	s.statusPageEvent(record, who, fmt.Sprintf("Status page incident moved to %s", update.status), err, nil)
+	if err != nil {
+		s.Chat.PostMessage(channelID, fmt.Sprintf("I couldn't move the status page incident to %s, please update it by hand.", update.status))
+	}
+}
+
+// UpdateStatusPage posts an update to the status page incident of the Flare
+// in a channel.
+func (s *Service) UpdateStatusPage(channelID string, who string, update string) {
+	if s.StatusPage == nil {
+		s.Chat.PostMessage(channelID, "I don't have a status page configured, so I can't post updates.")
+		return
+	}
+
+	record, err := s.FindFlare(channelID)
+	if err != nil || record.Properties[googledocs.PropertyStatusIncident] == "" {
+		s.Chat.PostMessage(channelID, "This Flare doesn't have a status page incident. Open one with statuspage open.")
+		return
+	}
+
+	// updates are public, so nothing secret should make it there
+	text, redactions := s.Redactor.Redact(update)
+	s.ReportRedactions(channelID, "the status page update", redactions)
+
+	_, err = s.StatusPage.UpdateIncident(record.Properties[googledocs.PropertyStatusIncident], "", text)
+	s.statusPageEvent(record, who, fmt.Sprintf("Status page updated: %s", text), err, nil)
+	if err != nil {
+		s.Chat.PostMessage(channelID, fmt.Sprintf("The status page is giving me some trouble, so I couldn't post that: %s", err))
+		return
+	}
+	s.Chat.PostMessage(channelID, "OK, posted that to the status page.")
+}
@@ -0,0 +1,221 @@
+package flare
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modern-pet/flarebot/doctemplate"
+	"github.com/modern-pet/flarebot/email"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/helpers"
+	"github.com/modern-pet/flarebot/webhooks"
+)
+
+const (
+	// statusPlaceholder marks where the status block goes in the flare doc
+	// template. At fire time it becomes the named range statusRangeName,
+	// which is rewritten on every update.
+	statusPlaceholder = "[STATUS]"
+	statusRangeName   = "flarebot-status"
+
+	// timelineHeading is the heading of the section holding the timeline
+	// table, whose columns are time, who and what happened.
+	timelineHeading = "Timeline"
+	// timelineTimeFormat is how times are written in the timeline table.
+	timelineTimeFormat = "2006-01-02 15:04"
+
+	// rolePropertyPrefix starts the appProperties recording who has a role,
+	// e.g. role_comms.
+	rolePropertyPrefix = "role_"
+)
+
+// flareRoles returns who has each role in the Flare, including the lead.
+func flareRoles(properties map[string]string) map[string]string {
+	roles := map[string]string{}
+	if lead := properties[googledocs.PropertyLead]; lead != "" {
+		roles["Incident lead"] = lead
+	}
+	for key, value := range properties {
+		if strings.HasPrefix(key, rolePropertyPrefix) {
+			role := strings.TrimPrefix(key, rolePropertyPrefix)
+			roles[strings.ToUpper(role[:1])+role[1:]+" lead"] = value
+		}
+	}
+	return roles
+}
+
+// flareStatusText is the status block of a Flare.
+func flareStatusText(record *Record, lastUpdate string) string {
+	properties := record.Properties
+
+	state := stateNames[properties[googledocs.PropertyState]]
+	if state == "" {
+		state = doctemplate.Unset
+	}
+	lead := properties[googledocs.PropertyLead]
+	if lead == "" {
+		lead = doctemplate.Unset
+	}
+
+	lines := []string{
+		fmt.Sprintf("State: %s", state),
+		fmt.Sprintf("Priority: %s", properties[googledocs.PropertyPriority]),
+		fmt.Sprintf("Incident lead: %s", lead),
+	}
+
+	roles := flareRoles(properties)
+	delete(roles, "Incident lead")
+	if len(roles) > 0 {
+		names := make([]string, 0, len(roles))
+		for role := range roles {
+			names = append(names, role)
+		}
+		sort.Strings(names)
+		for i, role := range names {
+			names[i] = fmt.Sprintf("%s: %s", role, roles[role])
+		}
+		lines = append(lines, fmt.Sprintf("Roles: %s", strings.Join(names, ", ")))
+	}
+
+	lines = append(lines, fmt.Sprintf("Last update: %s – %s", time.Now().In(helpers.JakartaLocation()).Format(timelineTimeFormat+" MST"), lastUpdate))
+
+	return strings.Join(lines, "\n")
+}
+
+// refreshFlareStatus rewrites the status block of the flare doc.
+func (s *Service) refreshFlareStatus(record *Record, lastUpdate string) {
+	if record.FlareDoc == nil {
+		return
+	}
+
+	if err := s.GoogleDocsServer.ReplaceNamedRange(record.FlareDoc, statusRangeName, flareStatusText(record, lastUpdate)); err != nil {
+		log.Printf("Couldn't update the flare doc status: %s", err)
+	}
+}
+
+// addTimelineEntry appends an event to the timeline table of the flare doc.
+func (s *Service) addTimelineEntry(record *Record, when time.Time, who string, text string) {
+	if record.FlareDoc == nil {
+		return
+	}
+
+	lock := s.timelineLock(record.FlareDoc.File.Id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	cells := []string{when.In(helpers.JakartaLocation()).Format(timelineTimeFormat), who, text}
+	if err := s.GoogleDocsServer.AppendTableRow(record.FlareDoc, timelineHeading, cells); err != nil {
+		log.Printf("Couldn't add to the flare doc timeline: %s", err)
+	}
+}
+
+// readTimeline returns the events in the flare doc's timeline table. Rows
+// without a time, like the header, are skipped.
+func (s *Service) readTimeline(record *Record) ([]doctemplate.TimelineEntry, error) {
+	if record.FlareDoc == nil {
+		return nil, nil
+	}
+
+	rows, err := s.GoogleDocsServer.GetTableRows(record.FlareDoc, timelineHeading)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []doctemplate.TimelineEntry{}
+	for _, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		when, err := time.ParseInLocation(timelineTimeFormat, row[0], helpers.JakartaLocation())
+		if err != nil {
+			continue
+		}
+		text := row[2]
+		if row[1] != "" {
+			text = fmt.Sprintf("%s (%s)", row[2], row[1])
+		}
+		entries = append(entries, doctemplate.TimelineEntry{Time: when, Text: text})
+	}
+
+	return entries, nil
+}
+
+// SetPriority changes the priority of the Flare in a channel, and pages for
+// it if it became big enough to.
+func (s *Service) SetPriority(channelID string, who string, priority string) {
+	record, err := s.FindFlare(channelID)
+	if err != nil {
+		s.Chat.PostMessage(channelID, "I couldn't find the documents for this Flare, so I can't change its priority.")
+		return
+	}
+	previous := record.Properties[googledocs.PropertyPriority]
+	if previous == priority {
+		s.Chat.PostMessage(channelID, fmt.Sprintf("This Flare is already %s.", priority))
+		return
+	}
+
+	s.recordFlareEvent(record, time.Now(), who, fmt.Sprintf("Priority changed from %s to %s", previous, priority), map[string]string{googledocs.PropertyPriority: priority})
+
+	s.Chat.PostMessage(channelID, fmt.Sprintf("OK, this Flare is now %s.", priority))
+	s.Chat.PostMessage(s.FlaresChannel, fmt.Sprintf("%s changed from %s to %s", s.Chat.MentionChannel(channelID), previous, priority))
+	s.sendWebhook(webhooks.EventPriorityChanged, who, channelID, record, map[string]string{"priority": previous})
+	s.emailFlare(email.KindPriorityChanged, who, channelID, record.Properties, record.FlareDoc, previous)
+
+	// the sharing policy may depend on the priority
+	s.shareFlareDocs(channelID, record.Docs, record.Properties)
+
+	// a Flare that became big enough to page for pages now
+	if s.pages(priority) && record.Properties[googledocs.PropertyPage] == "" && record.Properties[googledocs.PropertyFlareType] != TypeRetroactive {
+		flare := &doctemplate.Flare{
+			Number:      record.Properties[googledocs.PropertyFlareNumber],
+			ChannelName: record.Properties[googledocs.PropertyChannelName],
+			ChannelLink: s.Chat.ChannelLink(channelID),
+			Priority:    priority,
+			Topic:       record.Properties[googledocs.PropertySummary],
+			Reporter:    record.Properties[googledocs.PropertyReporter],
+		}
+		if record.FlareDoc != nil {
+			flare.FlareDocURL = record.FlareDoc.File.WebViewLink
+		}
+		s.pageFlare(channelID, record, who, newFlarePage(flare))
+	}
+}
+
+// SetRole records who has a role in the Flare in a channel, e.g. "comms".
+// The "incident" role is the incident lead.
+func (s *Service) SetRole(channelID string, userID string, role string) {
+	if role == "incident" {
+		s.TakeLead(channelID, userID)
+		return
+	}
+
+	name := userID
+	if user, err := s.Chat.User(userID); err == nil {
+		name = user.Name
+	}
+
+	_, err := s.FlareEvent(channelID, name, fmt.Sprintf("%s is %s lead", name, role), map[string]string{rolePropertyPrefix + role: name})
+	if err != nil {
+		s.Chat.PostMessage(channelID, "I couldn't find the documents for this Flare, so I can't record that role.")
+		return
+	}
+	s.Chat.PostMessage(channelID, fmt.Sprintf("OK, %s is %s lead.", s.Chat.MentionUser(userID), role))
+}
+
+// LogTimeline adds an entry to the timeline of the Flare in a channel.
+func (s *Service) LogTimeline(channelID string, who string, when time.Time, text string) {
+	text, redactions := s.Redactor.Redact(text)
+	s.ReportRedactions(channelID, "the timeline entry", redactions)
+
+	record, err := s.FindFlare(channelID)
+	if err != nil || record.FlareDoc == nil {
+		s.Chat.PostMessage(channelID, "This channel doesn't have a Flare doc, so I have nowhere to log that.")
+		return
+	}
+	s.recordFlareEvent(record, when, who, text, nil)
+
+	s.Chat.PostMessage(channelID, fmt.Sprintf("OK, logged that at %s to the Flare doc", when.In(helpers.JakartaLocation()).Format("15:04")))
+}
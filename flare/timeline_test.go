@@ -0,0 +1,64 @@
+package flare
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// slowTimelineDocs appends timeline rows slowly, like Docs does in two writes,
+// and counts how many appends overlapped.
+type slowTimelineDocs struct {
+	*googledocs.FakeGoogleDocsServer
+
+	mu          sync.Mutex
+	appending   int
+	overlapping int
+}
+
+func (d *slowTimelineDocs) AppendTableRow(doc *googledocs.Doc, heading string, cells []string) error {
+	d.mu.Lock()
+	d.appending++
+	if d.appending > 1 {
+		d.overlapping++
+	}
+	d.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	d.mu.Lock()
+	d.appending--
+	d.mu.Unlock()
+	return d.FakeGoogleDocsServer.AppendTableRow(doc, heading, cells)
+}
+
+func TestTimelineRowsDontInterleave(t *testing.T) {
+	service, _, fake := newTestService(t)
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"})
+	docs := &slowTimelineDocs{FakeGoogleDocsServer: fake}
+	service.GoogleDocsServer = docs
+
+	record, err := service.FindFlare(channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			service.addTimelineEntry(record, time.Now(), "ada", fmt.Sprintf("update %d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	if docs.overlapping != 0 {
+		t.Errorf("%d timeline rows were added while another was", docs.overlapping)
+	}
+	if rows := fake.FakeDoc(record.FlareDoc.File.Id).Tables[timelineHeading]; len(rows) != 6 {
+		t.Errorf("timeline has %d rows, want the fired row and 5 updates", len(rows))
+	}
+}
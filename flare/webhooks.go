@@ -0,0 +1,49 @@
+package flare
+
+import (
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/webhooks"
+)
+
+// stateEvents are the webhook events sent when a Flare reaches a state.
+var stateEvents = map[string]string{
+	StateMitigated: webhooks.EventMitigated,
+	StateResolved:  webhooks.EventResolved,
+	StateNotAFlare: webhooks.EventNotAFlare,
+}
+
+// webhookFlare describes a Flare for webhooks, from the appProperties of its
+// files.
+func (s *Service) webhookFlare(channelID string, properties map[string]string, flareDoc *googledocs.Doc) *webhooks.Flare {
+	flare := &webhooks.Flare{
+		Number:    properties[googledocs.PropertyFlareNumber],
+		ChannelID: channelID,
+		Channel:   properties[googledocs.PropertyChannelName],
+		Priority:  properties[googledocs.PropertyPriority],
+		Summary:   properties[googledocs.PropertySummary],
+		State:     properties[googledocs.PropertyState],
+		Type:      properties[googledocs.PropertyFlareType],
+		Lead:      properties[googledocs.PropertyLead],
+		Reporter:  properties[googledocs.PropertyReporter],
+		Links:     map[string]string{},
+	}
+	if channelID != "" {
+		flare.Links["channel"] = s.Chat.ChannelLink(channelID)
+	}
+	if flareDoc != nil {
+		flare.Links["flare_doc"] = flareDoc.File.WebViewLink
+	}
+	if key := properties[googledocs.PropertyTicket]; key != "" && s.Jira != nil {
+		flare.Links["ticket"] = s.Jira.BrowseURL(key)
+	}
+	return flare
+}
+
+// sendWebhook tells the webhooks subscribed to event about the Flare in a
+// record.
+func (s *Service) sendWebhook(event string, who string, channelID string, record *Record, previous map[string]string) {
+	if s.Webhooks == nil {
+		return
+	}
+	s.Webhooks.Send(event, who, s.webhookFlare(channelID, record.Properties, record.FlareDoc), previous)
+}
@@ -0,0 +1,66 @@
+package flare
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modern-pet/flarebot/webhooks"
+)
+
+func TestStateWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	received := []*webhooks.Payload{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := &webhooks.Payload{}
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, payload); err != nil {
+			t.Errorf("sent %q: %s", data, err)
+		}
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	dispatcher, err := webhooks.New([]*webhooks.Endpoint{{URL: server.URL, Secret: "secret", Events: []string{webhooks.EventMitigated, webhooks.EventResolved}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, _, _ := newTestService(t)
+	service.Webhooks = dispatcher
+	channelID := service.Fire(&Request{ChannelID: flaresChannel, Priority: "P2", Topic: "checkout is slow", ReporterID: "U1"})
+
+	service.Transition(channelID, "grace", StateMitigated)
+	service.Transition(channelID, "grace", StateMitigated)
+	service.Transition(channelID, "ada", StateResolved)
+	service.Transition(channelID, "ada", StateResolved)
+
+	// deliveries happen in the background
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		done := true
+		for _, delivery := range dispatcher.Deliveries() {
+			done = done && !delivery.Finished.IsZero()
+		}
+		if done {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("sent %d events, want one per change of state", len(received))
+	}
+	events := map[string]string{}
+	for _, payload := range received {
+		events[payload.Event] = payload.Previous["state"]
+	}
+	if events[webhooks.EventMitigated] != StateFired || events[webhooks.EventResolved] != StateMitigated {
+		t.Errorf("sent events with previous states %v", events)
+	}
+}
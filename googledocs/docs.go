@@ -0,0 +1,433 @@
+package googledocs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/docs/v1"
+)
+
+// DocText is text to write into a doc. If Link is set the text is a link.
+type DocText struct {
+	Text string
+	Link string
+}
+
+func (server *GoogleDocsServer) getDocument(doc *Doc) (*docs.Document, error) {
+	var document *docs.Document
+	err := call("docs.documents.get", func(ctx context.Context) (err error) {
+		document, err = server.docsService.Documents.Get(doc.File.Id).Context(ctx).Do()
+		return err
+	})
+	return document, err
+}
+
+func (server *GoogleDocsServer) batchUpdate(doc *Doc, revisionID string, requests []*docs.Request) error {
+	if len(requests) == 0 {
+		return nil
+	}
+
+	update := &docs.BatchUpdateDocumentRequest{Requests: requests}
+	if revisionID != "" {
+		// changes people made since we read the doc are merged, not clobbered
+		update.WriteControl = &docs.WriteControl{TargetRevisionId: revisionID}
+	}
+
+	return callWrite("docs.documents.batchUpdate", func(ctx context.Context) error {
+		_, err := server.docsService.Documents.BatchUpdate(doc.File.Id, update).Context(ctx).Do()
+		return err
+	})
+}
+
+// GetDocText returns the plain text of a doc's body, including table cells.
+func (server *GoogleDocsServer) GetDocText(doc *Doc) (string, error) {
+	document, err := server.getDocument(doc)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	walkTextRuns(document.Body.Content, func(run *docs.TextRun, startIndex int64) {
+		b.WriteString(run.Content)
+	})
+
+	return b.String(), nil
+}
+
+// ReplaceAllText replaces every occurrence of each key in the doc. Plain
+// values go through the Docs replaceAllText request, which keeps the
+// formatting around them; values with a link are replaced in place so the link
+// can be applied to exactly the new text.
+func (server *GoogleDocsServer) ReplaceAllText(doc *Doc, replacements map[string]DocText) error {
+	links := map[string]DocText{}
+	for key, value := range replacements {
+		if value.Link != "" && value.Text != "" {
+			links[key] = value
+		}
+	}
+
+	revisionID := ""
+	requests := []*docs.Request{}
+	if len(links) > 0 {
+		document, err := server.getDocument(doc)
+		if err != nil {
+			return err
+		}
+		revisionID = document.RevisionId
+
+		type occurrence struct {
+			start, end int64
+			value      DocText
+		}
+		occurrences := []occurrence{}
+		walkTextRuns(document.Body.Content, func(run *docs.TextRun, startIndex int64) {
+			for key, value := range links {
+				for _, offset := range utf16Indexes(run.Content, key) {
+					start := startIndex + offset
+					occurrences = append(occurrences, occurrence{start, start + utf16Len(key), value})
+				}
+			}
+		})
+
+		// work from the end of the doc back so earlier indexes stay valid
+		sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].start > occurrences[j].start })
+		for _, o := range occurrences {
+			requests = append(requests,
+				&docs.Request{DeleteContentRange: &docs.DeleteContentRangeRequest{
+					Range: &docs.Range{StartIndex: o.start, EndIndex: o.end},
+				}},
+				&docs.Request{InsertText: &docs.InsertTextRequest{
+					Location: &docs.Location{Index: o.start},
+					Text:     o.value.Text,
+				}},
+				&docs.Request{UpdateTextStyle: &docs.UpdateTextStyleRequest{
+					Range:     &docs.Range{StartIndex: o.start, EndIndex: o.start + utf16Len(o.value.Text)},
+					TextStyle: &docs.TextStyle{Link: &docs.Link{Url: o.value.Link}},
+					Fields:    "link",
+				}},
+			)
+		}
+	}
+
+	// Anything left over, including link placeholders split across differently
+	// formatted runs, is replaced as plain text.
+	keys := make([]string, 0, len(replacements))
+	for key := range replacements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		requests = append(requests, &docs.Request{ReplaceAllText: &docs.ReplaceAllTextRequest{
+			ContainsText:    &docs.SubstringMatchCriteria{Text: key, MatchCase: true},
+			ReplaceText:     replacements[key].Text,
+			ForceSendFields: []string{"ReplaceText"},
+		}})
+	}
+
+	return server.batchUpdate(doc, revisionID, requests)
+}
+
+// ReplaceNamedRange replaces the content of a named range, e.g. a status block
+// that is rewritten on every update.
+func (server *GoogleDocsServer) ReplaceNamedRange(doc *Doc, rangeName string, text string) error {
+	return server.batchUpdate(doc, "", []*docs.Request{{ReplaceNamedRangeContent: &docs.ReplaceNamedRangeContentRequest{
+		NamedRangeName: rangeName,
+		Text:           text,
+	}}})
+}
+
+// NameText makes the first occurrence of text in the doc a named range, e.g. a
+// placeholder that ReplaceNamedRange later keeps rewriting.
+func (server *GoogleDocsServer) NameText(doc *Doc, text string, rangeName string) error {
+	document, err := server.getDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	start := int64(-1)
+	walkTextRuns(document.Body.Content, func(run *docs.TextRun, startIndex int64) {
+		if offsets := utf16Indexes(run.Content, text); start < 0 && len(offsets) > 0 {
+			start = startIndex + offsets[0]
+		}
+	})
+	if start < 0 {
+		return fmt.Errorf("could not find %s", text)
+	}
+
+	return server.batchUpdate(doc, document.RevisionId, []*docs.Request{{CreateNamedRange: &docs.CreateNamedRangeRequest{
+		Name:  rangeName,
+		Range: &docs.Range{StartIndex: start, EndIndex: start + utf16Len(text)},
+	}}})
+}
+
+// InsertIntoNamedRange adds text at the end of a named range.
+func (server *GoogleDocsServer) InsertIntoNamedRange(doc *Doc, rangeName string, text string) error {
+	document, err := server.getDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	named, ok := document.NamedRanges[rangeName]
+	if !ok || len(named.NamedRanges) == 0 {
+		return fmt.Errorf("could not find named range %s", rangeName)
+	}
+
+	var end int64
+	for _, r := range named.NamedRanges[0].Ranges {
+		if r.EndIndex > end {
+			end = r.EndIndex
+		}
+	}
+
+	return server.batchUpdate(doc, document.RevisionId, []*docs.Request{{InsertText: &docs.InsertTextRequest{
+		Location: &docs.Location{Index: end},
+		Text:     text,
+	}}})
+}
+
+// InsertIntoSection adds a paragraph at the end of the section under the
+// heading with the given text (matched case-insensitively).
+func (server *GoogleDocsServer) InsertIntoSection(doc *Doc, heading string, text string) error {
+	document, err := server.getDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	content := document.Body.Content
+	start, end := findSection(content, heading)
+	if start < 0 {
+		return fmt.Errorf("could not find section %s", heading)
+	}
+
+	// insert before the newline ending the section's last paragraph, or after
+	// the section's last table
+	last := content[end-1]
+	index, inserted, textStart := last.EndIndex-1, "\n"+text, last.EndIndex
+	if last.Paragraph == nil {
+		index, inserted, textStart = last.EndIndex, text+"\n", last.EndIndex
+	}
+	requests := []*docs.Request{{InsertText: &docs.InsertTextRequest{
+		Location: &docs.Location{Index: index},
+		Text:     inserted,
+	}}}
+	if end-1 == start || last.Paragraph == nil {
+		// the new paragraph would otherwise pick up a heading's style
+		requests = append(requests, &docs.Request{UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+			Range:          &docs.Range{StartIndex: textStart, EndIndex: textStart + utf16Len(text)},
+			ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: "NORMAL_TEXT"},
+			Fields:         "namedStyleType",
+		}})
+	}
+
+	return server.batchUpdate(doc, document.RevisionId, requests)
+}
+
+// AppendTableRow adds a row to the end of the first table under the heading
+// with the given text, or the first table in the doc if heading is empty.
+func (server *GoogleDocsServer) AppendTableRow(doc *Doc, heading string, cells []string) error {
+	document, err := server.getDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	tableOrdinal := findTable(document.Body.Content, heading)
+	if tableOrdinal < 0 {
+		return fmt.Errorf("could not find a table under %s", heading)
+	}
+	table := nthTable(document.Body.Content, tableOrdinal)
+
+	err = server.batchUpdate(doc, document.RevisionId, []*docs.Request{{InsertTableRow: &docs.InsertTableRowRequest{
+		TableCellLocation: &docs.TableCellLocation{
+			TableStartLocation: &docs.Location{Index: table.StartIndex},
+			RowIndex:           table.Table.Rows - 1,
+		},
+		InsertBelow: true,
+	}}})
+	if err != nil {
+		return err
+	}
+
+	// the new row's cell indexes are only known after it exists
+	document, err = server.getDocument(doc)
+	if err != nil {
+		return err
+	}
+	table = nthTable(document.Body.Content, tableOrdinal)
+	if table == nil || len(table.Table.TableRows) == 0 {
+		return fmt.Errorf("table under %s disappeared while appending a row", heading)
+	}
+	row := table.Table.TableRows[len(table.Table.TableRows)-1]
+
+	requests := []*docs.Request{}
+	for i := len(row.TableCells) - 1; i >= 0; i-- {
+		if i >= len(cells) || cells[i] == "" || len(row.TableCells[i].Content) == 0 {
+			continue
+		}
+		requests = append(requests, &docs.Request{InsertText: &docs.InsertTextRequest{
+			Location: &docs.Location{Index: row.TableCells[i].Content[0].StartIndex},
+			Text:     cells[i],
+		}})
+	}
+
+	return server.batchUpdate(doc, document.RevisionId, requests)
+}
+
+// GetTableRows returns the text of every cell of the first table under the
+// heading with the given text, or the first table in the doc if heading is
+// empty.
+func (server *GoogleDocsServer) GetTableRows(doc *Doc, heading string) ([][]string, error) {
+	document, err := server.getDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	tableOrdinal := findTable(document.Body.Content, heading)
+	if tableOrdinal < 0 {
+		return nil, fmt.Errorf("could not find a table under %s", heading)
+	}
+	table := nthTable(document.Body.Content, tableOrdinal)
+
+	rows := make([][]string, 0, len(table.Table.TableRows))
+	for _, row := range table.Table.TableRows {
+		cells := make([]string, 0, len(row.TableCells))
+		for _, cell := range row.TableCells {
+			var b strings.Builder
+			walkTextRuns(cell.Content, func(run *docs.TextRun, startIndex int64) {
+				b.WriteString(run.Content)
+			})
+			cells = append(cells, strings.TrimSpace(b.String()))
+		}
+		rows = append(rows, cells)
+	}
+
+	return rows, nil
+}
+
+// walkTextRuns calls fn for every text run in content, including those in
+// tables, with the run's start index.
+func walkTextRuns(content []*docs.StructuralElement, fn func(run *docs.TextRun, startIndex int64)) {
+	for _, element := range content {
+		switch {
+		case element.Paragraph != nil:
+			for _, pe := range element.Paragraph.Elements {
+				if pe.TextRun != nil {
+					fn(pe.TextRun, pe.StartIndex)
+				}
+			}
+		case element.Table != nil:
+			for _, row := range element.Table.TableRows {
+				for _, cell := range row.TableCells {
+					walkTextRuns(cell.Content, fn)
+				}
+			}
+		}
+	}
+}
+
+func paragraphText(p *docs.Paragraph) string {
+	var b strings.Builder
+	for _, pe := range p.Elements {
+		if pe.TextRun != nil {
+			b.WriteString(pe.TextRun.Content)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// headingLevel returns 1-6 for headings, 0 for the title and -1 for anything
+// that isn't a heading.
+func headingLevel(element *docs.StructuralElement) int {
+	if element.Paragraph == nil || element.Paragraph.ParagraphStyle == nil {
+		return -1
+	}
+	style := element.Paragraph.ParagraphStyle.NamedStyleType
+	if style == "TITLE" {
+		return 0
+	}
+	var level int
+	if _, err := fmt.Sscanf(style, "HEADING_%d", &level); err != nil {
+		return -1
+	}
+	return level
+}
+
+// findSection returns the index in content of the heading with the given text
+// and the index just past the end of its section, or -1, -1.
+func findSection(content []*docs.StructuralElement, heading string) (int, int) {
+	for i, element := range content {
+		level := headingLevel(element)
+		if level < 0 || !strings.EqualFold(paragraphText(element.Paragraph), heading) {
+			continue
+		}
+
+		end := i + 1
+		for ; end < len(content); end++ {
+			if next := headingLevel(content[end]); next >= 0 && next <= level {
+				break
+			}
+		}
+		return i, end
+	}
+
+	return -1, -1
+}
+
+// findTable returns the ordinal (among all tables in content) of the first
+// table in the section under heading, or -1.
+func findTable(content []*docs.StructuralElement, heading string) int {
+	start, end := 0, len(content)
+	if heading != "" {
+		start, end = findSection(content, heading)
+		if start < 0 {
+			return -1
+		}
+	}
+
+	ordinal := 0
+	for i, element := range content {
+		if element.Table == nil {
+			continue
+		}
+		if i >= start && i < end {
+			return ordinal
+		}
+		ordinal++
+	}
+
+	return -1
+}
+
+func nthTable(content []*docs.StructuralElement, n int) *docs.StructuralElement {
+	for _, element := range content {
+		if element.Table == nil {
+			continue
+		}
+		if n == 0 {
+			return element
+		}
+		n--
+	}
+	return nil
+}
+
+// utf16Len is the length of s in the UTF-16 code units Docs indexes count.
+func utf16Len(s string) int64 {
+	return int64(len(utf16.Encode([]rune(s))))
+}
+
+// utf16Indexes returns the UTF-16 offsets of every occurrence of substr in s.
+func utf16Indexes(s string, substr string) []int64 {
+	offsets := []int64{}
+	from := 0
+	for {
+		i := strings.Index(s[from:], substr)
+		if i < 0 {
+			return offsets
+		}
+		offsets = append(offsets, utf16Len(s[:from+i]))
+		from += i + len(substr)
+	}
+}
@@ -0,0 +1,268 @@
+package googledocs
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+)
+
+// paragraph is a paragraph element of runs starting at start, styled as style
+// ("" for normal text).
+func paragraph(start int64, style string, runs ...string) *docs.StructuralElement {
+	element := &docs.StructuralElement{StartIndex: start, Paragraph: &docs.Paragraph{}}
+	if style != "" {
+		element.Paragraph.ParagraphStyle = &docs.ParagraphStyle{NamedStyleType: style}
+	}
+	index := start
+	for _, run := range runs {
+		element.Paragraph.Elements = append(element.Paragraph.Elements, &docs.ParagraphElement{
+			StartIndex: index,
+			EndIndex:   index + utf16Len(run),
+			TextRun:    &docs.TextRun{Content: run},
+		})
+		index += utf16Len(run)
+	}
+	element.EndIndex = index
+	return element
+}
+
+// table is a table element starting at start with rows of cells, each cell a
+// single paragraph.
+func table(start int64, rows ...[]string) *docs.StructuralElement {
+	element := &docs.StructuralElement{StartIndex: start, Table: &docs.Table{Rows: int64(len(rows))}}
+	index := start + 1
+	for _, cells := range rows {
+		row := &docs.TableRow{StartIndex: index}
+		index++
+		for _, text := range cells {
+			content := paragraph(index+1, "", text+"\n")
+			row.TableCells = append(row.TableCells, &docs.TableCell{StartIndex: index, EndIndex: content.EndIndex, Content: []*docs.StructuralElement{content}})
+			index = content.EndIndex
+		}
+		row.EndIndex = index
+		element.Table.TableRows = append(element.Table.TableRows, row)
+		element.Table.Columns = int64(len(cells))
+	}
+	element.EndIndex = index + 1
+	return element
+}
+
+// newTestDocsServer returns a GoogleDocsServer for a Docs API that serves each
+// of documents in turn, the last one from then on, and the requests of every
+// batchUpdate it received.
+func newTestDocsServer(t *testing.T, documents ...*docs.Document) (*GoogleDocsServer, *[][]*docs.Request) {
+	t.Helper()
+	updates := [][]*docs.Request{}
+	gets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/documents/doc1":
+			document := documents[len(documents)-1]
+			if gets < len(documents) {
+				document = documents[gets]
+			}
+			gets++
+			json.NewEncoder(w).Encode(document)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/documents/doc1:batchUpdate":
+			update := &docs.BatchUpdateDocumentRequest{}
+			data, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(data, update); err != nil {
+				t.Errorf("sent %q: %s", data, err)
+			}
+			if update.WriteControl != nil && update.WriteControl.TargetRevisionId != "rev1" {
+				t.Errorf("targeted revision %s, want the one read", update.WriteControl.TargetRevisionId)
+			}
+			updates = append(updates, update.Requests)
+			io.WriteString(w, `{"documentId": "doc1"}`)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	docsService, err := docs.New(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	docsService.BasePath = server.URL + "/"
+	return &GoogleDocsServer{docsService: docsService}, &updates
+}
+
+var testDoc = &Doc{File: &drive.File{Id: "doc1"}}
+
+func document(content ...*docs.StructuralElement) *docs.Document {
+	return &docs.Document{DocumentId: "doc1", RevisionId: "rev1", Body: &docs.Body{Content: content}}
+}
+
+func TestUTF16(t *testing.T) {
+	tests := []struct {
+		s       string
+		substr  string
+		length  int64
+		offsets []int64
+	}{
+		{"[X] and [X]", "[X]", 11, []int64{0, 8}},
+		{"é [X]", "[X]", 5, []int64{2}},
+		// the emoji is outside the BMP, so it's two code units
+		{"🔥 [X] é [X]", "[X]", 12, []int64{3, 9}},
+		{"🔥🔥", "[X]", 4, []int64{}},
+	}
+	for _, test := range tests {
+		if length := utf16Len(test.s); length != test.length {
+			t.Errorf("utf16Len(%q) = %d, want %d", test.s, length, test.length)
+		}
+		if offsets := utf16Indexes(test.s, test.substr); !reflect.DeepEqual(offsets, test.offsets) {
+			t.Errorf("utf16Indexes(%q, %q) = %v, want %v", test.s, test.substr, offsets, test.offsets)
+		}
+	}
+}
+
+func TestReplaceAllTextLinks(t *testing.T) {
+	server, updates := newTestDocsServer(t, document(
+		paragraph(1, "TITLE", "🔥 Flare [NUMBER]\n"),
+		paragraph(17, "", "See ", "[DOC]", " and 🔥 [DOC]\n"),
+	))
+
+	err := server.ReplaceAllText(testDoc, map[string]DocText{
+		"[DOC]":    {Text: "the doc", Link: "https://docs.google.com/d/1"},
+		"[NUMBER]": {Text: "7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := &docs.TextStyle{Link: &docs.Link{Url: "https://docs.google.com/d/1"}}
+	want := []*docs.Request{
+		// the second [DOC] is at 26 + len(" and 🔥 ")
+		{DeleteContentRange: &docs.DeleteContentRangeRequest{Range: &docs.Range{StartIndex: 34, EndIndex: 39}}},
+		{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: 34}, Text: "the doc"}},
+		{UpdateTextStyle: &docs.UpdateTextStyleRequest{Range: &docs.Range{StartIndex: 34, EndIndex: 41}, TextStyle: link, Fields: "link"}},
+		{DeleteContentRange: &docs.DeleteContentRangeRequest{Range: &docs.Range{StartIndex: 21, EndIndex: 26}}},
+		{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: 21}, Text: "the doc"}},
+		{UpdateTextStyle: &docs.UpdateTextStyleRequest{Range: &docs.Range{StartIndex: 21, EndIndex: 28}, TextStyle: link, Fields: "link"}},
+		{ReplaceAllText: &docs.ReplaceAllTextRequest{ContainsText: &docs.SubstringMatchCriteria{Text: "[DOC]", MatchCase: true}, ReplaceText: "the doc"}},
+		{ReplaceAllText: &docs.ReplaceAllTextRequest{ContainsText: &docs.SubstringMatchCriteria{Text: "[NUMBER]", MatchCase: true}, ReplaceText: "7"}},
+	}
+	if len(*updates) != 1 || !reflect.DeepEqual((*updates)[0], want) {
+		t.Errorf("updated with\n%s\nwant\n%s", requestsJSON(*updates), requestsJSON([][]*docs.Request{want}))
+	}
+}
+
+func TestNameText(t *testing.T) {
+	server, updates := newTestDocsServer(t, document(
+		paragraph(1, "", "🔥 Status:\n"),
+		paragraph(12, "", "🔥 [STATUS]\n"),
+	))
+
+	if err := server.NameText(testDoc, "[STATUS]", "status"); err != nil {
+		t.Fatal(err)
+	}
+	want := []*docs.Request{{CreateNamedRange: &docs.CreateNamedRangeRequest{Name: "status", Range: &docs.Range{StartIndex: 15, EndIndex: 23}}}}
+	if len(*updates) != 1 || !reflect.DeepEqual((*updates)[0], want) {
+		t.Errorf("updated with %s", requestsJSON(*updates))
+	}
+
+	if err := server.NameText(testDoc, "[OWNER]", "owner"); err == nil || !strings.Contains(err.Error(), "could not find [OWNER]") {
+		t.Errorf("got %v naming missing text", err)
+	}
+}
+
+func TestInsertIntoSection(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []*docs.StructuralElement
+		want    []*docs.Request
+	}{
+		{
+			name: "after a paragraph",
+			content: []*docs.StructuralElement{
+				paragraph(1, "HEADING_1", "Follow-ups\n"),
+				paragraph(12, "", "🔥 fix it\n"),
+				paragraph(22, "HEADING_1", "Notes\n"),
+			},
+			want: []*docs.Request{{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: 21}, Text: "\n🔥 check it"}}},
+		},
+		{
+			name: "right under the heading",
+			content: []*docs.StructuralElement{
+				paragraph(1, "HEADING_1", "Follow-ups\n"),
+				paragraph(12, "HEADING_1", "Notes\n"),
+			},
+			want: []*docs.Request{
+				{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: 11}, Text: "\n🔥 check it"}},
+				{UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+					Range:          &docs.Range{StartIndex: 12, EndIndex: 23},
+					ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: "NORMAL_TEXT"},
+					Fields:         "namedStyleType",
+				}},
+			},
+		},
+		{
+			name: "after a table",
+			content: []*docs.StructuralElement{
+				paragraph(1, "HEADING_1", "Follow-ups\n"),
+				table(12, []string{"🔥"}),
+			},
+			want: []*docs.Request{
+				{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: 19}, Text: "🔥 check it\n"}},
+				{UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+					Range:          &docs.Range{StartIndex: 19, EndIndex: 30},
+					ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: "NORMAL_TEXT"},
+					Fields:         "namedStyleType",
+				}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, updates := newTestDocsServer(t, document(test.content...))
+
+			if err := server.InsertIntoSection(testDoc, "follow-ups", "🔥 check it"); err != nil {
+				t.Fatal(err)
+			}
+			if len(*updates) != 1 || !reflect.DeepEqual((*updates)[0], test.want) {
+				t.Errorf("updated with\n%s\nwant\n%s", requestsJSON(*updates), requestsJSON([][]*docs.Request{test.want}))
+			}
+		})
+	}
+}
+
+func TestAppendTableRow(t *testing.T) {
+	heading := paragraph(1, "HEADING_1", "Timeline\n")
+	before := table(10, []string{"Time", "Who"})
+	after := table(10, []string{"Time", "Who"}, []string{"", ""})
+	server, updates := newTestDocsServer(t, document(paragraph(1, "", "🔥\n"), heading, before), document(paragraph(1, "", "🔥\n"), heading, after))
+
+	if err := server.AppendTableRow(testDoc, "Timeline", []string{"10:00", "🔥 ada"}); err != nil {
+		t.Fatal(err)
+	}
+
+	row := after.Table.TableRows[1]
+	want := [][]*docs.Request{
+		{{InsertTableRow: &docs.InsertTableRowRequest{
+			TableCellLocation: &docs.TableCellLocation{TableStartLocation: &docs.Location{Index: 10}},
+			InsertBelow:       true,
+		}}},
+		// the last cell first, so the first cell's index stays right
+		{
+			{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: row.TableCells[1].Content[0].StartIndex}, Text: "🔥 ada"}},
+			{InsertText: &docs.InsertTextRequest{Location: &docs.Location{Index: row.TableCells[0].Content[0].StartIndex}, Text: "10:00"}},
+		},
+	}
+	if !reflect.DeepEqual(*updates, want) {
+		t.Errorf("updated with\n%s\nwant\n%s", requestsJSON(*updates), requestsJSON(want))
+	}
+}
+
+func requestsJSON(updates [][]*docs.Request) string {
+	data, _ := json.Marshal(updates)
+	return string(data)
+}
@@ -0,0 +1,554 @@
+package googledocs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
+)
+
+// FakeDoc is everything the fake knows about one document.
+type FakeDoc struct {
+	Doc         *Doc
+	TemplateID  string
+	FolderID    string
+	Data        []byte
+	Properties  map[string]string
+	Content     string
+	NamedRanges map[string]string
+	Sections    map[string][]string
+	Tables      map[string][][]string
+	Shares      []FakeShare
+	// Tabs holds sheet rows by tab name, and TabOrder the tab names in
+	// order. A new sheet has one tab, Sheet1.
+	Tabs     map[string][][]interface{}
+	TabOrder []string
+	// Layouts are the tab layouts set with EnsureSheetTab.
+	Layouts map[string]*SheetTab
+}
+
+// FakeShare is a permission granted on a fake document.
+type FakeShare struct {
+	ID    string
+	Type  string
+	Value string
+	Role  string
+}
+
+// FakeGoogleDocsServer is an in-memory GoogleDocsService. It records every
+// doc created, its content, shares and sheet rows, for tests and for running
+// flarebot locally without Google credentials.
+type FakeGoogleDocsServer struct {
+	// Templates maps template doc IDs to their text, so copies have
+	// placeholders to fill. Unknown templates copy as empty docs.
+	Templates map[string]string
+
+	mu   sync.Mutex
+	docs map[string]*FakeDoc
+	// order keeps doc IDs in creation order.
+	order []string
+}
+
+var _ GoogleDocsService = &FakeGoogleDocsServer{}
+
+func NewFakeGoogleDocsServer() *FakeGoogleDocsServer {
+	return &FakeGoogleDocsServer{
+		Templates: map[string]string{},
+		docs:      map[string]*FakeDoc{},
+	}
+}
+
+// Docs returns the recorded documents in the order they were created.
+func (server *FakeGoogleDocsServer) Docs() []*FakeDoc {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	docs := make([]*FakeDoc, 0, len(server.order))
+	for _, id := range server.order {
+		docs = append(docs, server.docs[id])
+	}
+	return docs
+}
+
+// FakeDoc returns the recorded document with the given ID, or nil.
+func (server *FakeGoogleDocsServer) FakeDoc(fileID string) *FakeDoc {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.docs[fileID]
+}
+
+func (server *FakeGoogleDocsServer) lookup(doc *Doc) (*FakeDoc, error) {
+	fake, ok := server.docs[doc.File.Id]
+	if !ok {
+		return nil, &Error{Op: "fake", Kind: ErrNotFound, Err: fmt.Errorf("no doc %s", doc.File.Id)}
+	}
+	return fake, nil
+}
+
+// create records a new document. Callers must hold mu.
+func (server *FakeGoogleDocsServer) create(name string, mimeType string, link string, folderID string) *FakeDoc {
+	id := uuid.New().String()
+	file := &drive.File{
+		Id:          id,
+		Name:        name,
+		MimeType:    mimeType,
+		WebViewLink: fmt.Sprintf(link, id),
+		Parents:     parents(folderID),
+	}
+
+	fake := &FakeDoc{
+		Doc:         &Doc{File: file},
+		FolderID:    folderID,
+		Properties:  map[string]string{},
+		NamedRanges: map[string]string{},
+		Sections:    map[string][]string{},
+		Tables:      map[string][][]string{},
+		Tabs:        map[string][][]interface{}{"Sheet1": nil},
+		TabOrder:    []string{"Sheet1"},
+		Layouts:     map[string]*SheetTab{},
+	}
+	server.docs[id] = fake
+	server.order = append(server.order, id)
+
+	return fake
+}
+
+func (server *FakeGoogleDocsServer) CreateFromTemplate(title string, templateDocID string, folderID string, properties map[string]string) (*Doc, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake := server.create(title, "application/vnd.google-apps.document", "https://docs.google.com/document/d/%s/edit", folderID)
+	fake.TemplateID = templateDocID
+	fake.Content = server.Templates[templateDocID]
+	fake.Doc.File.AppProperties = map[string]string{}
+	for k, v := range properties {
+		fake.Properties[k] = v
+		fake.Doc.File.AppProperties[k] = v
+	}
+
+	return fake.Doc, nil
+}
+
+func (server *FakeGoogleDocsServer) UpdateAppProperties(doc *Doc, properties map[string]string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	if fake.Doc.File.AppProperties == nil {
+		fake.Doc.File.AppProperties = map[string]string{}
+	}
+	for k, v := range properties {
+		fake.Properties[k] = v
+		fake.Doc.File.AppProperties[k] = v
+	}
+	doc.File.AppProperties = fake.Doc.File.AppProperties
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) FindDocs(properties map[string]string) ([]*Doc, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	// newest first, like the real search
+	docs := []*Doc{}
+	for i := len(server.order) - 1; i >= 0; i-- {
+		fake := server.docs[server.order[i]]
+		matches := true
+		for k, v := range properties {
+			if fake.Properties[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			docs = append(docs, fake.Doc)
+		}
+	}
+
+	return docs, nil
+}
+
+func (server *FakeGoogleDocsServer) CreateFolder(name string, parentFolderID string) (*Doc, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.create(name, folderMimeType, "https://drive.google.com/drive/folders/%s", parentFolderID).Doc, nil
+}
+
+func (server *FakeGoogleDocsServer) UploadFile(name string, mimeType string, content io.Reader, folderID string) (*Doc, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake := server.create(name, mimeType, "https://drive.google.com/file/d/%s/view", folderID)
+	fake.Data = data
+
+	return fake.Doc, nil
+}
+
+func (server *FakeGoogleDocsServer) SetDocPermissionTypeRole(doc *Doc, permissionType string, permissionRole string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	for i := range fake.Shares {
+		if fake.Shares[i].Type == permissionType {
+			fake.Shares[i].Role = permissionRole
+			return nil
+		}
+	}
+
+	return fmt.Errorf("could not find permission of type %s", permissionType)
+}
+
+func (server *FakeGoogleDocsServer) ShareDocWithDomain(doc *Doc, domain string, permissionRole string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	fake.Shares = append(fake.Shares, FakeShare{ID: uuid.New().String(), Type: "domain", Value: domain, Role: permissionRole})
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) ListPermissions(doc *Doc) ([]*Permission, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the fake doesn't model folder inheritance, every share is direct
+	permissions := make([]*Permission, 0, len(fake.Shares))
+	for _, share := range fake.Shares {
+		permissions = append(permissions, &Permission{ID: share.ID, Type: share.Type, Value: share.Value, Role: share.Role})
+	}
+	return permissions, nil
+}
+
+func (server *FakeGoogleDocsServer) SharePermission(doc *Doc, permissionType string, value string, permissionRole string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	fake.Shares = append(fake.Shares, FakeShare{ID: uuid.New().String(), Type: permissionType, Value: value, Role: permissionRole})
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) UpdatePermission(doc *Doc, permissionID string, permissionRole string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	for i := range fake.Shares {
+		if fake.Shares[i].ID == permissionID {
+			fake.Shares[i].Role = permissionRole
+			return nil
+		}
+	}
+
+	return &Error{Op: "fake", Kind: ErrNotFound, Err: fmt.Errorf("no permission %s", permissionID)}
+}
+
+func (server *FakeGoogleDocsServer) DeletePermission(doc *Doc, permissionID string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	for i := range fake.Shares {
+		if fake.Shares[i].ID == permissionID {
+			fake.Shares = append(fake.Shares[:i], fake.Shares[i+1:]...)
+			return nil
+		}
+	}
+
+	return &Error{Op: "fake", Kind: ErrNotFound, Err: fmt.Errorf("no permission %s", permissionID)}
+}
+
+func (server *FakeGoogleDocsServer) GetDoc(fileID string) (*Doc, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.lookupID(fileID)
+}
+
+func (server *FakeGoogleDocsServer) lookupID(fileID string) (*Doc, error) {
+	fake, ok := server.docs[fileID]
+	if !ok {
+		return nil, &Error{Op: "fake", Kind: ErrNotFound, Err: fmt.Errorf("no doc %s", fileID)}
+	}
+	return fake.Doc, nil
+}
+
+func (server *FakeGoogleDocsServer) GetDocContent(doc *Doc, reltype string) (string, error) {
+	return server.GetDocText(doc)
+}
+
+func (server *FakeGoogleDocsServer) UpdateDocContent(doc *Doc, content string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	fake.Content = content
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) GetDocText(doc *Doc) (string, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return "", err
+	}
+
+	return fake.Content, nil
+}
+
+func (server *FakeGoogleDocsServer) ReplaceAllText(doc *Doc, replacements map[string]DocText) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	for key, value := range replacements {
+		fake.Content = strings.Replace(fake.Content, key, value.Text, -1)
+	}
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) NameText(doc *Doc, text string, rangeName string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(fake.Content, text) {
+		return fmt.Errorf("could not find %s", text)
+	}
+	fake.NamedRanges[rangeName] = text
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) ReplaceNamedRange(doc *Doc, rangeName string, text string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	current, ok := fake.NamedRanges[rangeName]
+	if !ok {
+		return fmt.Errorf("could not find named range %s", rangeName)
+	}
+	fake.Content = strings.Replace(fake.Content, current, text, 1)
+	fake.NamedRanges[rangeName] = text
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) InsertIntoNamedRange(doc *Doc, rangeName string, text string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	current, ok := fake.NamedRanges[rangeName]
+	if !ok {
+		return fmt.Errorf("could not find named range %s", rangeName)
+	}
+	fake.Content = strings.Replace(fake.Content, current, current+text, 1)
+	fake.NamedRanges[rangeName] += text
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) InsertIntoSection(doc *Doc, heading string, text string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	fake.Sections[heading] = append(fake.Sections[heading], text)
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) AppendTableRow(doc *Doc, heading string, cells []string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	fake.Tables[heading] = append(fake.Tables[heading], append([]string{}, cells...))
+
+	return nil
+}
+
+// tab returns the name of a tab, "" being the first one.
+func (fake *FakeDoc) tab(name string) (string, error) {
+	if name == "" && len(fake.TabOrder) > 0 {
+		return fake.TabOrder[0], nil
+	}
+	if _, ok := fake.Tabs[name]; !ok {
+		return "", &Error{Op: "fake", Kind: ErrNotFound, Err: fmt.Errorf("no tab %s", name)}
+	}
+	return name, nil
+}
+
+func (server *FakeGoogleDocsServer) GetTableRows(doc *Doc, heading string) ([][]string, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(fake.Tables[heading]))
+	for _, row := range fake.Tables[heading] {
+		rows = append(rows, append([]string{}, row...))
+	}
+	return rows, nil
+}
+
+func (server *FakeGoogleDocsServer) GetSheetTabs(doc *Doc) ([]string, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{}, fake.TabOrder...), nil
+}
+
+func (server *FakeGoogleDocsServer) EnsureSheetTab(doc *Doc, tab *SheetTab) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+
+	name, err := fake.tab(tab.Name)
+	if err != nil {
+		name = tab.Name
+		fake.Tabs[name] = nil
+		fake.TabOrder = append(fake.TabOrder, name)
+	}
+	if rows := fake.Tabs[name]; len(rows) > 0 && isHeader(rows[0], tab.Header) {
+		return nil
+	}
+
+	header := make([]interface{}, len(tab.Header))
+	for i, title := range tab.Header {
+		header[i] = title
+	}
+	fake.Tabs[name] = append([][]interface{}{header}, fake.Tabs[name]...)
+	fake.Layouts[name] = tab
+
+	return nil
+}
+
+func (server *FakeGoogleDocsServer) GetSheetContent(doc *Doc, tab string) (*sheets.ValueRange, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return nil, err
+	}
+	name, err := fake.tab(tab)
+	if err != nil {
+		return nil, err
+	}
+
+	// like FORMATTED_VALUE, every cell comes back as a string
+	rows := make([][]interface{}, 0, len(fake.Tabs[name]))
+	for _, row := range fake.Tabs[name] {
+		formatted := make([]interface{}, len(row))
+		for i, v := range row {
+			formatted[i] = fmt.Sprint(v)
+		}
+		rows = append(rows, formatted)
+	}
+
+	return &sheets.ValueRange{MajorDimension: "ROWS", Values: rows}, nil
+}
+
+func (server *FakeGoogleDocsServer) AppendSheetContent(doc *Doc, tab string, values []interface{}) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	fake, err := server.lookup(doc)
+	if err != nil {
+		return err
+	}
+	name, err := fake.tab(tab)
+	if err != nil {
+		return err
+	}
+
+	// like Sheets with USER_ENTERED, a leading ' only marks the value as text
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			v = strings.TrimPrefix(s, "'")
+		}
+		row[i] = v
+	}
+	fake.Tabs[name] = append(fake.Tabs[name], row)
+
+	return nil
+}
@@ -3,7 +3,9 @@
 package googledocs
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -11,7 +13,8 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
-	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -19,15 +22,37 @@ type Doc struct {
 	File *drive.File
 }
 
+// fileFields are the file fields flarebot uses. Drive v3 only returns a few
+// fields unless asked for more.
+const fileFields = "id, name, mimeType, webViewLink, parents, appProperties"
+
 type GoogleDocsService interface {
-	CreateFromTemplate(title string, templateDocID string, properties map[string]string) (*Doc, error)
+	CreateFromTemplate(title string, templateDocID string, folderID string, properties map[string]string) (*Doc, error)
+	CreateFolder(name string, parentFolderID string) (*Doc, error)
+	UploadFile(name string, mimeType string, content io.Reader, folderID string) (*Doc, error)
 	SetDocPermissionTypeRole(doc *Doc, permissionType string, permissionRole string) error
+	ListPermissions(doc *Doc) ([]*Permission, error)
+	SharePermission(doc *Doc, permissionType string, value string, permissionRole string) error
+	UpdatePermission(doc *Doc, permissionID string, permissionRole string) error
+	DeletePermission(doc *Doc, permissionID string) error
 	ShareDocWithDomain(doc *Doc, domain string, permissionRole string) error
 	GetDoc(fileID string) (*Doc, error)
 	GetDocContent(doc *Doc, reltype string) (string, error)
 	UpdateDocContent(doc *Doc, content string) error
-	GetSheetContent(doc *Doc) (*sheets.ValueRange, error)
-	AppendSheetContent(doc *Doc, values []interface{}) error
+	GetDocText(doc *Doc) (string, error)
+	ReplaceAllText(doc *Doc, replacements map[string]DocText) error
+	NameText(doc *Doc, text string, rangeName string) error
+	ReplaceNamedRange(doc *Doc, rangeName string, text string) error
+	InsertIntoNamedRange(doc *Doc, rangeName string, text string) error
+	InsertIntoSection(doc *Doc, heading string, text string) error
+	AppendTableRow(doc *Doc, heading string, cells []string) error
+	GetTableRows(doc *Doc, heading string) ([][]string, error)
+	GetSheetTabs(doc *Doc) ([]string, error)
+	EnsureSheetTab(doc *Doc, tab *SheetTab) error
+	GetSheetContent(doc *Doc, tab string) (*sheets.ValueRange, error)
+	AppendSheetContent(doc *Doc, tab string, values []interface{}) error
+	UpdateAppProperties(doc *Doc, properties map[string]string) error
+	FindDocs(properties map[string]string) ([]*Doc, error)
 }
 
 type GoogleDocsServer struct {
@@ -37,8 +62,11 @@ type GoogleDocsServer struct {
 	client       *http.Client
 	service      *drive.Service
 	sheetService *sheets.Service
+	docsService  *docs.Service
 }
 
+var _ GoogleDocsService = &GoogleDocsServer{}
+
 func NewGoogleDocsServerWithServiceAccount(jsonConfigString string) (*GoogleDocsServer, error) {
 	jsonBytes := []byte(jsonConfigString)
 
@@ -61,10 +89,16 @@ func NewGoogleDocsServerWithServiceAccount(jsonConfigString string) (*GoogleDocs
 		return nil, err
 	}
 
+	docsService, err := docs.New(oauthClient)
+	if err != nil {
+		return nil, err
+	}
+
 	return &GoogleDocsServer{
 		client:       oauthClient,
 		service:      service,
 		sheetService: sheetService,
+		docsService:  docsService,
 	}, nil
 }
 
@@ -85,37 +119,97 @@ func NewGoogleDocsServer(clientID string, clientSecret string, accessToken *oaut
 		return nil, err
 	}
 
+	sheetService, err := sheets.New(oauthClient)
+	if err != nil {
+		return nil, err
+	}
+
+	docsService, err := docs.New(oauthClient)
+	if err != nil {
+		return nil, err
+	}
+
 	return &GoogleDocsServer{
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		accessToken:  accessToken,
 		client:       oauthClient,
 		service:      service,
+		sheetService: sheetService,
+		docsService:  docsService,
 	}, nil
 }
 
-func (server *GoogleDocsServer) CreateFromTemplate(title string, templateDocID string, properties map[string]string) (*Doc, error) {
-	// add metadata properties
-	propertiesArray := make([]*drive.Property, 0, len(properties))
-	if properties != nil {
-		for k, v := range properties {
-			propertiesArray = append(propertiesArray, &drive.Property{
-				Key:        k,
-				Value:      v,
-				Visibility: "public",
-			})
-		}
+// CreateFromTemplate copies a template into the given folder, or the service
+// account's root if folderID is empty. properties are stored as the file's
+// appProperties, which only flarebot can see and search.
+func (server *GoogleDocsServer) CreateFromTemplate(title string, templateDocID string, folderID string, properties map[string]string) (*Doc, error) {
+	var file *drive.File
+	err := callWrite("drive.files.copy", func(ctx context.Context) (err error) {
+		file, err = server.service.Files.Copy(templateDocID, &drive.File{
+			Name:          title,
+			AppProperties: properties,
+			Parents:       parents(folderID),
+		}).SupportsAllDrives(true).Fields(fileFields).Context(ctx).Do()
+		return err
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	file := &drive.File{
-		Title:      title,
-		Properties: propertiesArray,
+	return &Doc{
+		File: file,
+	}, nil
+}
+
+// folderMimeType is the MIME type Drive uses for folders.
+const folderMimeType = "application/vnd.google-apps.folder"
+
+func parents(folderID string) []string {
+	if folderID == "" {
+		return nil
 	}
+	return []string{folderID}
+}
 
-	file, err := server.service.Files.Copy(templateDocID, &drive.File{
-		Title: title,
-	}).Do()
+// CreateFolder creates a folder inside another, which may be on a shared drive.
+func (server *GoogleDocsServer) CreateFolder(name string, parentFolderID string) (*Doc, error) {
+	var folder *drive.File
+	err := callWrite("drive.files.create", func(ctx context.Context) (err error) {
+		folder, err = server.service.Files.Create(&drive.File{
+			Name:     name,
+			MimeType: folderMimeType,
+			Parents:  parents(parentFolderID),
+		}).SupportsAllDrives(true).Fields(fileFields).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Doc{
+		File: folder,
+	}, nil
+}
+
+// UploadFile stores a file, e.g. one shared in a flare channel, in a folder.
+func (server *GoogleDocsServer) UploadFile(name string, mimeType string, content io.Reader, folderID string) (*Doc, error) {
+	// buffered so a rate-limited upload can be retried
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
 
+	var file *drive.File
+	err = callWrite("drive.files.upload", func(ctx context.Context) (err error) {
+		file, err = server.service.Files.Create(&drive.File{
+			Name:     name,
+			MimeType: mimeType,
+			Parents:  parents(folderID),
+		}).Media(bytes.NewReader(data)).SupportsAllDrives(true).Fields(fileFields).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -129,17 +223,23 @@ func (server *GoogleDocsServer) SetDocPermissionTypeRole(doc *Doc, permissionTyp
 	file := doc.File
 
 	// make it editable by the entire organization
-	permissions, err := server.service.Permissions.List(file.Id).Do()
+	var permissions *drive.PermissionList
+	err := call("drive.permissions.list", func(ctx context.Context) (err error) {
+		permissions, err = server.service.Permissions.List(file.Id).SupportsAllDrives(true).Fields("permissions(id, type, role, domain, emailAddress)").Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
 	// look for the right permission and update it to "Writer"
-	for _, perm := range permissions.Items {
+	for _, perm := range permissions.Permissions {
 		if perm.Type == permissionType {
-			perm.Role = permissionRole
-			_, err = server.service.Permissions.Update(file.Id, perm.Id, perm).Do()
-			return err
+			permID := perm.Id
+			return call("drive.permissions.update", func(ctx context.Context) error {
+				_, err := server.service.Permissions.Update(file.Id, permID, &drive.Permission{Role: permissionRole}).SupportsAllDrives(true).Context(ctx).Do()
+				return err
+			})
 		}
 	}
 
@@ -150,16 +250,21 @@ func (server *GoogleDocsServer) ShareDocWithDomain(doc *Doc, domain string, perm
 	file := doc.File
 
 	// make it editable by the entire organization
-	newPermission := &drive.Permission{Value: domain, Type: "domain", Role: permissionRole}
+	newPermission := &drive.Permission{Domain: domain, Type: "domain", Role: permissionRole}
 
 	// create a new permission
-	_, err := server.service.Permissions.Insert(file.Id, newPermission).Do()
-
-	return err
+	return callWrite("drive.permissions.create", func(ctx context.Context) error {
+		_, err := server.service.Permissions.Create(file.Id, newPermission).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
 }
 
 func (server *GoogleDocsServer) GetDoc(fileID string) (*Doc, error) {
-	f, err := server.service.Files.Get(fileID).Do()
+	var f *drive.File
+	err := call("drive.files.get", func(ctx context.Context) (err error) {
+		f, err = server.service.Files.Get(fileID).SupportsAllDrives(true).Fields(fileFields).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -169,42 +274,33 @@ func (server *GoogleDocsServer) GetDoc(fileID string) (*Doc, error) {
 	}, nil
 }
 
+// GetDocContent exports a doc in the given MIME type, e.g. "text/html".
 func (server *GoogleDocsServer) GetDocContent(doc *Doc, reltype string) (string, error) {
-	relLink := doc.File.ExportLinks[reltype]
-
-	response, err := server.client.Get(relLink)
+	var content string
+	err := call("drive.files.export", func(ctx context.Context) error {
+		response, err := server.service.Files.Export(doc.File.Id, reltype).Context(ctx).Download()
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return "", err
-	}
+		defer response.Body.Close()
+		bytes, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
 
-	defer response.Body.Close()
-	bytes, err := ioutil.ReadAll(response.Body)
+		content = string(bytes)
+		return nil
+	})
 
-	if err != nil {
-		return "", err
-	}
-
-	return string(bytes), nil
+	return content, err
 }
 
 // UpdateDocContent update the content in a doc, replacing the entire file with the new (html) body.
+// Prefer ReplaceAllText and friends, which keep the doc's formatting.
 func (server *GoogleDocsServer) UpdateDocContent(doc *Doc, content string) error {
-	server.service.Files.Update(doc.File.Id, doc.File).Media(strings.NewReader(content)).Do()
-	return nil
-}
-
-func (server *GoogleDocsServer) GetSheetContent(doc *Doc) (*sheets.ValueRange, error) {
-	return server.sheetService.Spreadsheets.Values.
-		Get(doc.File.Id, "Sheet1").
-		ValueRenderOption("FORMATTED_VALUE").DateTimeRenderOption("SERIAL_NUMBER").
-		Context(context.TODO()).Do()
-}
-
-// AppendSheetContent appends a new row to the end of the sheet.
-func (server *GoogleDocsServer) AppendSheetContent(doc *Doc, values []interface{}) error {
-	_, err := server.sheetService.Spreadsheets.Values.
-		Append(doc.File.Id, "Sheet1", &sheets.ValueRange{MajorDimension: "ROWS", Values: [][]interface{}{values}}).
-		ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Context(context.TODO()).Do()
-	return err
+	return call("drive.files.update", func(ctx context.Context) error {
+		_, err := server.service.Files.Update(doc.File.Id, &drive.File{}).Media(strings.NewReader(content)).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
 }
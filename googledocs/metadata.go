@@ -0,0 +1,127 @@
+package googledocs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// appProperties flarebot writes on every file it creates for a Flare, so the
+// file can be traced back to its Flare and found again.
+const (
+	PropertyFlareNumber = "flare_number"
+	PropertyChannelID   = "channel_id"
+	PropertyPriority    = "priority"
+	PropertyState       = "state"
+	PropertyFiredAt     = "fired_at"
+	PropertyLead        = "lead"
+	PropertyLeadAt      = "lead_at"
+	PropertyMitigatedAt = "mitigated_at"
+	PropertyResolvedAt  = "resolved_at"
+	PropertyFlareType   = "flare_type"
+	// PropertyTicket is the key of the Flare's JIRA ticket.
+	PropertyTicket = "ticket"
+	// PropertyStatusIncident is the ID of the Flare's status page incident.
+	PropertyStatusIncident = "status_incident"
+	// PropertyPage is the dedup key of the page sent for the Flare, and
+	// PropertyPageResolvedAt when that page was resolved.
+	PropertyPage           = "page"
+	PropertyPageResolvedAt = "page_resolved_at"
+	// PropertyAlertGroup identifies the Alertmanager alert group the Flare
+	// was fired for, so later alerts of the group reach its channel.
+	PropertyAlertGroup = "alert_group"
+	// PropertySharingPolicy is the fingerprint of the sharing policy the file
+	// was last shared under.
+	PropertySharingPolicy = "sharing_policy"
+	// PropertyDocType says what the file is for, one of the DocType values.
+	PropertyDocType = "doc_type"
+	// PropertyChannelName, PropertySummary and PropertyReporter come from the
+	// template values of the same names, [FLARE-CHANNEL], [SUMMARY] and
+	// [REPORTER], which every file is tagged with when it's created.
+	PropertyChannelName = "flare_channel"
+	PropertySummary     = "summary"
+	PropertyReporter    = "reporter"
+)
+
+// Values of PropertyDocType.
+const (
+	DocTypeFlareDoc   = "flare_doc"
+	DocTypeHistory    = "history"
+	DocTypeFolder     = "folder"
+	DocTypePostmortem = "postmortem"
+)
+
+// UpdateAppProperties sets appProperties on a file, leaving others alone.
+func (server *GoogleDocsServer) UpdateAppProperties(doc *Doc, properties map[string]string) error {
+	var file *drive.File
+	err := call("drive.files.update", func(ctx context.Context) (err error) {
+		file, err = server.service.Files.Update(doc.File.Id, &drive.File{AppProperties: properties}).
+			SupportsAllDrives(true).Fields(fileFields).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	doc.File.AppProperties = file.AppProperties
+	return nil
+}
+
+// FindDocs returns the files, in any drive flarebot can see, whose
+// appProperties include all of the given ones.
+func (server *GoogleDocsServer) FindDocs(properties map[string]string) ([]*Doc, error) {
+	docs := []*Doc{}
+	err := call("drive.files.list", func(ctx context.Context) error {
+		docs = docs[:0]
+		return server.service.Files.List().
+			Q(appPropertiesQuery(properties)).
+			Corpora("allDrives").IncludeItemsFromAllDrives(true).SupportsAllDrives(true).
+			OrderBy("createdTime desc").PageSize(100).
+			Fields(googleapi.Field(fmt.Sprintf("nextPageToken, files(%s)", fileFields))).
+			Pages(ctx, func(list *drive.FileList) error {
+				for _, file := range list.Files {
+					docs = append(docs, &Doc{File: file})
+				}
+				return nil
+			})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
+
+// FindFlareDocs returns every file flarebot created for a Flare.
+func FindFlareDocs(service GoogleDocsService, flareNumber string) ([]*Doc, error) {
+	return service.FindDocs(map[string]string{PropertyFlareNumber: flareNumber})
+}
+
+// ListFlaresByState returns the flare doc of every Flare in a state.
+func ListFlaresByState(service GoogleDocsService, state string) ([]*Doc, error) {
+	return service.FindDocs(map[string]string{PropertyDocType: DocTypeFlareDoc, PropertyState: state})
+}
+
+// appPropertiesQuery builds a Drive search query matching all properties.
+func appPropertiesQuery(properties map[string]string) string {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	clauses := []string{"trashed = false"}
+	for _, key := range keys {
+		clauses = append(clauses, fmt.Sprintf("appProperties has { key='%s' and value='%s' }", escapeQuery(key), escapeQuery(properties[key])))
+	}
+
+	return strings.Join(clauses, " and ")
+}
+
+func escapeQuery(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -0,0 +1,149 @@
+package googledocs
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// Kinds of Google API failure. Errors returned by GoogleDocsServer match one
+// of these with errors.Is when the cause is known.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrQuota            = errors.New("quota exceeded")
+	ErrUnavailable      = errors.New("service unavailable")
+)
+
+// Error is a failed Google API call.
+type Error struct {
+	Op   string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("%s: %s", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+const (
+	// callTimeout bounds each attempt at a Google call.
+	callTimeout = 30 * time.Second
+	// maxAttempts is how many times a retryable call is tried.
+	maxAttempts = 5
+)
+
+// initialBackoff doubles after every failed attempt. Tests shorten it.
+var initialBackoff = 500 * time.Millisecond
+
+// googleAPIMetrics counts calls, failures and cumulative latency per
+// operation, e.g. "drive.files.copy.calls", published through expvar.
+var googleAPIMetrics = expvar.NewMap("google_api")
+
+// call runs fn with a deadline, retrying with exponential backoff on rate
+// limits and server errors, and returns any failure as an *Error.
+func call(op string, fn func(ctx context.Context) error) error {
+	return retry(op, false, fn)
+}
+
+// callWrite is call for requests that aren't safe to repeat, like creating a
+// file or appending a row: only rate-limited attempts, which Google rejected
+// without doing anything, are retried.
+func callWrite(op string, fn func(ctx context.Context) error) error {
+	return retry(op, true, fn)
+}
+
+func retry(op string, onlyQuota bool, fn func(ctx context.Context) error) error {
+	backoff := initialBackoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+		start := time.Now()
+		err = fn(ctx)
+		cancel()
+
+		googleAPIMetrics.Add(op+".calls", 1)
+		googleAPIMetrics.Add(op+".latency_ms", time.Since(start).Milliseconds())
+		if err == nil {
+			return nil
+		}
+		googleAPIMetrics.Add(op+".failures", 1)
+
+		kind, retryable := classify(err)
+		if onlyQuota && kind != ErrQuota {
+			retryable = false
+		}
+		if !retryable || attempt == maxAttempts {
+			return &Error{Op: op, Kind: kind, Err: err}
+		}
+
+		// jitter keeps concurrent retries from lining up
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2))
+		log.Printf("google call %s failed (attempt %d/%d), retrying in %s: %s", op, attempt, maxAttempts, wait, err)
+		googleAPIMetrics.Add(op+".retries", 1)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+
+	return &Error{Op: op, Err: err}
+}
+
+// classify returns the kind of a Google API error and whether it's worth
+// retrying.
+func classify(err error) (error, bool) {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusNotFound:
+			return ErrNotFound, false
+		case apiErr.Code == http.StatusTooManyRequests:
+			return ErrQuota, true
+		case apiErr.Code == http.StatusForbidden && isRateLimitReason(apiErr):
+			return ErrQuota, true
+		case apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden:
+			return ErrPermissionDenied, false
+		case apiErr.Code >= 500:
+			return ErrUnavailable, true
+		}
+		return nil, false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrUnavailable, true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrUnavailable, true
+	}
+
+	return nil, false
+}
+
+func isRateLimitReason(apiErr *googleapi.Error) bool {
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded", "dailyLimitExceeded":
+			return true
+		}
+	}
+	return false
+}
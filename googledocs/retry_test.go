@@ -0,0 +1,120 @@
+package googledocs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func apiError(code int, reasons ...string) error {
+	apiErr := &googleapi.Error{Code: code, Message: http.StatusText(code)}
+	for _, reason := range reasons {
+		apiErr.Errors = append(apiErr.Errors, googleapi.ErrorItem{Reason: reason})
+	}
+	return apiErr
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      error
+		retryable bool
+	}{
+		{"not found", apiError(http.StatusNotFound), ErrNotFound, false},
+		{"too many requests", apiError(http.StatusTooManyRequests), ErrQuota, true},
+		{"rate limit reason", apiError(http.StatusForbidden, "userRateLimitExceeded"), ErrQuota, true},
+		{"daily limit reason", apiError(http.StatusForbidden, "dailyLimitExceeded"), ErrQuota, true},
+		{"forbidden", apiError(http.StatusForbidden, "insufficientFilePermissions"), ErrPermissionDenied, false},
+		{"unauthorized", apiError(http.StatusUnauthorized), ErrPermissionDenied, false},
+		{"server error", apiError(http.StatusInternalServerError), ErrUnavailable, true},
+		{"unavailable", apiError(http.StatusServiceUnavailable), ErrUnavailable, true},
+		{"bad request", apiError(http.StatusBadRequest), nil, false},
+		{"deadline", fmt.Errorf("copying: %w", context.DeadlineExceeded), ErrUnavailable, true},
+		{"network timeout", fmt.Errorf("dialing: %w", timeoutError{}), ErrUnavailable, true},
+		{"other", errors.New("boom"), nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind, retryable := classify(test.err)
+			if kind != test.kind || retryable != test.retryable {
+				t.Errorf("got %v, retryable %t, want %v, retryable %t", kind, retryable, test.kind, test.retryable)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	backoff := initialBackoff
+	initialBackoff = time.Millisecond
+	t.Cleanup(func() { initialBackoff = backoff })
+
+	tests := []struct {
+		name     string
+		write    bool
+		errs     []error
+		attempts int
+		kind     error
+	}{
+		{"ok", false, nil, 1, nil},
+		{"rate limited", false, []error{apiError(http.StatusForbidden, "rateLimitExceeded")}, 2, nil},
+		{"server error", false, []error{apiError(http.StatusBadGateway), apiError(http.StatusServiceUnavailable)}, 3, nil},
+		{"timeout", false, []error{context.DeadlineExceeded}, 2, nil},
+		{"down", false, []error{
+			apiError(http.StatusInternalServerError), apiError(http.StatusInternalServerError), apiError(http.StatusInternalServerError),
+			apiError(http.StatusInternalServerError), apiError(http.StatusInternalServerError),
+		}, maxAttempts, ErrUnavailable},
+		{"not found", false, []error{apiError(http.StatusNotFound)}, 1, ErrNotFound},
+		{"write rate limited", true, []error{apiError(http.StatusTooManyRequests)}, 2, nil},
+		{"write server error", true, []error{apiError(http.StatusInternalServerError)}, 1, ErrUnavailable},
+		{"write timeout", true, []error{context.DeadlineExceeded}, 1, ErrUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			fn := func(ctx context.Context) error {
+				attempts++
+				if _, ok := ctx.Deadline(); !ok {
+					t.Error("called without a deadline")
+				}
+				if attempts <= len(test.errs) {
+					return test.errs[attempts-1]
+				}
+				return nil
+			}
+
+			var err error
+			if test.write {
+				err = callWrite("test.op", fn)
+			} else {
+				err = call("test.op", fn)
+			}
+
+			if attempts != test.attempts {
+				t.Errorf("tried %d times, want %d", attempts, test.attempts)
+			}
+			if test.kind == nil {
+				if err != nil {
+					t.Errorf("got %v, want success", err)
+				}
+				return
+			}
+			var googleErr *Error
+			if !errors.As(err, &googleErr) || googleErr.Op != "test.op" || !errors.Is(err, test.kind) {
+				t.Errorf("got %v, want a test.op %v", err, test.kind)
+			}
+		})
+	}
+}
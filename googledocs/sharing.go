@@ -0,0 +1,91 @@
+package googledocs
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/api/drive/v3"
+)
+
+// Permission is someone's access to a file. Value is the email address for
+// user and group permissions and the domain name for domain permissions.
+type Permission struct {
+	ID    string
+	Type  string
+	Value string
+	Role  string
+	// Inherited permissions come from a parent folder or shared drive and
+	// can only be changed there.
+	Inherited bool
+}
+
+// ListPermissions returns every permission on a file.
+func (server *GoogleDocsServer) ListPermissions(doc *Doc) ([]*Permission, error) {
+	permissions := []*Permission{}
+	err := call("drive.permissions.list", func(ctx context.Context) error {
+		permissions = permissions[:0]
+		return server.service.Permissions.List(doc.File.Id).SupportsAllDrives(true).
+			Fields("nextPageToken, permissions(id, type, role, domain, emailAddress, permissionDetails)").
+			Pages(ctx, func(list *drive.PermissionList) error {
+				for _, perm := range list.Permissions {
+					permissions = append(permissions, toPermission(perm))
+				}
+				return nil
+			})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func toPermission(perm *drive.Permission) *Permission {
+	p := &Permission{ID: perm.Id, Type: perm.Type, Value: perm.EmailAddress, Role: perm.Role}
+	if perm.Type == "domain" {
+		p.Value = perm.Domain
+	}
+
+	// on shared drives a permission may be both direct and inherited
+	p.Inherited = len(perm.PermissionDetails) > 0
+	for _, detail := range perm.PermissionDetails {
+		if !detail.Inherited {
+			p.Inherited = false
+		}
+	}
+
+	return p
+}
+
+// SharePermission grants a user, group or domain a role on a file without
+// sending a notification email.
+func (server *GoogleDocsServer) SharePermission(doc *Doc, permissionType string, value string, permissionRole string) error {
+	newPermission := &drive.Permission{Type: permissionType, Role: permissionRole}
+	if permissionType == "domain" {
+		newPermission.Domain = value
+	} else {
+		newPermission.EmailAddress = value
+	}
+
+	return callWrite("drive.permissions.create", func(ctx context.Context) error {
+		create := server.service.Permissions.Create(doc.File.Id, newPermission).SupportsAllDrives(true)
+		if permissionType != "domain" {
+			create = create.SendNotificationEmail(false)
+		}
+		_, err := create.Context(ctx).Do()
+		return err
+	})
+}
+
+// UpdatePermission changes the role of an existing permission.
+func (server *GoogleDocsServer) UpdatePermission(doc *Doc, permissionID string, permissionRole string) error {
+	return call("drive.permissions.update", func(ctx context.Context) error {
+		_, err := server.service.Permissions.Update(doc.File.Id, permissionID, &drive.Permission{Role: permissionRole}).SupportsAllDrives(true).Context(ctx).Do()
+		return err
+	})
+}
+
+// DeletePermission revokes a permission.
+func (server *GoogleDocsServer) DeletePermission(doc *Doc, permissionID string) error {
+	return call("drive.permissions.delete", func(ctx context.Context) error {
+		return server.service.Permissions.Delete(doc.File.Id, permissionID).SupportsAllDrives(true).Context(ctx).Do()
+	})
+}
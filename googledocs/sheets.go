@@ -0,0 +1,200 @@
+package googledocs
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/sheets/v4"
+)
+
+// SheetTab is the layout of a spreadsheet tab flarebot writes rows to.
+type SheetTab struct {
+	// Name is the tab's title. "" is the spreadsheet's first tab.
+	Name   string
+	Header []string
+	// ColumnWidths are in pixels, by column. Zero leaves a column alone.
+	ColumnWidths []int64
+	// TimestampColumns are formatted with TimestampFormat, a Sheets date-time
+	// pattern such as "yyyy-mm-dd hh:mm:ss".
+	TimestampColumns []int
+	TimestampFormat  string
+}
+
+// sheetRange is the A1 range covering a whole tab. Without a tab name Sheets
+// uses the first tab.
+func sheetRange(tab string) string {
+	if tab == "" {
+		return "A:ZZ"
+	}
+	return "'" + strings.Replace(tab, "'", "''", -1) + "'"
+}
+
+func (server *GoogleDocsServer) getSheets(doc *Doc) ([]*sheets.Sheet, error) {
+	var spreadsheet *sheets.Spreadsheet
+	err := call("sheets.spreadsheets.get", func(ctx context.Context) (err error) {
+		spreadsheet, err = server.sheetService.Spreadsheets.Get(doc.File.Id).Fields("sheets.properties").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spreadsheet.Sheets, nil
+}
+
+// GetSheetTabs returns the titles of a spreadsheet's tabs, in order.
+func (server *GoogleDocsServer) GetSheetTabs(doc *Doc) ([]string, error) {
+	all, err := server.getSheets(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	tabs := make([]string, 0, len(all))
+	for _, sheet := range all {
+		tabs = append(tabs, sheet.Properties.Title)
+	}
+	return tabs, nil
+}
+
+// EnsureSheetTab creates a tab with the given layout if the spreadsheet
+// doesn't have it yet. A tab that exists without the header, like the first
+// tab of a copied template, gets the header and formatting added.
+func (server *GoogleDocsServer) EnsureSheetTab(doc *Doc, tab *SheetTab) error {
+	all, err := server.getSheets(doc)
+	if err != nil {
+		return err
+	}
+
+	var properties *sheets.SheetProperties
+	for _, sheet := range all {
+		if sheet.Properties.Title == tab.Name || (tab.Name == "" && properties == nil) {
+			properties = sheet.Properties
+		}
+	}
+
+	requests := []*sheets.Request{}
+	if properties == nil {
+		var response *sheets.BatchUpdateSpreadsheetResponse
+		err = callWrite("sheets.spreadsheets.batchUpdate", func(ctx context.Context) (err error) {
+			response, err = server.sheetService.Spreadsheets.BatchUpdate(doc.File.Id, &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: []*sheets.Request{{AddSheet: &sheets.AddSheetRequest{
+					Properties: &sheets.SheetProperties{Title: tab.Name},
+				}}},
+			}).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		properties = response.Replies[0].AddSheet.Properties
+	} else {
+		var firstRow *sheets.ValueRange
+		err = call("sheets.values.get", func(ctx context.Context) (err error) {
+			firstRow, err = server.sheetService.Spreadsheets.Values.Get(doc.File.Id, sheetRange(properties.Title)+"!1:1").Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(firstRow.Values) > 0 {
+			if isHeader(firstRow.Values[0], tab.Header) {
+				return nil
+			}
+			// rows written before the tab had a header move down
+			requests = append(requests, &sheets.Request{InsertDimension: &sheets.InsertDimensionRequest{
+				Range: &sheets.DimensionRange{SheetId: properties.SheetId, Dimension: "ROWS", StartIndex: 0, EndIndex: 1, ForceSendFields: []string{"SheetId", "StartIndex"}},
+			}})
+		}
+	}
+
+	return server.formatSheetTab(doc, properties.SheetId, tab, requests)
+}
+
+func isHeader(row []interface{}, header []string) bool {
+	if len(row) < len(header) {
+		return false
+	}
+	for i, title := range header {
+		if fmt.Sprint(row[i]) != title {
+			return false
+		}
+	}
+	return true
+}
+
+// formatSheetTab writes the header row and applies the tab's formatting, after
+// running requests.
+func (server *GoogleDocsServer) formatSheetTab(doc *Doc, sheetID int64, tab *SheetTab, requests []*sheets.Request) error {
+	header := make([]*sheets.CellData, 0, len(tab.Header))
+	for _, title := range tab.Header {
+		title := title
+		header = append(header, &sheets.CellData{
+			UserEnteredValue:  &sheets.ExtendedValue{StringValue: &title},
+			UserEnteredFormat: &sheets.CellFormat{TextFormat: &sheets.TextFormat{Bold: true}},
+		})
+	}
+	requests = append(requests,
+		&sheets.Request{UpdateCells: &sheets.UpdateCellsRequest{
+			Start:  &sheets.GridCoordinate{SheetId: sheetID, ForceSendFields: []string{"SheetId"}},
+			Rows:   []*sheets.RowData{{Values: header}},
+			Fields: "userEnteredValue,userEnteredFormat.textFormat.bold",
+		}},
+		&sheets.Request{UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+			Properties: &sheets.SheetProperties{
+				SheetId:         sheetID,
+				GridProperties:  &sheets.GridProperties{FrozenRowCount: 1},
+				ForceSendFields: []string{"SheetId"},
+			},
+			Fields: "gridProperties.frozenRowCount",
+		}},
+	)
+	for column, width := range tab.ColumnWidths {
+		if width == 0 {
+			continue
+		}
+		requests = append(requests, &sheets.Request{UpdateDimensionProperties: &sheets.UpdateDimensionPropertiesRequest{
+			Range:      &sheets.DimensionRange{SheetId: sheetID, Dimension: "COLUMNS", StartIndex: int64(column), EndIndex: int64(column) + 1, ForceSendFields: []string{"SheetId", "StartIndex"}},
+			Properties: &sheets.DimensionProperties{PixelSize: width},
+			Fields:     "pixelSize",
+		}})
+	}
+	for _, column := range tab.TimestampColumns {
+		requests = append(requests, &sheets.Request{RepeatCell: &sheets.RepeatCellRequest{
+			Range: &sheets.GridRange{SheetId: sheetID, StartRowIndex: 1, StartColumnIndex: int64(column), EndColumnIndex: int64(column) + 1, ForceSendFields: []string{"SheetId", "StartColumnIndex"}},
+			Cell: &sheets.CellData{UserEnteredFormat: &sheets.CellFormat{
+				NumberFormat: &sheets.NumberFormat{Type: "DATE_TIME", Pattern: tab.TimestampFormat},
+			}},
+			Fields: "userEnteredFormat.numberFormat",
+		}})
+	}
+
+	return callWrite("sheets.spreadsheets.batchUpdate", func(ctx context.Context) error {
+		_, err := server.sheetService.Spreadsheets.BatchUpdate(doc.File.Id, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Context(ctx).Do()
+		return err
+	})
+}
+
+// GetSheetContent returns every row of a tab, "" being the first tab.
+func (server *GoogleDocsServer) GetSheetContent(doc *Doc, tab string) (*sheets.ValueRange, error) {
+	var content *sheets.ValueRange
+	err := call("sheets.values.get", func(ctx context.Context) (err error) {
+		content, err = server.sheetService.Spreadsheets.Values.
+			Get(doc.File.Id, sheetRange(tab)).
+			ValueRenderOption("FORMATTED_VALUE").DateTimeRenderOption("SERIAL_NUMBER").
+			Context(ctx).Do()
+		return err
+	})
+	return content, err
+}
+
+// AppendSheetContent appends a new row to the end of a tab, "" being the first
+// tab.
+func (server *GoogleDocsServer) AppendSheetContent(doc *Doc, tab string, values []interface{}) error {
+	return callWrite("sheets.values.append", func(ctx context.Context) error {
+		_, err := server.sheetService.Spreadsheets.Values.
+			Append(doc.File.Id, sheetRange(tab), &sheets.ValueRange{MajorDimension: "ROWS", Values: [][]interface{}{values}}).
+			ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+		return err
+	})
+}
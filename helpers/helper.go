@@ -2,6 +2,8 @@ package helpers
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,10 +19,35 @@ func GetJakartaDateAndTime() (string, error) {
 }
 
 func UnixToJakartaTime(unixTimestamp int64) time.Time {
+	return time.Unix(unixTimestamp, 0).In(JakartaLocation())
+}
+
+// JakartaLocation returns the Asia/Jakarta time zone.
+func JakartaLocation() *time.Location {
 	location, err := time.LoadLocation("Asia/Jakarta")
 	if err != nil {
 		panic(err)
 	}
 
-	return time.Unix(unixTimestamp, 0).In(location)
+	return location
+}
+
+// SlackTimestampToJakartaTime converts a Slack message ts ("1697712345.123456")
+// to a time in Jakarta, keeping the sub-second part.
+func SlackTimestampToJakartaTime(ts string) (time.Time, error) {
+	seconds, fraction, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var usec int64
+	if fraction != "" {
+		usec, err = strconv.ParseInt((fraction + "000000")[:6], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return UnixToJakartaTime(sec).Add(time.Duration(usec) * time.Microsecond), nil
 }
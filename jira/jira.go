@@ -0,0 +1,326 @@
+// Package jira files and updates Flare tickets through the JIRA REST API.
+package jira
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds each call to JIRA.
+const requestTimeout = 30 * time.Second
+
+// ErrNotFound is returned when JIRA has no such issue, user or transition.
+var ErrNotFound = errors.New("not found")
+
+// Config is how flarebot reaches JIRA and files tickets there.
+type Config struct {
+	// Origin is where JIRA lives, e.g. https://example.atlassian.net.
+	Origin   string
+	Username string
+	// Password is the user's password, or an API token on JIRA Cloud.
+	Password    string
+	ProjectID   string
+	IssueTypeID string
+	// Priorities are the JIRA priority IDs for P0, P1 and P2, in that order.
+	Priorities []string
+	// Transitions name the workflow transition to run when a Flare reaches a
+	// state, keyed by state: mitigated, resolved or not_a_flare.
+	Transitions map[string]string
+}
+
+// ConfigFromEnv reads the JIRA_* configuration. It returns nil if JIRA_ORIGIN
+// isn't set, meaning JIRA isn't used.
+func ConfigFromEnv() (*Config, error) {
+	origin := os.Getenv("JIRA_ORIGIN")
+	if origin == "" {
+		return nil, nil
+	}
+
+	config := &Config{
+		Origin:      strings.TrimSuffix(origin, "/"),
+		Username:    os.Getenv("JIRA_USERNAME"),
+		Password:    os.Getenv("JIRA_PASSWORD"),
+		ProjectID:   os.Getenv("JIRA_PROJECT_ID"),
+		IssueTypeID: os.Getenv("JIRA_ISSUETYPE_ID"),
+		Transitions: map[string]string{
+			"mitigated":   os.Getenv("JIRA_MITIGATED_TRANSITION"),
+			"resolved":    os.Getenv("JIRA_RESOLVED_TRANSITION"),
+			"not_a_flare": os.Getenv("JIRA_NOT_A_FLARE_TRANSITION"),
+		},
+	}
+	if priorities := os.Getenv("JIRA_PRIORITIES"); priorities != "" {
+		for _, id := range strings.Split(priorities, ",") {
+			config.Priorities = append(config.Priorities, strings.TrimSpace(id))
+		}
+	}
+
+	if config.Username == "" || config.Password == "" {
+		return nil, errors.New("JIRA_USERNAME and JIRA_PASSWORD must be set when JIRA_ORIGIN is")
+	}
+	if config.ProjectID == "" || config.IssueTypeID == "" {
+		return nil, errors.New("JIRA_PROJECT_ID and JIRA_ISSUETYPE_ID must be set when JIRA_ORIGIN is")
+	}
+
+	return config, nil
+}
+
+// PriorityID returns the JIRA priority ID for a Flare priority like "P1", or
+// "" if none is configured.
+func (config *Config) PriorityID(priority string) string {
+	var n int
+	if _, err := fmt.Sscanf(strings.ToUpper(priority), "P%d", &n); err != nil || n < 0 || n >= len(config.Priorities) {
+		return ""
+	}
+	return config.Priorities[n]
+}
+
+// Client talks to JIRA.
+type Client struct {
+	Config     *Config
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the configured JIRA.
+func New(config *Config) *Client {
+	return &Client{Config: config, HTTPClient: &http.Client{Timeout: requestTimeout}}
+}
+
+// NewFromEnv returns a Client configured by the JIRA_* variables, or nil if
+// JIRA isn't configured.
+func NewFromEnv() (*Client, error) {
+	config, err := ConfigFromEnv()
+	if err != nil || config == nil {
+		return nil, err
+	}
+	return New(config), nil
+}
+
+// Error is a request JIRA rejected.
+type Error struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *Error) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("jira returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("jira returned %d: %s", e.StatusCode, strings.Join(e.Messages, "; "))
+}
+
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// do sends a request to the REST API and decodes the JSON response into out,
+// if it isn't nil.
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.Config.Origin+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Config.Username, c.Config.Password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		jiraErr := &Error{StatusCode: resp.StatusCode}
+		var details struct {
+			ErrorMessages []string          `json:"errorMessages"`
+			Errors        map[string]string `json:"errors"`
+		}
+		if json.Unmarshal(data, &details) == nil {
+			jiraErr.Messages = details.ErrorMessages
+			for field, message := range details.Errors {
+				jiraErr.Messages = append(jiraErr.Messages, fmt.Sprintf("%s: %s", field, message))
+			}
+		}
+		return jiraErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Issue is a JIRA issue.
+type Issue struct {
+	ID     string      `json:"id"`
+	Key    string      `json:"key"`
+	Fields IssueFields `json:"fields"`
+}
+
+// IssueFields are the issue fields flarebot cares about.
+type IssueFields struct {
+	Summary  string `json:"summary"`
+	Status   *Named `json:"status,omitempty"`
+	Priority *Named `json:"priority,omitempty"`
+	Assignee *User  `json:"assignee,omitempty"`
+}
+
+// Named is a JIRA object identified by ID with a display name, like a status
+// or priority.
+type Named struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// User is a JIRA user.
+type User struct {
+	AccountID    string `json:"accountId,omitempty"`
+	Name         string `json:"name,omitempty"`
+	DisplayName  string `json:"displayName,omitempty"`
+	EmailAddress string `json:"emailAddress,omitempty"`
+}
+
+// BrowseURL is the web link to an issue.
+func (c *Client) BrowseURL(key string) string {
+	return fmt.Sprintf("%s/browse/%s", c.Config.Origin, key)
+}
+
+// NewFlare describes the ticket filed for a new Flare.
+type NewFlare struct {
+	Summary     string
+	Description string
+	// Priority is the Flare priority, e.g. "P1".
+	Priority string
+	// AssigneeEmail is who the ticket is assigned to, usually the reporter.
+	// It's left unassigned if JIRA has no user with that email.
+	AssigneeEmail string
+}
+
+// CreateFlareIssue files a ticket for a Flare in the configured project.
+func (c *Client) CreateFlareIssue(flare *NewFlare) (*Issue, error) {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"id": c.Config.ProjectID},
+		"issuetype":   map[string]string{"id": c.Config.IssueTypeID},
+		"summary":     flare.Summary,
+		"description": flare.Description,
+	}
+	if id := c.Config.PriorityID(flare.Priority); id != "" {
+		fields["priority"] = map[string]string{"id": id}
+	}
+	if flare.AssigneeEmail != "" {
+		if user, err := c.FindUser(flare.AssigneeEmail); err == nil {
+			fields["assignee"] = user
+		}
+	}
+
+	issue := &Issue{}
+	if err := c.do(http.MethodPost, "/rest/api/2/issue", map[string]interface{}{"fields": fields}, issue); err != nil {
+		return nil, err
+	}
+	issue.Fields.Summary = flare.Summary
+
+	return issue, nil
+}
+
+// GetIssue looks up an issue by key, e.g. FLARE-179.
+func (c *Client) GetIssue(key string) (*Issue, error) {
+	issue := &Issue{}
+	path := fmt.Sprintf("/rest/api/2/issue/%s?fields=summary,status,priority,assignee", url.PathEscape(key))
+	if err := c.do(http.MethodGet, path, nil, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// FindUser looks up the JIRA user with an email address.
+func (c *Client) FindUser(email string) (*User, error) {
+	users := []*User{}
+	path := fmt.Sprintf("/rest/api/2/user/search?query=%s", url.QueryEscape(email))
+	if err := c.do(http.MethodGet, path, nil, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.EmailAddress == "" || strings.EqualFold(user.EmailAddress, email) {
+			// JIRA Cloud hides most emails; the search already matched it
+			return &User{AccountID: user.AccountID, Name: user.Name}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Transition is a workflow step an issue can take.
+type Transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   *Named `json:"to,omitempty"`
+}
+
+// Transitions lists the workflow steps an issue can take from its status.
+func (c *Client) Transitions(key string) ([]*Transition, error) {
+	var response struct {
+		Transitions []*Transition `json:"transitions"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/rest/api/2/issue/%s/transitions", url.PathEscape(key)), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Transitions, nil
+}
+
+// Transition moves an issue along the transition with the given name or ID.
+func (c *Client) Transition(key string, transition string) error {
+	transitions, err := c.Transitions(key)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range transitions {
+		if t.ID == transition || strings.EqualFold(t.Name, transition) {
+			body := map[string]interface{}{"transition": map[string]string{"id": t.ID}}
+			return c.do(http.MethodPost, fmt.Sprintf("/rest/api/2/issue/%s/transitions", url.PathEscape(key)), body, nil)
+		}
+	}
+
+	return fmt.Errorf("transition %s isn't available for %s: %w", transition, key, ErrNotFound)
+}
+
+// Comment adds a comment to an issue.
+func (c *Client) Comment(key string, body string) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/rest/api/2/issue/%s/comment", url.PathEscape(key)), map[string]string{"body": body}, nil)
+}
+
+// FlareStateChanged comments on a Flare's ticket and, if a transition is
+// configured for the new state, moves the ticket along it.
+func (c *Client) FlareStateChanged(key string, state string, comment string) error {
+	if err := c.Comment(key, comment); err != nil {
+		return err
+	}
+
+	if transition := c.Config.Transitions[state]; transition != "" {
+		return c.Transition(key, transition)
+	}
+	return nil
+}
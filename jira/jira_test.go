@@ -0,0 +1,183 @@
+package jira
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// request is a request the test server received.
+type request struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// newTestClient returns a Client for a server answering with handle, and the
+// requests it received.
+func newTestClient(t *testing.T, handle func(w http.ResponseWriter, r *http.Request)) (*Client, *[]request) {
+	t.Helper()
+	requests := []request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "flarebot" || password != "token" {
+			t.Errorf("%s %s wasn't authenticated", r.Method, r.URL)
+		}
+		received := request{Method: r.Method, Path: r.URL.RequestURI()}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &received.Body); err != nil {
+				t.Errorf("%s %s sent %q: %s", r.Method, r.URL, data, err)
+			}
+		}
+		requests = append(requests, received)
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(&Config{
+		Origin:      server.URL,
+		Username:    "flarebot",
+		Password:    "token",
+		ProjectID:   "10000",
+		IssueTypeID: "10001",
+		Priorities:  []string{"1", "2", "3"},
+	}), &requests
+}
+
+func TestCreateFlareIssue(t *testing.T) {
+	tests := []struct {
+		name     string
+		users    string
+		assignee interface{}
+	}{
+		{"assigned", `[{"accountId": "abc123", "emailAddress": "Ada@example.com"}]`, map[string]interface{}{"accountId": "abc123"}},
+		{"hidden email", `[{"accountId": "abc123"}]`, map[string]interface{}{"accountId": "abc123"}},
+		{"someone else", `[{"accountId": "def456", "emailAddress": "grace@example.com"}]`, nil},
+		{"no user", `[]`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/rest/api/2/user/search":
+					io.WriteString(w, test.users)
+				case "/rest/api/2/issue":
+					w.WriteHeader(http.StatusCreated)
+					io.WriteString(w, `{"id": "10100", "key": "FLARE-7"}`)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			issue, err := client.CreateFlareIssue(&NewFlare{Summary: "checkout is down", Description: "flare-7", Priority: "P1", AssigneeEmail: "ada@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if issue.Key != "FLARE-7" || issue.Fields.Summary != "checkout is down" {
+				t.Errorf("created %+v", issue)
+			}
+
+			if len(*requests) != 2 || (*requests)[0].Path != "/rest/api/2/user/search?query=ada%40example.com" {
+				t.Fatalf("requests %+v", *requests)
+			}
+			created := (*requests)[1]
+			want := map[string]interface{}{
+				"project":     map[string]interface{}{"id": "10000"},
+				"issuetype":   map[string]interface{}{"id": "10001"},
+				"summary":     "checkout is down",
+				"description": "flare-7",
+				"priority":    map[string]interface{}{"id": "2"},
+			}
+			if test.assignee != nil {
+				want["assignee"] = test.assignee
+			}
+			if created.Method != http.MethodPost || !reflect.DeepEqual(created.Body, map[string]interface{}{"fields": want}) {
+				t.Errorf("%s with %v, want fields %v", created.Method, created.Body, want)
+			}
+		})
+	}
+}
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		name       string
+		transition string
+		id         string
+	}{
+		{"by name", "mitigate", "21"},
+		{"by ID", "31", "31"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					io.WriteString(w, `{"transitions": [{"id": "21", "name": "Mitigate"}, {"id": "31", "name": "Resolve"}]}`)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			if err := client.Transition("FLARE-7", test.transition); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []request{
+				{Method: http.MethodGet, Path: "/rest/api/2/issue/FLARE-7/transitions"},
+				{Method: http.MethodPost, Path: "/rest/api/2/issue/FLARE-7/transitions", Body: map[string]interface{}{"transition": map[string]interface{}{"id": test.id}}},
+			}
+			if !reflect.DeepEqual(*requests, want) {
+				t.Errorf("requests %+v, want %+v", *requests, want)
+			}
+		})
+	}
+
+	t.Run("unavailable", func(t *testing.T) {
+		client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"transitions": [{"id": "21", "name": "Mitigate"}]}`)
+		})
+
+		if err := client.Transition("FLARE-7", "Resolve"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+		if len(*requests) != 1 {
+			t.Errorf("requests %+v, want only the lookup", *requests)
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		message  string
+		notFound bool
+	}{
+		{"messages", http.StatusNotFound, `{"errorMessages": ["Issue does not exist"]}`, "jira returned 404: Issue does not exist", true},
+		{"field errors", http.StatusBadRequest, `{"errorMessages": [], "errors": {"summary": "Summary is required"}}`, "jira returned 400: summary: Summary is required", false},
+		{"no details", http.StatusBadGateway, `<html>Bad Gateway</html>`, "jira returned 502", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				io.WriteString(w, test.body)
+			})
+
+			_, err := client.GetIssue("FLARE-7")
+			var jiraErr *Error
+			if !errors.As(err, &jiraErr) || jiraErr.StatusCode != test.status {
+				t.Fatalf("got %v, want a %d", err, test.status)
+			}
+			if err.Error() != test.message {
+				t.Errorf("got %q, want %q", err.Error(), test.message)
+			}
+			if errors.Is(err, ErrNotFound) != test.notFound {
+				t.Errorf("errors.Is(ErrNotFound) = %t, want %t", !test.notFound, test.notFound)
+			}
+		})
+	}
+}
@@ -1,14 +1,30 @@
 package main
 
 import (
+	"errors"
+	"expvar"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 	"regexp"
 
 	"github.com/joho/godotenv"
+	"github.com/modern-pet/flarebot/alertmanager"
+	"github.com/modern-pet/flarebot/api"
 	"github.com/modern-pet/flarebot/aws"
+	"github.com/modern-pet/flarebot/email"
+	"github.com/modern-pet/flarebot/flare"
 	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/jira"
+	"github.com/modern-pet/flarebot/mattermost"
+	"github.com/modern-pet/flarebot/pager"
+	"github.com/modern-pet/flarebot/redact"
+	"github.com/modern-pet/flarebot/resources"
+	"github.com/modern-pet/flarebot/sharing"
 	"github.com/modern-pet/flarebot/slack"
+	"github.com/modern-pet/flarebot/statuspage"
+	"github.com/modern-pet/flarebot/webhooks"
 )
 
 // #flare-179-foo-bar --> #flare-179
@@ -21,30 +37,209 @@ var slackHistoryDocCache = map[string]string{}
 func main() {
 	godotenv.Load()
 
+	var err error
+
 	flareChannelNamePrefix = regexp.MustCompile("flare-")
 
 	googleDocsServerConfig := os.Getenv("GOOGLE_FLAREBOT_SERVICE_ACCOUNT_CONF")
-	googleDomain := os.Getenv("GOOGLE_DOMAIN")
-	googleFlareDocID := os.Getenv("GOOGLE_TEMPLATE_DOC_ID")
-	googleSlackHistoryDocID := os.Getenv("GOOGLE_TEMPLATE_SLACK_HISTORY_DOC_ID")
 	username := os.Getenv("SLACK_USERNAME")
-	expectedChannel := os.Getenv("SLACK_CHANNEL")
+	config := flare.ConfigFromEnv()
 
 	// Google Docs service
-	googleDocsServer, err := googledocs.NewGoogleDocsServerWithServiceAccount(googleDocsServerConfig)
-	if err != nil {
-		panic(fmt.Errorf("Failed to initialize google docs server with error: %s", err))
+	var googleDocsServer googledocs.GoogleDocsService
+	if os.Getenv("GOOGLE_DRY_RUN") == "true" {
+		// keep documents in memory, for running locally without Google
+		log.Printf("GOOGLE_DRY_RUN is set, flare documents will only be kept in memory")
+		googleDocsServer = googledocs.NewFakeGoogleDocsServer()
+	} else {
+		googleDocsServer, err = googledocs.NewGoogleDocsServerWithServiceAccount(googleDocsServerConfig)
+		if err != nil {
+			panic(fmt.Errorf("Failed to initialize google docs server with error: %s", err))
+		}
 	}
 	// AWS Client to keep track of flare channel IDs
 	if err = aws.InitializeAWSClient(); err != nil {
 		panic(fmt.Errorf("Failed to initialize aws client with error: %s", err))
 	}
+	config.Counter = aws.S3Counter{}
+
+	// Secrets are scrubbed from anything written to Google
+	config.Redactor, err = redact.NewFromConfig(os.Getenv("REDACTION_DETECTORS"), os.Getenv("REDACTION_CUSTOM_PATTERNS"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize redaction with error: %s", err))
+	}
+
+	// Who can open the documents created for each Flare
+	config.SharingPolicies, err = sharing.NewFromConfig(os.Getenv("SHARING_POLICIES"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize sharing policies with error: %s", err))
+	}
+
+	// What's posted in a new Flare channel to help handle it
+	resourceSets, err := resources.NewFromConfig(os.Getenv("FLARE_RESOURCES"), os.Getenv("FLARE_RESOURCES_URL"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize flare resources with error: %s", err))
+	}
+
+	// JIRA tickets for each Flare, if configured
+	config.Jira, err = jira.NewFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize jira client with error: %s", err))
+	}
+
+	// Public incidents on the status page, if configured
+	config.StatusPage, err = statuspage.NewFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize status page client with error: %s", err))
+	}
+
+	// Paging for big Flares, if configured
+	config.Pager, err = pager.NewFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize pager with error: %s", err))
+	}
+
+	// Events for other tools that react to Flares, if configured
+	webhookDispatcher, err := webhooks.NewFromConfig(os.Getenv("WEBHOOKS"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize webhooks with error: %s", err))
+	}
+	config.Webhooks = webhookDispatcher
+	expvar.Publish("webhook_deliveries", expvar.Func(func() interface{} { return webhookDispatcher.Deliveries() }))
+
+	// Email to stakeholders about big Flares, if configured
+	config.Email, err = email.NewFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize email with error: %s", err))
+	}
+
+	// Which Alertmanager alerts become Flares
+	alertRules, err := alertmanager.NewRulesFromConfig(os.Getenv("ALERT_RULES"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize alert rules with error: %s", err))
+	}
+	// anyone who can reach the receiver could otherwise fire Flares, page, or
+	// make Flarebot search Drive
+	if len(alertRules) > 0 && os.Getenv("ALERTMANAGER_TOKEN") == "" {
+		panic(errors.New("ALERTMANAGER_TOKEN must be set when there are alert rules"))
+	}
+
+	// Metrics for whoever runs Flarebot, with or without the API
+	serveDebug(webhookDispatcher)
+
+	// Mattermost instead of Slack, for teams on self-hosted chat
+	if os.Getenv("CHAT_PLATFORM") == "mattermost" {
+		// alerts are handled by the Slack client, so rules would never be applied
+		if len(alertRules) > 0 {
+			panic(errors.New("ALERT_RULES can't be used when CHAT_PLATFORM is mattermost"))
+		}
+		runMattermost(config, googleDocsServer)
+		return
+	}
 
 	// Instantiate slack socket mode client
-	slackClient, err := slack.NewSlackClient(username, expectedChannel, googleDocsServer, googleDomain, googleFlareDocID, googleSlackHistoryDocID)
+	platform, err := slack.NewPlatformFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	service := flare.New(platform, googleDocsServer, config)
+	slackClient, err := slack.NewSlackClient(username, platform, service, resourceSets, alertRules)
 	if err != nil {
 		panic(err)
 	}
 
+	// documents shared under an older policy are brought up to date
+	go service.ReapplySharingPolicies()
+
+	// HTTP API for tools outside Slack, if there are API tokens
+	apiServer, err := api.NewFromConfig(service, os.Getenv("API_TOKENS"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize the API with error: %s", err))
+	}
+
+	// HTTP server for Alertmanager and the API, if either is configured
+	mux := http.NewServeMux()
+	if len(alertRules) > 0 {
+		mux.Handle("/alertmanager", alertmanager.Handler(os.Getenv("ALERTMANAGER_TOKEN"), slackClient.HandleAlerts))
+	}
+	if apiServer != nil {
+		apiServer.Register(mux)
+		mux.Handle("/debug/vars", apiServer.Authenticate(expvar.Handler()))
+	}
+	if len(alertRules) > 0 || apiServer != nil {
+		addr := httpAddr()
+		log.Printf("Listening for HTTP requests on %s", addr)
+		go func() {
+			panic(fmt.Errorf("HTTP server failed with error: %s", http.ListenAndServe(addr, mux)))
+		}()
+	}
+
 	panic(slackClient.Client.Run())
 }
+
+// runMattermost runs the Flare workflow on Mattermost. Flares are fired and
+// moved along through the HTTP API, since chat commands are Slack only.
+func runMattermost(config *flare.Config, googleDocsServer googledocs.GoogleDocsService) {
+	mattermostClient, err := mattermost.NewFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize mattermost client with error: %s", err))
+	}
+	if mattermostClient == nil {
+		panic(errors.New("MATTERMOST_URL must be set when CHAT_PLATFORM is mattermost"))
+	}
+	config.FlaresChannel = os.Getenv("MATTERMOST_CHANNEL_ID")
+	if config.FlaresChannel == "" {
+		panic(errors.New("MATTERMOST_CHANNEL_ID must be set when CHAT_PLATFORM is mattermost"))
+	}
+
+	service := flare.New(mattermostClient, googleDocsServer, config)
+
+	apiServer, err := api.NewFromConfig(service, os.Getenv("API_TOKENS"))
+	if err != nil {
+		panic(fmt.Errorf("Failed to initialize the API with error: %s", err))
+	}
+	if apiServer == nil {
+		panic(errors.New("API_TOKENS must be set when CHAT_PLATFORM is mattermost"))
+	}
+
+	// documents shared under an older policy are brought up to date
+	go service.ReapplySharingPolicies()
+
+	mux := http.NewServeMux()
+	apiServer.Register(mux)
+	mux.Handle("/debug/vars", apiServer.Authenticate(expvar.Handler()))
+
+	addr := httpAddr()
+	log.Printf("Running Flares on Mattermost, listening for HTTP requests on %s", addr)
+	panic(fmt.Errorf("HTTP server failed with error: %s", http.ListenAndServe(addr, mux)))
+}
+
+// serveDebug serves Flarebot's metrics and the webhook delivery log on
+// DEBUG_ADDR, if it's set. Nothing there is authenticated, so it should only be
+// reachable from inside the deployment, e.g. localhost:6060.
+func serveDebug(webhookDispatcher *webhooks.Dispatcher) {
+	addr := os.Getenv("DEBUG_ADDR")
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/webhooks", webhookDispatcher.ServeDeliveries)
+	log.Printf("Serving metrics on %s", addr)
+	go func() {
+		panic(fmt.Errorf("Debug server failed with error: %s", http.ListenAndServe(addr, mux)))
+	}()
+}
+
+// httpAddr is where the HTTP server listens: HTTP_ADDR, or PORT on all
+// interfaces, or port 8080.
+func httpAddr() string {
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		return addr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
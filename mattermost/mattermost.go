@@ -0,0 +1,354 @@
+// Package mattermost runs the Flare workflow on Mattermost, for teams on
+// self-hosted chat, through the Mattermost REST API.
+package mattermost
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modern-pet/flarebot/flare"
+)
+
+// requestTimeout bounds each call to Mattermost.
+const requestTimeout = 30 * time.Second
+
+// membersPageSize is how many channel members are listed per request, the
+// most Mattermost allows.
+const membersPageSize = 200
+
+// Config is how flarebot reaches Mattermost.
+type Config struct {
+	// URL is where Mattermost lives, e.g. https://chat.example.com.
+	URL string
+	// Token is the bot account's access token.
+	Token string
+	// TeamID is the team Flare channels are created in.
+	TeamID string
+}
+
+// ConfigFromEnv reads the MATTERMOST_* configuration. It returns nil if
+// MATTERMOST_URL isn't set, meaning Mattermost isn't used.
+func ConfigFromEnv() (*Config, error) {
+	origin := os.Getenv("MATTERMOST_URL")
+	if origin == "" {
+		return nil, nil
+	}
+
+	config := &Config{
+		URL:    strings.TrimSuffix(origin, "/"),
+		Token:  os.Getenv("MATTERMOST_TOKEN"),
+		TeamID: os.Getenv("MATTERMOST_TEAM_ID"),
+	}
+	if config.Token == "" || config.TeamID == "" {
+		return nil, errors.New("MATTERMOST_TOKEN and MATTERMOST_TEAM_ID must be set when MATTERMOST_URL is")
+	}
+
+	return config, nil
+}
+
+// Client is Mattermost as a flare.ChatPlatform.
+type Client struct {
+	Config     *Config
+	HTTPClient *http.Client
+
+	// Links and mentions need names where flarebot has IDs, so the names
+	// are kept once looked up.
+	namesMu      sync.Mutex
+	teamName     string
+	channelNames map[string]string
+	userNames    map[string]string
+}
+
+// New returns a Client for the configured Mattermost.
+func New(config *Config) *Client {
+	return &Client{
+		Config:       config,
+		HTTPClient:   &http.Client{Timeout: requestTimeout},
+		channelNames: map[string]string{},
+		userNames:    map[string]string{},
+	}
+}
+
+// NewFromEnv returns a Client configured by the MATTERMOST_* variables, or nil
+// if Mattermost isn't configured.
+func NewFromEnv() (*Client, error) {
+	config, err := ConfigFromEnv()
+	if err != nil || config == nil {
+		return nil, err
+	}
+	return New(config), nil
+}
+
+// Error is a request Mattermost rejected.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("mattermost returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("mattermost returned %d: %s", e.StatusCode, e.Message)
+}
+
+// do sends a request to the REST API and decodes the JSON response into out,
+// if it isn't nil.
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.Config.URL+"/api/v4"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Config.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		mattermostErr := &Error{StatusCode: resp.StatusCode}
+		var details struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &details) == nil {
+			mattermostErr.Message = details.Message
+		}
+		return mattermostErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// channel is a Mattermost channel, as the API returns it.
+type channel struct {
+	ID     string `json:"id"`
+	TeamID string `json:"team_id,omitempty"`
+	Name   string `json:"name"`
+	// DisplayName is what the channel is called in the UI; Name is its URL.
+	DisplayName string `json:"display_name"`
+	// Type is "O" for public channels, "P" for private ones.
+	Type   string `json:"type,omitempty"`
+	Header string `json:"header"`
+}
+
+func (c *Client) flareChannel(ch *channel) *flare.Channel {
+	c.namesMu.Lock()
+	c.channelNames[ch.ID] = ch.Name
+	c.namesMu.Unlock()
+	return &flare.Channel{ID: ch.ID, Name: ch.Name, Topic: ch.Header}
+}
+
+// user is a Mattermost user, as the API returns it.
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	// Email is "" if the server's privacy settings hide it.
+	Email string `json:"email"`
+	IsBot bool   `json:"is_bot"`
+}
+
+func (c *Client) flareUser(u *user) *flare.User {
+	c.namesMu.Lock()
+	c.userNames[u.ID] = u.Username
+	c.namesMu.Unlock()
+	return &flare.User{ID: u.ID, Name: u.Username, Email: u.Email, IsBot: u.IsBot}
+}
+
+func (c *Client) Name() string {
+	return "Mattermost"
+}
+
+func (c *Client) PostMessage(channelID string, text string) (string, error) {
+	post := struct {
+		ID        string `json:"id,omitempty"`
+		ChannelID string `json:"channel_id"`
+		Message   string `json:"message"`
+	}{ChannelID: channelID, Message: text}
+	if err := c.do(http.MethodPost, "/posts", post, &post); err != nil {
+		return "", err
+	}
+	return post.ID, nil
+}
+
+func (c *Client) Pin(channelID string, messageID string) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/posts/%s/pin", url.PathEscape(messageID)), nil, nil)
+}
+
+func (c *Client) CreateChannel(name string) (*flare.Channel, error) {
+	created := &channel{}
+	err := c.do(http.MethodPost, "/channels", &channel{TeamID: c.Config.TeamID, Name: name, DisplayName: name, Type: "O"}, created)
+	if err != nil {
+		return nil, err
+	}
+	return c.flareChannel(created), nil
+}
+
+func (c *Client) SetTopic(channelID string, topic string) error {
+	patch := map[string]string{"header": topic}
+	return c.do(http.MethodPut, fmt.Sprintf("/channels/%s/patch", url.PathEscape(channelID)), patch, nil)
+}
+
+func (c *Client) Invite(channelID string, userIDs ...string) error {
+	for _, userID := range userIDs {
+		member := map[string]string{"user_id": userID}
+		if err := c.do(http.MethodPost, fmt.Sprintf("/channels/%s/members", url.PathEscape(channelID)), member, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) Channel(channelID string) (*flare.Channel, error) {
+	found := &channel{}
+	if err := c.do(http.MethodGet, "/channels/"+url.PathEscape(channelID), nil, found); err != nil {
+		return nil, err
+	}
+	return c.flareChannel(found), nil
+}
+
+func (c *Client) ChannelMembers(channelID string) ([]*flare.User, error) {
+	members := []*flare.User{}
+	for page := 0; ; page++ {
+		users := []*user{}
+		query := url.Values{
+			"in_channel": {channelID},
+			"page":       {fmt.Sprint(page)},
+			"per_page":   {fmt.Sprint(membersPageSize)},
+		}
+		if err := c.do(http.MethodGet, "/users?"+query.Encode(), nil, &users); err != nil {
+			return nil, err
+		}
+
+		for _, u := range users {
+			members = append(members, c.flareUser(u))
+		}
+
+		if len(users) < membersPageSize {
+			return members, nil
+		}
+	}
+}
+
+func (c *Client) User(userID string) (*flare.User, error) {
+	found := &user{}
+	if err := c.do(http.MethodGet, "/users/"+url.PathEscape(userID), nil, found); err != nil {
+		return nil, err
+	}
+	return c.flareUser(found), nil
+}
+
+func (c *Client) UserByName(name string) (*flare.User, error) {
+	found := &user{}
+	if err := c.do(http.MethodGet, "/users/username/"+url.PathEscape(strings.TrimPrefix(name, "@")), nil, found); err != nil {
+		return nil, err
+	}
+	return c.flareUser(found), nil
+}
+
+// ChannelLink links to a channel by its team and name, which are looked up
+// the first time. If they can't be, it links to Mattermost itself.
+func (c *Client) ChannelLink(channelID string) string {
+	team := c.team()
+	name := c.channelName(channelID)
+	if team == "" || name == "" {
+		return c.Config.URL
+	}
+	return fmt.Sprintf("%s/%s/channels/%s", c.Config.URL, team, name)
+}
+
+// MentionChannel links a channel by name, falling back to its ID.
+func (c *Client) MentionChannel(channelID string) string {
+	if name := c.channelName(channelID); name != "" {
+		return "~" + name
+	}
+	return channelID
+}
+
+// MentionUser mentions a user by username, falling back to their ID.
+func (c *Client) MentionUser(userID string) string {
+	c.namesMu.Lock()
+	name := c.userNames[userID]
+	c.namesMu.Unlock()
+	if name == "" {
+		if u, err := c.User(userID); err == nil {
+			name = u.Name
+		}
+	}
+	if name == "" {
+		return userID
+	}
+	return "@" + name
+}
+
+func (c *Client) MentionEveryone() string {
+	return "@channel"
+}
+
+// team returns the name of the configured team, or "" if it can't be found.
+func (c *Client) team() string {
+	c.namesMu.Lock()
+	name := c.teamName
+	c.namesMu.Unlock()
+	if name != "" {
+		return name
+	}
+
+	team := struct {
+		Name string `json:"name"`
+	}{}
+	if err := c.do(http.MethodGet, "/teams/"+url.PathEscape(c.Config.TeamID), nil, &team); err != nil {
+		return ""
+	}
+	c.namesMu.Lock()
+	c.teamName = team.Name
+	c.namesMu.Unlock()
+	return team.Name
+}
+
+// channelName returns the name of a channel, or "" if it can't be found.
+func (c *Client) channelName(channelID string) string {
+	c.namesMu.Lock()
+	name := c.channelNames[channelID]
+	c.namesMu.Unlock()
+	if name != "" {
+		return name
+	}
+
+	found, err := c.Channel(channelID)
+	if err != nil {
+		return ""
+	}
+	return found.Name
+}
@@ -0,0 +1,163 @@
+package mattermost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// newTestClient returns a Client for a server answering with handle, and the
+// request URIs it received.
+func newTestClient(t *testing.T, handle func(w http.ResponseWriter, r *http.Request)) (*Client, *[]string) {
+	t.Helper()
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("%s %s was authorized with %q", r.Method, r.URL, auth)
+		}
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(&Config{URL: server.URL, Token: "token", TeamID: "team1"}), &requests
+}
+
+func TestChannelMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		members int
+		pages   int
+	}{
+		{"none", 0, 1},
+		{"one page", 3, 1},
+		{"a full page", membersPageSize, 2},
+		{"several pages", 2*membersPageSize + 1, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+				users := []*user{}
+				for i := page * perPage; i < test.members && i < (page+1)*perPage; i++ {
+					users = append(users, &user{ID: fmt.Sprintf("u%d", i), Username: fmt.Sprintf("user%d", i)})
+				}
+				json.NewEncoder(w).Encode(users)
+			})
+
+			members, err := client.ChannelMembers("chan1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(members) != test.members {
+				t.Errorf("got %d members, want %d", len(members), test.members)
+			}
+			if len(*requests) != test.pages {
+				t.Fatalf("asked for %d pages, want %d: %v", len(*requests), test.pages, *requests)
+			}
+			for page, request := range *requests {
+				want := fmt.Sprintf("GET /api/v4/users?in_channel=chan1&page=%d&per_page=200", page)
+				if request != want {
+					t.Errorf("asked for %s, want %s", request, want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"message", http.StatusForbidden, `{"id": "api.context.permissions.app_error", "message": "You do not have the appropriate permissions.", "status_code": 403}`, "mattermost returned 403: You do not have the appropriate permissions."},
+		{"no details", http.StatusBadGateway, `<html>Bad Gateway</html>`, "mattermost returned 502"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				io.WriteString(w, test.body)
+			})
+
+			_, err := client.CreateChannel("flare-7")
+			var mattermostErr *Error
+			if !errors.As(err, &mattermostErr) || mattermostErr.StatusCode != test.status {
+				t.Fatalf("got %v, want a %d", err, test.status)
+			}
+			if err.Error() != test.message {
+				t.Errorf("got %q, want %q", err.Error(), test.message)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/teams/team1":
+			io.WriteString(w, `{"id": "team1", "name": "ops"}`)
+		case "/api/v4/channels/chan1":
+			io.WriteString(w, `{"id": "chan1", "name": "flare-7", "display_name": "flare-7"}`)
+		case "/api/v4/users/user1":
+			io.WriteString(w, `{"id": "user1", "username": "ada"}`)
+		default:
+			http.Error(w, `{"message": "Unable to find the resource."}`, http.StatusNotFound)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		if link := client.ChannelLink("chan1"); link != client.Config.URL+"/ops/channels/flare-7" {
+			t.Errorf("linked %s", link)
+		}
+		if mention := client.MentionChannel("chan1"); mention != "~flare-7" {
+			t.Errorf("mentioned %s", mention)
+		}
+		if mention := client.MentionUser("user1"); mention != "@ada" {
+			t.Errorf("mentioned %s", mention)
+		}
+	}
+	// each name is looked up once
+	want := []string{"GET /api/v4/teams/team1", "GET /api/v4/channels/chan1", "GET /api/v4/users/user1"}
+	if !reflect.DeepEqual(*requests, want) {
+		t.Errorf("requests %v, want %v", *requests, want)
+	}
+
+	// unknown channels and users fall back to Mattermost and IDs
+	if link := client.ChannelLink("gone"); link != client.Config.URL {
+		t.Errorf("linked %s to a missing channel", link)
+	}
+	if mention := client.MentionChannel("gone"); mention != "gone" {
+		t.Errorf("mentioned %s for a missing channel", mention)
+	}
+	if mention := client.MentionUser("nobody"); mention != "nobody" {
+		t.Errorf("mentioned %s for a missing user", mention)
+	}
+}
+
+func TestCreatedChannelsAreNamed(t *testing.T) {
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": "chan2", "name": "flare-8", "display_name": "flare-8", "header": ""}`)
+	})
+
+	created, err := client.CreateChannel("flare-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != "chan2" || created.Name != "flare-8" {
+		t.Errorf("created %+v", created)
+	}
+	if mention := client.MentionChannel("chan2"); mention != "~flare-8" || len(*requests) != 1 {
+		t.Errorf("mentioned %s after %v", mention, *requests)
+	}
+}
@@ -0,0 +1,47 @@
+// Package pager wakes people up for big Flares.
+package pager
+
+import (
+	"fmt"
+	"os"
+)
+
+// Page is what's sent when paging for a Flare.
+type Page struct {
+	// DedupKey identifies the Flare's page, so triggering twice pages once
+	// and later calls find it. See DedupKey.
+	DedupKey string
+	Summary  string
+	// Priority is the Flare priority, e.g. "P0".
+	Priority string
+	// Links are titled URLs to include, e.g. the Flare channel and doc.
+	Links   map[string]string
+	Details map[string]string
+}
+
+// Pager pages people about a Flare and tells them when it's handled.
+type Pager interface {
+	Trigger(page *Page) error
+	Acknowledge(dedupKey string) error
+	Resolve(dedupKey string) error
+}
+
+// DedupKey is the dedup key of a Flare's page, by Flare number.
+func DedupKey(flareNumber string) string {
+	return fmt.Sprintf("flare-%s", flareNumber)
+}
+
+// NewFromEnv returns the configured Pager, or nil if paging isn't configured.
+// Only PagerDuty is supported, configured with PAGERDUTY_ROUTING_KEY.
+func NewFromEnv() (Pager, error) {
+	routingKey := os.Getenv("PAGERDUTY_ROUTING_KEY")
+	if routingKey == "" {
+		return nil, nil
+	}
+
+	pagerDuty := NewPagerDuty(routingKey)
+	if url := os.Getenv("PAGERDUTY_EVENTS_URL"); url != "" {
+		pagerDuty.EventsURL = url
+	}
+	return pagerDuty, nil
+}
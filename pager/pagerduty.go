@@ -0,0 +1,158 @@
+package pager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DefaultEventsURL is PagerDuty's Events API v2 endpoint.
+const DefaultEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+const (
+	// requestTimeout bounds each call to PagerDuty.
+	requestTimeout = 30 * time.Second
+	// attempts is how many times an event is sent before giving up, when
+	// PagerDuty is rate limiting or having trouble.
+	attempts = 3
+)
+
+// severities map Flare priorities to PagerDuty severities.
+var severities = map[string]string{
+	"P0": "critical",
+	"P1": "error",
+	"P2": "warning",
+}
+
+// PagerDuty pages through the PagerDuty Events API v2.
+type PagerDuty struct {
+	// RoutingKey is the integration key of the PagerDuty service to page.
+	RoutingKey string
+	EventsURL  string
+	HTTPClient *http.Client
+	// Backoff is the wait before the first retry, doubling after that.
+	Backoff time.Duration
+}
+
+// NewPagerDuty returns a PagerDuty paging the service with the routing key.
+func NewPagerDuty(routingKey string) *PagerDuty {
+	return &PagerDuty{
+		RoutingKey: routingKey,
+		EventsURL:  DefaultEventsURL,
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+		Backoff:    time.Second,
+	}
+}
+
+type event struct {
+	RoutingKey  string        `json:"routing_key"`
+	EventAction string        `json:"event_action"`
+	DedupKey    string        `json:"dedup_key"`
+	Payload     *eventPayload `json:"payload,omitempty"`
+	Links       []eventLink   `json:"links,omitempty"`
+}
+
+type eventPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type eventLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// Trigger pages for a Flare. Triggering a page that's already open doesn't
+// page again.
+func (p *PagerDuty) Trigger(page *Page) error {
+	severity, ok := severities[page.Priority]
+	if !ok {
+		severity = "critical"
+	}
+
+	e := &event{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    page.DedupKey,
+		Payload: &eventPayload{
+			Summary:       page.Summary,
+			Source:        "flarebot",
+			Severity:      severity,
+			CustomDetails: page.Details,
+		},
+	}
+	titles := make([]string, 0, len(page.Links))
+	for title := range page.Links {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	for _, title := range titles {
+		e.Links = append(e.Links, eventLink{Href: page.Links[title], Text: title})
+	}
+
+	return p.send(e)
+}
+
+// Acknowledge tells PagerDuty someone is handling the Flare.
+func (p *PagerDuty) Acknowledge(dedupKey string) error {
+	return p.send(&event{RoutingKey: p.RoutingKey, EventAction: "acknowledge", DedupKey: dedupKey})
+}
+
+// Resolve closes the Flare's page.
+func (p *PagerDuty) Resolve(dedupKey string) error {
+	return p.send(&event{RoutingKey: p.RoutingKey, EventAction: "resolve", DedupKey: dedupKey})
+}
+
+// send posts an event, retrying when PagerDuty is rate limiting or failing.
+func (p *PagerDuty) send(e *event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := p.post(data)
+		if err == nil || !retry || attempt == attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends an event once, returning whether it's worth retrying if it
+// failed.
+func (p *PagerDuty) post(data []byte) (bool, error) {
+	resp, err := p.HTTPClient.Post(p.EventsURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var details struct {
+		Message string   `json:"message"`
+		Errors  []string `json:"errors"`
+	}
+	message := string(body)
+	if json.Unmarshal(body, &details) == nil && details.Message != "" {
+		message = details.Message
+		if len(details.Errors) > 0 {
+			message = fmt.Sprintf("%s: %v", message, details.Errors)
+		}
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("pagerduty returned %d: %s", resp.StatusCode, message)
+}
@@ -0,0 +1,126 @@
+package pager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestPagerDuty returns a PagerDuty sending to a server that answers each
+// event with the next of statuses, then 202, and the bodies it received.
+func newTestPagerDuty(t *testing.T, statuses ...int) (*PagerDuty, *[]map[string]interface{}) {
+	t.Helper()
+	bodies := []map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("sent %q: %s", data, err)
+		}
+		bodies = append(bodies, body)
+
+		status := http.StatusAccepted
+		if len(bodies) <= len(statuses) {
+			status = statuses[len(bodies)-1]
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, `{"status": "invalid event", "message": "Event object is invalid", "errors": ["Length of 'routing_key' is incorrect"]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	pagerDuty := NewPagerDuty("routing-key")
+	pagerDuty.EventsURL = server.URL
+	pagerDuty.Backoff = time.Millisecond
+	return pagerDuty, &bodies
+}
+
+func TestPagerDutyEvents(t *testing.T) {
+	pagerDuty, bodies := newTestPagerDuty(t)
+	dedupKey := DedupKey("7")
+	if dedupKey != "flare-7" {
+		t.Errorf("dedup key %q, want flare-7", dedupKey)
+	}
+
+	err := pagerDuty.Trigger(&Page{
+		DedupKey: dedupKey,
+		Summary:  "P1 Flare: checkout is down",
+		Priority: "P1",
+		Links:    map[string]string{"Flare doc": "https://docs.google.com/d/1", "Channel": "https://slack.com/C1"},
+		Details:  map[string]string{"reporter": "ada"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pagerDuty.Acknowledge(dedupKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := pagerDuty.Resolve(dedupKey); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]interface{}{
+		{
+			"routing_key":  "routing-key",
+			"event_action": "trigger",
+			"dedup_key":    "flare-7",
+			"payload": map[string]interface{}{
+				"summary":        "P1 Flare: checkout is down",
+				"source":         "flarebot",
+				"severity":       "error",
+				"custom_details": map[string]interface{}{"reporter": "ada"},
+			},
+			"links": []interface{}{
+				map[string]interface{}{"href": "https://slack.com/C1", "text": "Channel"},
+				map[string]interface{}{"href": "https://docs.google.com/d/1", "text": "Flare doc"},
+			},
+		},
+		{"routing_key": "routing-key", "event_action": "acknowledge", "dedup_key": "flare-7"},
+		{"routing_key": "routing-key", "event_action": "resolve", "dedup_key": "flare-7"},
+	}
+	if !reflect.DeepEqual(*bodies, want) {
+		t.Errorf("sent\n%v\nwant\n%v", *bodies, want)
+	}
+}
+
+func TestPagerDutyRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		fails    bool
+	}{
+		{"accepted", nil, 1, false},
+		{"rate limited", []int{http.StatusTooManyRequests}, 2, false},
+		{"unavailable", []int{http.StatusServiceUnavailable, http.StatusInternalServerError}, 3, false},
+		{"down", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}, 3, true},
+		{"invalid", []int{http.StatusBadRequest}, 1, true},
+		{"forbidden", []int{http.StatusForbidden}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pagerDuty, bodies := newTestPagerDuty(t, test.statuses...)
+
+			err := pagerDuty.Resolve(DedupKey("7"))
+			if (err != nil) != test.fails {
+				t.Errorf("got %v, want failure %t", err, test.fails)
+			}
+			if len(*bodies) != test.attempts {
+				t.Errorf("sent %d times, want %d", len(*bodies), test.attempts)
+			}
+		})
+	}
+}
+
+func TestPagerDutyErrorMessage(t *testing.T) {
+	pagerDuty, _ := newTestPagerDuty(t, http.StatusBadRequest)
+
+	err := pagerDuty.Acknowledge(DedupKey("7"))
+	want := "pagerduty returned 400: Event object is invalid: [Length of 'routing_key' is incorrect]"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
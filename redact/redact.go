@@ -0,0 +1,166 @@
+// Package redact scrubs secrets out of Slack text before flarebot copies it
+// anywhere more durable, like the history sheet or the flare doc.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Detector finds one kind of secret. If Pattern has a named group "secret",
+// only that group is replaced; otherwise the whole match is.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// Builtins are the detectors flarebot ships with, in the order they run.
+var Builtins = []*Detector{
+	{
+		Name:    "private-key",
+		Pattern: regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+	},
+	{
+		Name:    "aws-access-key",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`),
+	},
+	{
+		Name:    "aws-secret-key",
+		Pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?['"]?\s*[:=]\s*['"]?(?P<secret>[0-9A-Za-z/+]{40})\b`),
+	},
+	{
+		Name:    "slack-token",
+		Pattern: regexp.MustCompile(`\b(?:xox[abposr]-[0-9A-Za-z-]{10,}|xapp-\d-[0-9A-Za-z-]{10,})`),
+	},
+	{
+		Name:    "slack-webhook",
+		Pattern: regexp.MustCompile(`https://hooks\.slack\.com/services/[0-9A-Za-z/]+`),
+	},
+	{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[0-9A-Za-z_-]{5,}\.eyJ[0-9A-Za-z_-]{5,}\.[0-9A-Za-z_-]{10,}`),
+	},
+	{
+		Name:    "connection-string",
+		Pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@<>|]+:(?P<secret>[^\s@/<>|\[][^\s@/<>|]*)@`),
+	},
+	{
+		Name:    "password",
+		Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|api[_-]?key|secret|token)\s*[:=]\s*['"]?(?P<secret>[^\s'"\[][^\s'"]*)`),
+	},
+}
+
+// Redactor replaces every secret its detectors find with a marker naming the
+// detector, e.g. "[REDACTED:jwt]".
+type Redactor struct {
+	detectors []*Detector
+}
+
+// New builds a Redactor from the named built-in detectors (all of them if
+// builtins is empty) plus custom name => regexp patterns, which run after the
+// built-ins in order of name.
+func New(builtins []string, custom map[string]string) (*Redactor, error) {
+	r := &Redactor{}
+
+	if len(builtins) == 0 {
+		r.detectors = append(r.detectors, Builtins...)
+	} else {
+		for _, name := range builtins {
+			d := builtin(strings.TrimSpace(name))
+			if d == nil {
+				return nil, fmt.Errorf("unknown redaction detector %s", name)
+			}
+			r.detectors = append(r.detectors, d)
+		}
+	}
+
+	// patterns can overlap, so the order they run in has to be stable
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		re, err := regexp.Compile(custom[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %s", name, err)
+		}
+		r.detectors = append(r.detectors, &Detector{Name: name, Pattern: re})
+	}
+
+	return r, nil
+}
+
+// NewFromConfig builds a Redactor from the REDACTION_DETECTORS (comma-separated
+// built-in names) and REDACTION_CUSTOM_PATTERNS (JSON object of name => regexp)
+// configuration values. Empty values mean all built-ins and no custom patterns.
+func NewFromConfig(detectors string, customJSON string) (*Redactor, error) {
+	var builtins []string
+	if detectors != "" {
+		builtins = strings.Split(detectors, ",")
+	}
+
+	custom := map[string]string{}
+	if customJSON != "" {
+		if err := json.Unmarshal([]byte(customJSON), &custom); err != nil {
+			return nil, fmt.Errorf("REDACTION_CUSTOM_PATTERNS is not a JSON object: %s", err)
+		}
+	}
+
+	return New(builtins, custom)
+}
+
+func builtin(name string) *Detector {
+	for _, d := range Builtins {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Redact returns text with all secrets replaced, and how many were replaced.
+// A nil Redactor returns text unchanged.
+func (r *Redactor) Redact(text string) (string, int) {
+	if r == nil {
+		return text, 0
+	}
+
+	count := 0
+	for _, d := range r.detectors {
+		var n int
+		text, n = d.redact(text)
+		count += n
+	}
+
+	return text, count
+}
+
+func (d *Detector) redact(text string) (string, int) {
+	matches := d.Pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+
+	group := d.Pattern.SubexpIndex("secret")
+	marker := fmt.Sprintf("[REDACTED:%s]", d.Name)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if group > 0 && m[2*group] >= 0 {
+			start, end = m[2*group], m[2*group+1]
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(marker)
+		last = end
+	}
+	b.WriteString(text[last:])
+
+	return b.String(), len(matches)
+}
@@ -0,0 +1,108 @@
+// Package resources decides what guidance is posted in a new Flare channel:
+// the Flare resources page, runbooks, dashboards, who to escalate to and a
+// checklist.
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Link is a titled URL.
+type Link struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Resources is the guidance posted when a Flare is fired.
+type Resources struct {
+	// Reminder is a one-line reminder at the top, e.g. "Rollback, Scale or
+	// Restart!".
+	Reminder string `json:"reminder,omitempty"`
+	// URL is the Flare resources page. It defaults to FLARE_RESOURCES_URL.
+	URL        string   `json:"url,omitempty"`
+	Runbooks   []Link   `json:"runbooks,omitempty"`
+	Dashboards []Link   `json:"dashboards,omitempty"`
+	Escalation []string `json:"escalation,omitempty"`
+	Checklist  []string `json:"checklist,omitempty"`
+}
+
+// DefaultResources is used when nothing else is configured, which is what
+// flarebot has always posted.
+var DefaultResources = &Resources{Reminder: "Rollback, Scale or Restart!"}
+
+func (r *Resources) validate() error {
+	for _, link := range append(append([]Link{}, r.Runbooks...), r.Dashboards...) {
+		if link.URL == "" {
+			return fmt.Errorf("link %q has no url", link.Title)
+		}
+	}
+	return nil
+}
+
+// Empty is whether there's nothing to post.
+func (r *Resources) Empty() bool {
+	return r.Reminder == "" && r.URL == "" && len(r.Runbooks) == 0 && len(r.Dashboards) == 0 && len(r.Escalation) == 0 && len(r.Checklist) == 0
+}
+
+// Sets picks the resources for a Flare by its type, then its priority.
+type Sets struct {
+	byKey map[string]*Resources
+}
+
+// New builds Sets from resources keyed by Flare type (e.g. "sensitive"),
+// priority (e.g. "P0") or "default". Without a "default" set,
+// DefaultResources is used. Sets without a URL get resourcesURL.
+func New(sets map[string]*Resources, resourcesURL string) (*Sets, error) {
+	s := &Sets{byKey: map[string]*Resources{}}
+	for key, set := range sets {
+		if set == nil {
+			return nil, fmt.Errorf("flare resources %s are empty", key)
+		}
+		if err := set.validate(); err != nil {
+			return nil, fmt.Errorf("invalid flare resources %s: %s", key, err)
+		}
+		s.byKey[strings.ToLower(key)] = set
+	}
+	if _, ok := s.byKey["default"]; !ok {
+		s.byKey["default"] = DefaultResources
+	}
+
+	for key, set := range s.byKey {
+		if set.URL == "" && resourcesURL != "" {
+			withURL := *set
+			withURL.URL = resourcesURL
+			s.byKey[key] = &withURL
+		}
+	}
+
+	return s, nil
+}
+
+// NewFromConfig builds Sets from the FLARE_RESOURCES configuration value, a
+// JSON object of key => resources, and FLARE_RESOURCES_URL. An empty value
+// means DefaultResources for every Flare.
+func NewFromConfig(configJSON string, resourcesURL string) (*Sets, error) {
+	sets := map[string]*Resources{}
+	if configJSON != "" {
+		if err := json.Unmarshal([]byte(configJSON), &sets); err != nil {
+			return nil, fmt.Errorf("FLARE_RESOURCES is not a JSON object of resources: %s", err)
+		}
+	}
+
+	return New(sets, resourcesURL)
+}
+
+// For returns the resources for a Flare of the given type and priority.
+func (s *Sets) For(flareType string, priority string) *Resources {
+	if s == nil {
+		return DefaultResources
+	}
+	for _, key := range []string{flareType, priority} {
+		if set, ok := s.byKey[strings.ToLower(key)]; ok && key != "" {
+			return set
+		}
+	}
+	return s.byKey["default"]
+}
@@ -0,0 +1,213 @@
+// Package sharing decides who can open the documents flarebot creates for a
+// Flare, and brings a document's Drive permissions in line with that.
+package sharing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// Roles a policy can grant, from least to most access.
+var Roles = []string{"reader", "commenter", "writer"}
+
+// Policy says who a Flare's documents are shared with.
+type Policy struct {
+	// Domain is the role everyone in the Google domain gets, or "" for none.
+	Domain string `json:"domain,omitempty"`
+	// Groups maps Google group email addresses to the role they get.
+	Groups map[string]string `json:"groups,omitempty"`
+	// ChannelMembers is the role each member of the Flare channel gets, by
+	// the email address on their Slack profile, or "" for none.
+	ChannelMembers string `json:"channel_members,omitempty"`
+	// Restricted documents are only shared with Groups: Domain and
+	// ChannelMembers are ignored, and any other direct permission, including
+	// ones people added by hand, is revoked.
+	Restricted bool `json:"restricted,omitempty"`
+}
+
+// DefaultPolicy is used when nothing else is configured: the whole domain can
+// edit, which is how flarebot has always shared documents.
+var DefaultPolicy = &Policy{Domain: "writer"}
+
+func (p *Policy) validate() error {
+	roles := map[string]string{"domain": p.Domain, "channel_members": p.ChannelMembers}
+	for group, role := range p.Groups {
+		roles[group] = role
+	}
+	for who, role := range roles {
+		if role != "" && rank(role) < 0 {
+			return fmt.Errorf("unknown role %s for %s, expected one of %s", role, who, strings.Join(Roles, ", "))
+		}
+	}
+	return nil
+}
+
+// Fingerprint identifies the policy's settings, so documents shared under an
+// older version of it can be found and shared again.
+func (p *Policy) Fingerprint() string {
+	// maps are marshalled with sorted keys, so equal policies match
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// Grant is a permission a policy calls for.
+type Grant struct {
+	Type  string
+	Value string
+	Role  string
+}
+
+// Grants returns the permissions the policy calls for, given the Google
+// domain and the email addresses of the Flare channel's members.
+func (p *Policy) Grants(domain string, channelMembers []string) []Grant {
+	roles := map[Grant]string{}
+	grant := func(permissionType string, value string, role string) {
+		key := Grant{Type: permissionType, Value: strings.ToLower(value)}
+		if role == "" || value == "" || rank(role) <= rank(roles[key]) {
+			return
+		}
+		roles[key] = role
+	}
+
+	for group, role := range p.Groups {
+		grant("group", group, role)
+	}
+	if !p.Restricted {
+		grant("domain", domain, p.Domain)
+		for _, email := range channelMembers {
+			grant("user", email, p.ChannelMembers)
+		}
+	}
+
+	grants := make([]Grant, 0, len(roles))
+	for key, role := range roles {
+		grants = append(grants, Grant{Type: key.Type, Value: key.Value, Role: role})
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Type != grants[j].Type {
+			return grants[i].Type < grants[j].Type
+		}
+		return grants[i].Value < grants[j].Value
+	})
+
+	return grants
+}
+
+func rank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Policies picks the policy for a Flare by its type, then its priority.
+type Policies struct {
+	byKey map[string]*Policy
+}
+
+// New builds Policies from policies keyed by Flare type (e.g. "sensitive"),
+// priority (e.g. "P0") or "default". Without a "default" policy,
+// DefaultPolicy is used.
+func New(policies map[string]*Policy) (*Policies, error) {
+	p := &Policies{byKey: map[string]*Policy{}}
+	for key, policy := range policies {
+		if policy == nil {
+			return nil, fmt.Errorf("sharing policy %s is empty", key)
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid sharing policy %s: %s", key, err)
+		}
+		p.byKey[strings.ToLower(key)] = policy
+	}
+	if _, ok := p.byKey["default"]; !ok {
+		p.byKey["default"] = DefaultPolicy
+	}
+
+	return p, nil
+}
+
+// NewFromConfig builds Policies from the SHARING_POLICIES configuration value,
+// a JSON object of key => policy. An empty value means DefaultPolicy for every
+// Flare.
+func NewFromConfig(configJSON string) (*Policies, error) {
+	policies := map[string]*Policy{}
+	if configJSON != "" {
+		if err := json.Unmarshal([]byte(configJSON), &policies); err != nil {
+			return nil, fmt.Errorf("SHARING_POLICIES is not a JSON object of policies: %s", err)
+		}
+	}
+
+	return New(policies)
+}
+
+// For returns the policy for a Flare of the given type and priority.
+func (p *Policies) For(flareType string, priority string) *Policy {
+	if p == nil {
+		return DefaultPolicy
+	}
+	for _, key := range []string{flareType, priority} {
+		if policy, ok := p.byKey[strings.ToLower(key)]; ok && key != "" {
+			return policy
+		}
+	}
+	return p.byKey["default"]
+}
+
+// Apply makes the permissions on doc match grants: missing grants are
+// created and roles corrected. Domain permissions that aren't granted are
+// revoked, and with a restricted policy so is every other direct permission.
+// Owners and inherited permissions are left alone.
+func Apply(service googledocs.GoogleDocsService, doc *googledocs.Doc, policy *Policy, grants []Grant) error {
+	existing, err := service.ListPermissions(doc)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[Grant]string{}
+	for _, g := range grants {
+		wanted[Grant{Type: g.Type, Value: strings.ToLower(g.Value)}] = g.Role
+	}
+
+	for _, perm := range existing {
+		if perm.Inherited || perm.Role == "owner" || perm.Role == "organizer" || perm.Role == "fileOrganizer" {
+			continue
+		}
+
+		key := Grant{Type: perm.Type, Value: strings.ToLower(perm.Value)}
+		role, ok := wanted[key]
+		switch {
+		case ok:
+			delete(wanted, key)
+			if perm.Role != role {
+				if err = service.UpdatePermission(doc, perm.ID, role); err != nil {
+					return err
+				}
+			}
+		case perm.Type == "domain" || policy.Restricted:
+			if err = service.DeletePermission(doc, perm.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, g := range grants {
+		key := Grant{Type: g.Type, Value: strings.ToLower(g.Value)}
+		if _, ok := wanted[key]; !ok {
+			continue
+		}
+		if err = service.SharePermission(doc, g.Type, g.Value, g.Role); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package sharing
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"empty", "", ""},
+		{"policies", `{"default": {"domain": "commenter"}, "sensitive": {"groups": {"security@example.com": "writer"}, "restricted": true}}`, ""},
+		{"not JSON", `[{"domain": "writer"}]`, "SHARING_POLICIES is not a JSON object of policies"},
+		{"empty policy", `{"P0": null}`, "sharing policy P0 is empty"},
+		{"unknown domain role", `{"P0": {"domain": "owner"}}`, "invalid sharing policy P0: unknown role owner for domain"},
+		{"unknown group role", `{"P0": {"groups": {"leads@example.com": "editor"}}}`, "unknown role editor for leads@example.com"},
+		{"unknown member role", `{"P0": {"channel_members": "admin"}}`, "unknown role admin for channel_members"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policies, err := NewFromConfig(test.config)
+			if test.err == "" {
+				if err != nil || policies == nil {
+					t.Errorf("got %v, %v", policies, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPoliciesFor(t *testing.T) {
+	sensitive := &Policy{Groups: map[string]string{"security@example.com": "writer"}, Restricted: true}
+	p0 := &Policy{Domain: "commenter"}
+	fallback := &Policy{Domain: "reader"}
+
+	tests := []struct {
+		name      string
+		policies  map[string]*Policy
+		flareType string
+		priority  string
+		want      *Policy
+	}{
+		{"by type", map[string]*Policy{"sensitive": sensitive, "P0": p0}, "sensitive", "P0", sensitive},
+		{"by priority", map[string]*Policy{"sensitive": sensitive, "P0": p0}, "", "P0", p0},
+		{"keys ignore case", map[string]*Policy{"Sensitive": sensitive, "p0": p0}, "SENSITIVE", "p0", sensitive},
+		{"unknown type", map[string]*Policy{"sensitive": sensitive, "P0": p0}, "preemptive", "P0", p0},
+		{"default", map[string]*Policy{"P0": p0, "default": fallback}, "", "P2", fallback},
+		{"built-in default", map[string]*Policy{"P0": p0}, "", "P2", DefaultPolicy},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policies, err := New(test.policies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := policies.For(test.flareType, test.priority); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	var none *Policies
+	if got := none.For("sensitive", "P0"); got != DefaultPolicy {
+		t.Errorf("no policies gave %+v, want DefaultPolicy", got)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	policy := &Policy{Domain: "commenter", Groups: map[string]string{"a@example.com": "writer", "b@example.com": "reader"}}
+	same := &Policy{Groups: map[string]string{"b@example.com": "reader", "a@example.com": "writer"}, Domain: "commenter"}
+	if policy.Fingerprint() != same.Fingerprint() {
+		t.Error("equal policies have different fingerprints")
+	}
+
+	for _, changed := range []*Policy{
+		{Domain: "writer", Groups: policy.Groups},
+		{Domain: "commenter", Groups: map[string]string{"a@example.com": "writer", "b@example.com": "commenter"}},
+		{Domain: "commenter", Groups: policy.Groups, ChannelMembers: "reader"},
+		{Domain: "commenter", Groups: policy.Groups, Restricted: true},
+	} {
+		if changed.Fingerprint() == policy.Fingerprint() {
+			t.Errorf("%+v has the fingerprint of %+v", changed, policy)
+		}
+	}
+}
+
+func TestGrants(t *testing.T) {
+	members := []string{"Ada@example.com", "grace@example.com", ""}
+
+	open := &Policy{Domain: "reader", Groups: map[string]string{"Leads@example.com": "writer"}, ChannelMembers: "commenter"}
+	want := []Grant{
+		{Type: "domain", Value: "example.com", Role: "reader"},
+		{Type: "group", Value: "leads@example.com", Role: "writer"},
+		{Type: "user", Value: "ada@example.com", Role: "commenter"},
+		{Type: "user", Value: "grace@example.com", Role: "commenter"},
+	}
+	if grants := open.Grants("example.com", members); !reflect.DeepEqual(grants, want) {
+		t.Errorf("granted %+v, want %+v", grants, want)
+	}
+
+	restricted := &Policy{Domain: "writer", Groups: map[string]string{"security@example.com": "writer"}, ChannelMembers: "writer", Restricted: true}
+	want = []Grant{{Type: "group", Value: "security@example.com", Role: "writer"}}
+	if grants := restricted.Grants("example.com", members); !reflect.DeepEqual(grants, want) {
+		t.Errorf("restricted granted %+v, want %+v", grants, want)
+	}
+}
@@ -0,0 +1,244 @@
+package slack
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/modern-pet/flarebot/alertmanager"
+	"github.com/modern-pet/flarebot/flare"
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the buttons asking whether to fire a Flare for alerts.
+const (
+	alertFireAction    = "alert_fire"
+	alertDismissAction = "alert_dismiss"
+)
+
+// alertReporter is who Flares fired by alerts are reported by.
+const alertReporter = "Alertmanager"
+
+// alertPrompt is an alert group waiting for someone to decide whether to fire
+// a Flare for it.
+type alertPrompt struct {
+	notification *alertmanager.Notification
+	rule         *alertmanager.Rule
+}
+
+// HandleAlerts handles an Alertmanager notification. The first of AlertRules
+// matching the alerts decides what happens to them: if it fires or prompts,
+// alerts of a group that already has a Flare are posted in its channel, and
+// otherwise a Flare is fired for them, or the Flares channel is asked whether
+// to.
+func (c *SlackClient) HandleAlerts(notification *alertmanager.Notification) {
+	groupID := notification.GroupID()
+
+	if c.queueAlertUpdate(groupID, notification) {
+		return
+	}
+
+	// alerts no rule acts on never had a Flare or a prompt, so they're
+	// dropped before looking for one in Drive
+	rule := c.AlertRules.For(notification)
+	if rule == nil || rule.Action == alertmanager.ActionIgnore {
+		log.Printf("No Flare for alert group %s: %s", notification.GroupKey, notification.Summary())
+		return
+	}
+
+	if channelID := c.alertGroupChannel(groupID); channelID != "" {
+		c.postAlertUpdate(channelID, notification)
+		return
+	}
+
+	if notification.Status == alertmanager.StatusResolved {
+		c.alertGroupsMu.Lock()
+		delete(c.alertPrompts, groupID)
+		delete(c.dismissedAlertGroups, groupID)
+		c.alertGroupsMu.Unlock()
+		return
+	}
+
+	// the group is reserved before anything slow happens, so a resend of
+	// the notification can't fire or ask about it twice
+	c.alertGroupsMu.Lock()
+	channelID := c.alertGroupChannels[groupID]
+	pending, firing := c.firingAlertGroups[groupID]
+	_, prompted := c.alertPrompts[groupID]
+	dismissed := c.dismissedAlertGroups[groupID]
+	reserved := channelID == "" && !firing && !prompted && !dismissed
+	switch {
+	case firing:
+		c.firingAlertGroups[groupID] = append(pending, notification)
+	case !reserved:
+	case rule.Action == alertmanager.ActionFire:
+		c.firingAlertGroups[groupID] = nil
+	case rule.Action == alertmanager.ActionPrompt:
+		c.alertPrompts[groupID] = &alertPrompt{notification: notification, rule: rule}
+	}
+	c.alertGroupsMu.Unlock()
+
+	if channelID != "" {
+		c.postAlertUpdate(channelID, notification)
+	}
+	if !reserved {
+		return
+	}
+
+	switch rule.Action {
+	case alertmanager.ActionFire:
+		c.fireAlertFlare(notification, rule, "")
+	case alertmanager.ActionPrompt:
+		c.promptAlertFlare(notification, rule)
+	}
+}
+
+// queueAlertUpdate holds on to a notification for an alert group whose Flare
+// is being fired, to post once its channel exists. It returns false if no
+// Flare is being fired for the group.
+func (c *SlackClient) queueAlertUpdate(groupID string, notification *alertmanager.Notification) bool {
+	c.alertGroupsMu.Lock()
+	defer c.alertGroupsMu.Unlock()
+
+	pending, firing := c.firingAlertGroups[groupID]
+	if firing {
+		c.firingAlertGroups[groupID] = append(pending, notification)
+	}
+	return firing
+}
+
+// postAlertUpdate posts a notification for an alert group in the channel of
+// the Flare fired for it.
+func (c *SlackClient) postAlertUpdate(channelID string, notification *alertmanager.Notification) {
+	c.Client.PostMessage(channelID, slack.MsgOptionText(notification.Describe(), false))
+	if notification.Status == alertmanager.StatusResolved {
+		c.FlareEvent(channelID, alertReporter, fmt.Sprintf("Alerts resolved: %s", notification.Summary()), nil)
+	}
+}
+
+// alertGroupChannel returns the channel of the Flare fired for an alert
+// group, if that Flare is still going, or "".
+func (c *SlackClient) alertGroupChannel(groupID string) string {
+	c.alertGroupsMu.Lock()
+	channelID := c.alertGroupChannels[groupID]
+	c.alertGroupsMu.Unlock()
+
+	if channelID == "" {
+		docs, err := c.GoogleDocsServer.FindDocs(map[string]string{googledocs.PropertyAlertGroup: groupID})
+		if err != nil {
+			log.Printf("Couldn't look up the Flare for alert group %s: %s", groupID, err)
+			return ""
+		}
+		if len(docs) == 0 {
+			return ""
+		}
+		channelID = docs[0].File.AppProperties[googledocs.PropertyChannelID]
+	}
+
+	// alerts that come back after the Flare is over are news, not updates
+	if record, err := c.FindFlare(channelID); err == nil {
+		switch record.Properties[googledocs.PropertyState] {
+		case flare.StateFired, flare.StateMitigated:
+		default:
+			c.alertGroupsMu.Lock()
+			delete(c.alertGroupChannels, groupID)
+			c.alertGroupsMu.Unlock()
+			return ""
+		}
+	}
+	return channelID
+}
+
+// fireAlertFlare fires a Flare for an alert group, reported by reporterID or
+// by Alertmanager if that's "", and posts the alerts in its channel. The group
+// must have been reserved in c.firingAlertGroups.
+func (c *SlackClient) fireAlertFlare(notification *alertmanager.Notification, rule *alertmanager.Rule, reporterID string) {
+	groupID := notification.GroupID()
+	priority := rule.PriorityFor(notification)
+	log.Printf("Firing a %s Flare for alert group %s", priority, notification.GroupKey)
+
+	channelID := c.Fire(&flare.Request{
+		ChannelID:  c.ExpectedChannel,
+		Priority:   priority,
+		Topic:      notification.Summary(),
+		ReporterID: reporterID,
+		Reporter:   alertReporter,
+	})
+
+	c.alertGroupsMu.Lock()
+	pending := c.firingAlertGroups[groupID]
+	delete(c.firingAlertGroups, groupID)
+	if channelID != "" {
+		c.alertGroupChannels[groupID] = channelID
+	}
+	c.alertGroupsMu.Unlock()
+
+	if channelID == "" {
+		log.Printf("Couldn't fire a Flare for alert group %s, dropping %d later notifications", notification.GroupKey, len(pending))
+		return
+	}
+
+	c.FlareEvent(channelID, alertReporter, fmt.Sprintf("Fired for alerts: %s", notification.Summary()), map[string]string{googledocs.PropertyAlertGroup: groupID})
+	text := notification.Describe()
+	if notification.ExternalURL != "" {
+		text = fmt.Sprintf("%s\n<%s|Alertmanager>", text, notification.ExternalURL)
+	}
+	c.Client.PostMessage(channelID, slack.MsgOptionText(fmt.Sprintf("This Flare was fired for these alerts. I'll post updates to them here.\n%s", text), false))
+
+	for _, update := range pending {
+		c.postAlertUpdate(channelID, update)
+	}
+}
+
+// promptAlertFlare asks the Flares channel whether to fire a Flare for an
+// alert group. The group must have been reserved in c.alertPrompts.
+func (c *SlackClient) promptAlertFlare(notification *alertmanager.Notification, rule *alertmanager.Rule) {
+	groupID := notification.GroupID()
+	priority := rule.PriorityFor(notification)
+
+	text := slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("Fire a %s Flare for these alerts?\n%s", priority, notification.Describe()), false, false)
+	fire := slack.NewButtonBlockElement(alertFireAction, groupID, slack.NewTextBlockObject(slack.PlainTextType, fmt.Sprintf("Fire a %s Flare", priority), false, false))
+	fire.Style = slack.StyleDanger
+	dismiss := slack.NewButtonBlockElement(alertDismissAction, groupID, slack.NewTextBlockObject(slack.PlainTextType, "Not a Flare", false, false))
+
+	_, _, err := c.Client.PostMessage(c.ExpectedChannel,
+		slack.MsgOptionText(fmt.Sprintf("Fire a %s Flare? %s", priority, notification.Summary()), false),
+		slack.MsgOptionBlocks(slack.NewSectionBlock(text, nil, nil), slack.NewActionBlock("alert", fire, dismiss)),
+	)
+	if err != nil {
+		log.Printf("Couldn't ask about alert group %s: %s", notification.GroupKey, err)
+		c.alertGroupsMu.Lock()
+		delete(c.alertPrompts, groupID)
+		c.alertGroupsMu.Unlock()
+	}
+}
+
+// handleAlertAction handles a click on the buttons asking whether to fire a
+// Flare for alerts.
+func (c *SlackClient) handleAlertAction(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	groupID := action.Value
+
+	c.alertGroupsMu.Lock()
+	prompt := c.alertPrompts[groupID]
+	delete(c.alertPrompts, groupID)
+	if action.ActionID == alertDismissAction {
+		c.dismissedAlertGroups[groupID] = true
+	}
+	if prompt != nil && action.ActionID == alertFireAction {
+		c.firingAlertGroups[groupID] = nil
+	}
+	c.alertGroupsMu.Unlock()
+
+	if prompt == nil {
+		c.answerOffer(callback, "These alerts were already taken care of.")
+		return
+	}
+
+	switch action.ActionID {
+	case alertFireAction:
+		c.answerOffer(callback, fmt.Sprintf("<@%s> fired a Flare for these alerts: %s", callback.User.ID, prompt.notification.Summary()))
+		c.fireAlertFlare(prompt.notification, prompt.rule, callback.User.ID)
+	case alertDismissAction:
+		c.answerOffer(callback, fmt.Sprintf("<@%s> decided these alerts aren't a Flare: %s. I won't ask again until they resolve.", callback.User.ID, prompt.notification.Summary()))
+	}
+}
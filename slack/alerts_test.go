@@ -0,0 +1,65 @@
+package slack
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/modern-pet/flarebot/alertmanager"
+	"github.com/modern-pet/flarebot/flare"
+	"github.com/modern-pet/flarebot/googledocs"
+)
+
+// countingDocs counts the Drive searches made for Flares.
+type countingDocs struct {
+	*googledocs.FakeGoogleDocsServer
+
+	mu       sync.Mutex
+	searches int
+}
+
+func (d *countingDocs) FindDocs(properties map[string]string) ([]*googledocs.Doc, error) {
+	d.mu.Lock()
+	d.searches++
+	d.mu.Unlock()
+	return d.FakeGoogleDocsServer.FindDocs(properties)
+}
+
+func TestHandleAlertsChecksRulesFirst(t *testing.T) {
+	rules, err := alertmanager.NewRulesFromConfig(`[
+		{"match": {"team": "data"}, "action": "ignore"},
+		{"match": {"severity": "critical"}, "action": "fire"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		searches int
+	}{
+		{"no rule", map[string]string{"severity": "warning"}, 0},
+		{"ignored", map[string]string{"team": "data", "severity": "critical"}, 0},
+		{"fired", map[string]string{"severity": "critical"}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs := &countingDocs{FakeGoogleDocsServer: googledocs.NewFakeGoogleDocsServer()}
+			c := &SlackClient{
+				Service:              flare.New(nil, docs, &flare.Config{}),
+				AlertRules:           rules,
+				alertGroupChannels:   map[string]string{},
+				alertPrompts:         map[string]*alertPrompt{},
+				firingAlertGroups:    map[string][]*alertmanager.Notification{},
+				dismissedAlertGroups: map[string]bool{},
+			}
+
+			// resolved alerts without a Flare are only forgotten
+			c.HandleAlerts(&alertmanager.Notification{GroupKey: "{}:{alertname=\"Down\"}", Status: alertmanager.StatusResolved, CommonLabels: test.labels})
+
+			if docs.searches != test.searches {
+				t.Errorf("searched Drive %d times, want %d", docs.searches, test.searches)
+			}
+		})
+	}
+}
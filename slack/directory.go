@@ -0,0 +1,221 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	slk "github.com/slack-go/slack"
+)
+
+// defaultDirectoryTTL is how long a cached user or channel is trusted before
+// we go back to Slack for it.
+const defaultDirectoryTTL = 30 * time.Minute
+
+// directoryPageSize is the page size used when warming the directory.
+const directoryPageSize = 200
+
+type cachedUser struct {
+	user    *slk.User
+	fetched time.Time
+}
+
+type cachedChannel struct {
+	channel *slk.Channel
+	fetched time.Time
+}
+
+// directory is a shared cache of Slack users and channels. Every handler goes
+// through it instead of calling GetUserInfo / GetConversationInfo directly, so
+// a busy flare channel doesn't cost an API call per message.
+type directory struct {
+	api *slk.Client
+	ttl time.Duration
+
+	mu          sync.RWMutex
+	users       map[string]cachedUser
+	usersByName map[string]string
+	channels    map[string]cachedChannel
+}
+
+func newDirectory(api *slk.Client, ttl time.Duration) *directory {
+	if ttl <= 0 {
+		ttl = defaultDirectoryTTL
+	}
+
+	return &directory{
+		api:         api,
+		ttl:         ttl,
+		users:       map[string]cachedUser{},
+		usersByName: map[string]string{},
+		channels:    map[string]cachedChannel{},
+	}
+}
+
+// Warm loads every user and public channel, a page at a time.
+func (d *directory) Warm(ctx context.Context) error {
+	if err := d.warmUsers(ctx); err != nil {
+		return fmt.Errorf("Failed to warm users with error: %s", err)
+	}
+	if err := d.warmChannels(ctx); err != nil {
+		return fmt.Errorf("Failed to warm channels with error: %s", err)
+	}
+	return nil
+}
+
+func (d *directory) warmUsers(ctx context.Context) error {
+	var err error
+	p := d.api.GetUsersPaginated(slk.GetUsersOptionLimit(directoryPageSize))
+	for {
+		p, err = p.Next(ctx)
+		if err != nil {
+			if rateLimitedError, ok := err.(*slk.RateLimitedError); ok {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(rateLimitedError.RetryAfter):
+					continue
+				}
+			}
+			break
+		}
+		for i := range p.Users {
+			d.storeUser(&p.Users[i])
+		}
+	}
+
+	return p.Failure(err)
+}
+
+func (d *directory) warmChannels(ctx context.Context) error {
+	cursor := ""
+	for {
+		channels, nextCursor, err := d.api.GetConversationsContext(ctx, &slk.GetConversationsParameters{
+			Cursor:          cursor,
+			ExcludeArchived: true,
+			Limit:           directoryPageSize,
+			Types:           []string{"public_channel"},
+		})
+		if err != nil {
+			if rateLimitedError, ok := err.(*slk.RateLimitedError); ok {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(rateLimitedError.RetryAfter):
+					continue
+				}
+			}
+			return err
+		}
+		for i := range channels {
+			d.storeChannel(&channels[i])
+		}
+		if nextCursor == "" {
+			return nil
+		}
+		cursor = nextCursor
+	}
+}
+
+// User returns the user with the given ID, fetching it from Slack if it isn't
+// cached or has expired.
+func (d *directory) User(userID string) (*slk.User, error) {
+	d.mu.RLock()
+	entry, ok := d.users[userID]
+	d.mu.RUnlock()
+	if ok && time.Since(entry.fetched) < d.ttl {
+		return entry.user, nil
+	}
+
+	user, err := d.api.GetUserInfo(userID)
+	if err != nil {
+		return nil, err
+	}
+	d.storeUser(user)
+
+	return user, nil
+}
+
+// UserByName returns the user with the given Slack username. Names are only
+// known for users seen during warmup or fetched since.
+func (d *directory) UserByName(name string) (*slk.User, error) {
+	d.mu.RLock()
+	userID, ok := d.usersByName[name]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown user %s", name)
+	}
+
+	return d.User(userID)
+}
+
+// Channel returns the channel with the given ID, fetching it from Slack if it
+// isn't cached or has expired.
+func (d *directory) Channel(channelID string) (*slk.Channel, error) {
+	d.mu.RLock()
+	entry, ok := d.channels[channelID]
+	d.mu.RUnlock()
+	if ok && time.Since(entry.fetched) < d.ttl {
+		return entry.channel, nil
+	}
+
+	channel, err := d.api.GetConversationInfo(&slk.GetConversationInfoInput{ChannelID: channelID})
+	if err != nil {
+		return nil, err
+	}
+	d.storeChannel(channel)
+
+	return channel, nil
+}
+
+// InvalidateUser drops a cached user so the next lookup goes back to Slack.
+func (d *directory) InvalidateUser(userID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry, ok := d.users[userID]; ok {
+		delete(d.usersByName, entry.user.Name)
+	}
+	delete(d.users, userID)
+}
+
+// InvalidateChannel drops a cached channel so the next lookup goes back to Slack.
+func (d *directory) InvalidateChannel(channelID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.channels, channelID)
+}
+
+func (d *directory) storeUser(user *slk.User) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if previous, ok := d.users[user.ID]; ok && previous.user.Name != user.Name {
+		delete(d.usersByName, previous.user.Name)
+	}
+	d.users[user.ID] = cachedUser{user: user, fetched: time.Now()}
+	d.usersByName[user.Name] = user.ID
+}
+
+func (d *directory) storeChannel(channel *slk.Channel) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.channels[channel.ID] = cachedChannel{channel: channel, fetched: time.Now()}
+}
+
+// handleUserChange keeps the directory in step with profile edits.
+func (d *directory) handleUserChange(user *slk.User) {
+	log.Printf("user %s changed, refreshing directory entry", user.ID)
+	d.InvalidateUser(user.ID)
+	d.storeUser(user)
+}
+
+// handleChannelRename drops a renamed channel; its name is refetched lazily.
+func (d *directory) handleChannelRename(channelID string) {
+	log.Printf("channel %s renamed, invalidating directory entry", channelID)
+	d.InvalidateChannel(channelID)
+}
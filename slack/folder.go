@@ -0,0 +1,82 @@
+package slack
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+// maxArchivedFileSize is the largest Slack upload copied into a flare folder.
+const maxArchivedFileSize = 50 * 1024 * 1024
+
+// folderPin is the pin recording a flare channel's Drive folder.
+var folderPin = regexp.MustCompile("^Flare folder: (.*)")
+
+// flareFolderFor returns the ID of the Drive folder for a channel, or "" if
+// the channel doesn't have one.
+func (c *SlackClient) flareFolderFor(channelID string) (string, error) {
+	folderID, ok := c.cachedPin(c.flareFolderIDs, channelID)
+	if ok {
+		return folderID, nil
+	}
+
+	channel, err := c.directory.Channel(channelID)
+	if err != nil {
+		return "", err
+	}
+
+	folderID = ""
+	if regexp.MustCompile("^flare-").Match([]byte(channel.Name)) {
+		folderID = c.pinnedValue(channel, folderPin)
+	}
+
+	// And write it back for caching purposes.
+	c.cachePin(c.flareFolderIDs, channelID, folderID)
+
+	return folderID, nil
+}
+
+// archiveSlackFiles copies files shared in a flare channel into its folder, so
+// screenshots and logs outlive Slack's retention.
+func (c *SlackClient) archiveSlackFiles(message *Message) {
+	if len(message.Files) == 0 {
+		return
+	}
+
+	folderID, err := c.flareFolderFor(message.Channel)
+	if err != nil {
+		log.Printf("Unable to find flare folder: %s", err)
+		return
+	}
+	if folderID == "" {
+		return
+	}
+
+	for _, file := range message.Files {
+		if err := c.archiveSlackFile(file, folderID); err != nil {
+			log.Printf("Unable to archive %s in the flare folder: %s", file.Name, err)
+		}
+	}
+}
+
+func (c *SlackClient) archiveSlackFile(file slackevents.File, folderID string) error {
+	if file.Size > maxArchivedFileSize {
+		return fmt.Errorf("file is %d bytes, over the %d byte limit", file.Size, maxArchivedFileSize)
+	}
+
+	downloadURL := file.URLPrivateDownload
+	if downloadURL == "" {
+		downloadURL = file.URLPrivate
+	}
+
+	var content bytes.Buffer
+	if err := c.Client.GetFile(downloadURL, &content); err != nil {
+		return err
+	}
+
+	_, err := c.GoogleDocsServer.UploadFile(file.Name, file.Mimetype, &content, folderID)
+	return err
+}
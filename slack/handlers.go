@@ -3,17 +3,13 @@ package slack
 import (
 	"fmt"
 	"log"
-	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/modern-pet/flarebot/aws"
-	"github.com/modern-pet/flarebot/helpers"
+	"github.com/modern-pet/flarebot/flare"
 	"github.com/slack-go/slack"
 )
 
-var slackHistoryDocCache = map[string]string{}
-
 func (c *SlackClient) fireAFlareHandler(msg *Message, params [][]string) {
 	// wrong channel?
 	if msg.Channel != c.ExpectedChannel {
@@ -22,151 +18,69 @@ func (c *SlackClient) fireAFlareHandler(msg *Message, params [][]string) {
 
 	log.Printf("starting flare process. I was told %s", msg.Text)
 
-	c.Client.SetUserAsActive()
-
-	// retroactive?
-	isRetroactive := strings.Contains(msg.Text, "retroactive")
-	// preemptive?
-	isPreemptive := strings.Contains(msg.Text, "emptive") // this could be pre-emptive, or preemptive
-
-	if isRetroactive {
-		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("OK, let me quietly set up the Flare documents. Nobody freak out, this is retroactive.", false))
-	} else if isPreemptive {
-		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("OK, let me quietly set up the Flare documents. Nobody freak out, this is preemptive.", false))
-	} else {
-		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("OK, let me get my flaregun", false))
-	}
-
-	// for now matches are indexed
-	topic := params[0][2]
-
-	flareDocTitle := fmt.Sprintf("%s: %s", "Flare", topic)
-
-	if isRetroactive {
-		flareDocTitle = fmt.Sprintf("%s - Retroactive", flareDocTitle)
-	}
-
-	log.Printf("Attempting to create flare doc")
-	flareDoc, flareDocErr := c.GoogleDocsServer.CreateFromTemplate(flareDocTitle, c.GoogleFlareDocID, map[string]string{})
+	// for now matches are indexed: retroactive, preemptive (or pre-emptive),
+	// sensitive, priority and topic
+	c.Fire(&flare.Request{
+		ChannelID:   msg.Channel,
+		Priority:    fmt.Sprintf("P%s", params[0][4]),
+		Topic:       params[0][5],
+		Retroactive: params[0][1] != "",
+		Preemptive:  params[0][2] != "",
+		Sensitive:   params[0][3] != "",
+		ReporterID:  msg.AuthorId,
+	})
+}
 
-	if flareDocErr != nil {
-		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("I'm having trouble connecting to google docs right now, so I can't make a flare doc for tracking. I'll try my best to recover.", false))
-		log.Printf("No google flare doc created: %s", flareDocErr)
-	} else {
-		log.Printf("Flare doc created")
-	}
+// flareChannelCreated adds the Slack touches to a new Flare's channel: the
+// Slack log, the pins flarebot finds its files by, resources, the status
+// page offer and help.
+func (c *SlackClient) flareChannelCreated(fired *flare.Fired) {
+	c.Client.SetUserAsActive()
 
-	log.Printf("Attempting to create history doc")
-	slackHistoryDocTitle := fmt.Sprintf("%s: %s (Slack History)", "Flare", topic)
-	slackHistoryDoc, historyDocErr := c.GoogleDocsServer.CreateFromTemplate(slackHistoryDocTitle, c.GoogleSlackHistoryDocID, map[string]string{})
+	if fired.HistoryDoc != nil {
+		c.historyMu.Lock()
+		if err := c.ensureHistoryTab(fired.HistoryDoc, c.historyTabName(fired.StartTime, "")); err != nil {
+			log.Printf("Couldn't set up the slack history sheet: %s", err)
+		}
+		c.historyMu.Unlock()
 
-	if historyDocErr != nil {
-		log.Printf("No google slack history doc created: %s", historyDocErr)
-	} else {
-		log.Printf("Google slack history doc created")
+		c.cachePin(c.historyDocIDs, fired.ChannelID, fired.HistoryDoc.File.Id)
+		c.Client.PostMessage(fired.ChannelID, slack.MsgOptionText(fmt.Sprintf("Slack log: %s", fired.HistoryDoc.File.Id), false))
+		c.Client.AddPin(fired.ChannelID, slack.ItemRef{Comment: fmt.Sprintf("Slack log: %s", fired.HistoryDoc.File.Id)})
 	}
-
-	if flareDocErr == nil {
-		// update the google doc with some basic information
-		html, err := c.GoogleDocsServer.GetDocContent(flareDoc, "text/html")
-		if err != nil {
-			log.Printf("unexpected errror getting content from the flare doc: %s", err)
-		} else {
-			date, err := helpers.GetJakartaDateAndTime()
-			if err != nil {
-				log.Printf("Failed to get jakarta time now: %s", err)
-			}
-			html = strings.Replace(html, "[START-DATE]", date, 1)
-			html = strings.Replace(html, "[SUMMARY]", topic, 1)
-			html = strings.Replace(html, "[HISTORY-DOC]",
-				fmt.Sprintf(`<a href="%s">%s</a>`, slackHistoryDoc.File.AlternateLink, slackHistoryDocTitle), 1)
-
-			c.GoogleDocsServer.UpdateDocContent(flareDoc, html)
-
-			// update permissions
-			if err = c.GoogleDocsServer.ShareDocWithDomain(flareDoc, c.GoogleDomain, "writer"); err != nil {
-				// It's OK if we continue here, and don't error out
-				log.Printf("Couldn't share google flare doc: %s", err)
-			}
-			if err = c.GoogleDocsServer.ShareDocWithDomain(slackHistoryDoc, c.GoogleDomain, "writer"); err != nil {
-				// It's OK if we continue here, and don't error out
-				log.Printf("Couldn't share google slack history doc: %s", err)
-			}
-		}
+	if fired.Folder != nil {
+		c.cachePin(c.flareFolderIDs, fired.ChannelID, fired.Folder.File.Id)
+		c.Client.AddPin(fired.ChannelID, slack.ItemRef{Comment: fmt.Sprintf("Flare folder: %s", fired.Folder.File.Id)})
 	}
+	c.postFlareResources(fired.ChannelID, fired.Type, fired.Priority)
 
-	log.Printf("Attempting to create flare channel")
-	// set up the Flare room
-	channelID, err := aws.GetChannelIDFromS3()
-	if err != nil {
-		log.Printf("Failed to get channel id from S3 with error: %s", err)
+	// big Flares may need telling customers about
+	if !fired.Retroactive && (fired.Priority == "P0" || fired.Priority == "P1") {
+		c.offerStatusPageIncident(fired.ChannelID, fired.Priority, fired.Topic)
 	}
-	flareID := fmt.Sprintf("flare-%s", channelID)
-	log.Printf("Using channel ID: %s", flareID)
-	channel, channelErr := c.Client.CreateConversation(slack.CreateConversationParams{ChannelName: flareID, IsPrivate: false})
-	if channelErr != nil {
-		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("Slack is giving me some trouble right now, so I couldn't create a channel for you. It could be that the channel already exists, but hopefully no one did that already. If you need to make a new channel to discuss, please don't use the next flare-number channel, that'll confuse me later on.", false))
-		log.Printf("Couldn't create Flare channel: %s", channelErr)
-	} else {
-		log.Printf("Flare channel created")
-
-		if isRetroactive {
-			c.Client.PostMessage(channel.ID, slack.MsgOptionText("This is a RETROACTIVE Flare. All is well.", false))
-		}
-
-		c.Client.SetTopicOfConversation(channel.ID, topic)
-
-		if flareDocErr == nil {
-			c.Client.PostMessage(channel.ID, slack.MsgOptionText(fmt.Sprintf("Flare doc: %s", flareDoc.File.AlternateLink), false))
-		}
-		if historyDocErr == nil {
-			slackHistoryDocCache[channel.ID] = slackHistoryDoc.File.Id
-			c.Client.PostMessage(channel.ID, slack.MsgOptionText(fmt.Sprintf("Slack log: %s", slackHistoryDoc.File.Id), false))
-		}
-		c.Client.PostMessage(channel.ID, slack.MsgOptionText(fmt.Sprintf("Remember: Rollback, Scale or Restart!"), false))
-
-		if flareDocErr == nil {
-			c.Client.AddPin(channel.ID, slack.ItemRef{Comment: fmt.Sprintf("Flare doc: <%s>", flareDoc.File.AlternateLink)})
-		}
-		if historyDocErr == nil {
-			c.Client.AddPin(channel.ID, slack.ItemRef{Comment: fmt.Sprintf("Slack log: %s", slackHistoryDoc.File.Id)})
-		}
-		c.Client.AddPin(channel.ID, slack.ItemRef{Comment: fmt.Sprintf("Remember: Rollback, Scale or Restart!")})
-
-		// send room-specific help
-		c.sendHelpMessage(channel.ID, false)
 
-		// let people know that they can rename this channel
-		c.Client.PostMessage(channel.ID, slack.MsgOptionText(fmt.Sprintf("NOTE: you can rename this channel as long as it starts with %s", channel.Name), false))
-
-		// announce the specific Flare room in the overall Flares room
-		target := "channel"
-
-		if isRetroactive || isPreemptive {
-			author, _ := msg.AuthorUser()
-			target = author.Name
-		}
-
-		c.Client.PostMessage(msg.Channel, slack.MsgOptionText(fmt.Sprintf("<!%s>: Flare fired. Please visit <#%s> -- %s", target, channel.ID, topic), false))
-		if err = aws.IncrementChannelIDInS3(); err != nil {
-			log.Printf("Failed to increment channel id in S3 with error: %s", err)
-		}
-	}
+	// send room-specific help
+	c.sendHelpMessage(fired.ChannelID, false)
 }
 
 func (c *SlackClient) takingLeadHandler(msg *Message, params [][]string) {
-	author, _ := msg.AuthorUser()
-	c.Client.PostMessage(msg.Channel, slack.MsgOptionText(fmt.Sprintf("Oh Captain My Captain! <@%s> is now incident lead. Please confirm all actions with them.", author.ID), false))
+	c.TakeLead(msg.Channel, msg.AuthorId)
 }
 
 func (c *SlackClient) mitigateFlareHandler(msg *Message, params [][]string) {
-	c.Client.PostMessage(msg.Channel, slack.MsgOptionText("... and the Flare was mitigated, and there was much rejoicing throughout the land.", false))
-	c.Client.PostMessage(c.ExpectedChannel, slack.MsgOptionText("Flare has been mitigated", false))
+	c.Transition(msg.Channel, msg.authorName(), flare.StateMitigated)
 }
 
 func (c *SlackClient) notAFlareHandler(msg *Message, params [][]string) {
-	c.Client.PostMessage(msg.Channel, slack.MsgOptionText("turns out this is not a flare", false))
-	c.Client.PostMessage(c.ExpectedChannel, slack.MsgOptionText("turns out this is not a flare", false))
+	c.Transition(msg.Channel, msg.authorName(), flare.StateNotAFlare)
+}
+
+func (c *SlackClient) resolveFlareHandler(msg *Message, params [][]string) {
+	c.Transition(msg.Channel, msg.authorName(), flare.StateResolved)
+}
+
+func (c *SlackClient) startPostmortemHandler(msg *Message, params [][]string) {
+	c.StartPostmortem(msg.Channel)
 }
 
 func (c *SlackClient) helpHandler(msg *Message, params [][]string) {
@@ -202,69 +116,82 @@ func (c *SlackClient) sendCommandsHelpMessage(channel string, commands []*comman
 	}
 }
 
-func (c *SlackClient) recordSlackHistory(message *Message) error {
-	docID, ok := slackHistoryDocCache[message.Channel]
-	if !ok {
-		channel, err := c.Client.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: message.Channel})
-		if err != nil {
-			return err
+func (c *SlackClient) historyLastHandler(msg *Message, params [][]string) {
+	count, err := strconv.Atoi(params[0][1])
+	if err != nil || count <= 0 {
+		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("How many messages? e.g. history last 20", false))
+		return
+	}
+
+	c.sendHistoryExcerpt(msg.Channel, fmt.Sprintf("the last %d messages", count), func(entries []*historyEntry) []*historyEntry {
+		if len(entries) > count {
+			return entries[len(entries)-count:]
 		}
+		return entries
+	})
+}
 
-		docID = ""
-		if regexp.MustCompile("^flare-").Match([]byte(channel.Name)) {
-			// Get pinned link
-			historyPin := regexp.MustCompile("^Slack log: (.*)")
-			pins, _, err := c.Client.ListPins(message.Channel)
-			if err != nil {
-				// There might not be a pin in this channel, just ignore it.
-				fmt.Printf("Unable to get Slack log pin for %s, skipping\n", channel.Name)
-			} else {
-				for _, pin := range pins {
-					if len(historyPin.FindStringSubmatch(pin.Comment.Comment)) > 0 {
-						docID = historyPin.FindStringSubmatch(pin.Comment.Comment)[1]
-					}
-				}
+func (c *SlackClient) historyFromHandler(msg *Message, params [][]string) {
+	name := params[0][1]
+	if user, err := c.directory.User(name); err == nil {
+		name = user.Name
+	}
 
+	c.sendHistoryExcerpt(msg.Channel, fmt.Sprintf("messages from %s", name), func(entries []*historyEntry) []*historyEntry {
+		matching := []*historyEntry{}
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Author, name) {
+				matching = append(matching, entry)
 			}
 		}
+		return matching
+	})
+}
 
-		// And write it back for caching purposes.
-		slackHistoryDocCache[message.Channel] = docID
+func (c *SlackClient) historySinceHandler(msg *Message, params [][]string) {
+	hour, _ := strconv.Atoi(params[0][1])
+	minute, _ := strconv.Atoi(params[0][2])
+	if hour > 23 || minute > 59 {
+		c.Client.PostMessage(msg.Channel, slack.MsgOptionText("That doesn't look like a time, try e.g. history since 10:30", false))
+		return
 	}
 
-	// If there's no doc, don't record the history. Not all channels need one.
-	if docID == "" {
-		return nil
-	}
+	since := lastOccurrence(hour, minute)
 
-	msgTimestamp := strings.Split(message.Timestamp, ".")[0]
-	timestampInt, err := strconv.ParseInt(msgTimestamp, 10, 64)
-	if err != nil {
-		fmt.Printf("Failed to convert timestamp to int %s:", err)
-	}
-	jktTimestamp := helpers.UnixToJakartaTime(timestampInt)
-	author, err := message.Author()
-	if err != nil {
-		author = message.AuthorId
-	}
+	c.sendHistoryExcerpt(msg.Channel, fmt.Sprintf("messages since %s", since.Format("15:04 Jan 2")), func(entries []*historyEntry) []*historyEntry {
+		matching := []*historyEntry{}
+		for _, entry := range entries {
+			if !entry.Time.Before(since) {
+				matching = append(matching, entry)
+			}
+		}
+		return matching
+	})
+}
 
-	data := []interface{}{
-		jktTimestamp,
-		author,
-		message.Text,
+// sendHistoryExcerpt reads the channel's Slack log, narrows it with filter and
+// posts what's left.
+func (c *SlackClient) sendHistoryExcerpt(channel string, description string, filter func([]*historyEntry) []*historyEntry) {
+	entries, err := c.readSlackHistory(channel)
+	if err == errNoHistoryDoc {
+		c.Client.PostMessage(channel, slack.MsgOptionText("This channel doesn't have a Slack log, so I have no history to show.", false))
+		return
 	}
-
-	doc, err := c.GoogleDocsServer.GetDoc(docID)
 	if err != nil {
-		fmt.Println("Unable to find slack history doc")
-		return err
+		log.Printf("Unable to read slack history: %s", err)
+		c.Client.PostMessage(channel, slack.MsgOptionText(flare.GoogleErrorMessage(err, "read the Slack log"), false))
+		return
 	}
 
-	err = c.GoogleDocsServer.AppendSheetContent(doc, data)
-	if err != nil {
-		fmt.Printf("Unable to write slack history: %s", err)
-		return err
+	entries = filter(entries)
+	if len(entries) == 0 {
+		c.Client.PostMessage(channel, slack.MsgOptionText(fmt.Sprintf("I didn't find any %s in the Slack log.", description), false))
+		return
 	}
 
-	return nil
+	header := fmt.Sprintf("Here are %s from the Slack log:", description)
+	if len(entries) > historyExcerptMaxRows {
+		header = fmt.Sprintf("Here are %s from the Slack log (only the latest %d shown):", description, historyExcerptMaxRows)
+	}
+	c.Client.PostMessage(channel, slack.MsgOptionText(header+"\n"+formatHistoryExcerpt(entries), false), slack.MsgOptionDisableLinkUnfurl())
 }
@@ -0,0 +1,389 @@
+package slack
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/helpers"
+	"github.com/slack-go/slack"
+)
+
+// Columns of a row in the Slack history sheet.
+const (
+	historyColumnTime = iota
+	historyColumnAuthor
+	historyColumnText
+	historyColumnTs
+	historyColumnThreadTs
+	historyColumnSubType
+	historyColumnPermalink
+)
+
+// historyHeader titles the columns of the Slack history sheet.
+var historyHeader = []string{"Time", "Author", "Text", "Ts", "Thread ts", "Subtype", "Permalink"}
+
+var errNoHistoryDoc = errors.New("channel has no Slack history doc")
+
+// historyTimeFormat keeps milliseconds and is still parsed as a date by Sheets.
+// historySheetTimeFormat is the same format in Sheets' notation, so formatted
+// values read back the way they were written.
+const (
+	historyTimeFormat      = "2006-01-02 15:04:05.000"
+	historySheetTimeFormat = "yyyy-mm-dd hh:mm:ss.000"
+)
+
+// historySheetTab is the layout of a tab of the Slack history sheet.
+func historySheetTab(name string) *googledocs.SheetTab {
+	return &googledocs.SheetTab{
+		Name:             name,
+		Header:           historyHeader,
+		ColumnWidths:     []int64{170, 120, 600, 150, 150, 100, 300},
+		TimestampColumns: []int{historyColumnTime},
+		TimestampFormat:  historySheetTimeFormat,
+	}
+}
+
+// historyTabName is the tab of the history sheet a message is written to, from
+// HISTORY_SHEET_TAB: {date} is replaced with the day the message was posted
+// and {thread} with the ts of its thread, or "channel" if it isn't in one.
+func (c *SlackClient) historyTabName(msgTime time.Time, threadTimestamp string) string {
+	thread := "channel"
+	if threadTimestamp != "" {
+		thread = threadTimestamp
+	}
+
+	return strings.NewReplacer(
+		"{date}", msgTime.In(helpers.JakartaLocation()).Format("2006-01-02"),
+		"{thread}", thread,
+	).Replace(c.HistorySheetTab)
+}
+
+// ensureHistoryTab sets up a tab of the history sheet the first time it's
+// written to. Callers must hold historyMu.
+func (c *SlackClient) ensureHistoryTab(doc *googledocs.Doc, tab string) error {
+	key := doc.File.Id + "/" + tab
+	if c.historyTabs[key] {
+		return nil
+	}
+
+	if err := c.GoogleDocsServer.EnsureSheetTab(doc, historySheetTab(tab)); err != nil {
+		return err
+	}
+	c.historyTabs[key] = true
+
+	return nil
+}
+
+// historyRows returns the rows of every tab of a history sheet.
+func (c *SlackClient) historyRows(doc *googledocs.Doc) ([][]interface{}, error) {
+	tabs, err := c.GoogleDocsServer.GetSheetTabs(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]interface{}{}
+	for _, tab := range tabs {
+		content, err := c.GoogleDocsServer.GetSheetContent(doc, tab)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, content.Values...)
+	}
+
+	return rows, nil
+}
+
+// historyPin is the pin recording a flare channel's Slack history sheet.
+var historyPin = regexp.MustCompile("^Slack log: (.*)")
+
+// pinnedValue returns the first group of pattern in the last of the channel's
+// pins it matches, or "".
+func (c *SlackClient) pinnedValue(channel *slack.Channel, pattern *regexp.Regexp) string {
+	value := ""
+	pins, _, err := c.Client.ListPins(channel.ID)
+	if err != nil {
+		// There might not be a pin in this channel, just ignore it.
+		fmt.Printf("Unable to get pins for %s, skipping\n", channel.Name)
+		return ""
+	}
+	for _, pin := range pins {
+		if pin.Comment == nil {
+			continue
+		}
+		if match := pattern.FindStringSubmatch(pin.Comment.Comment); len(match) > 1 {
+			value = match[1]
+		}
+	}
+
+	return value
+}
+
+// cachedPin returns a channel's value from one of the pin caches, e.g.
+// historyDocIDs.
+func (c *SlackClient) cachedPin(cache map[string]string, channelID string) (string, bool) {
+	c.pinsMu.Lock()
+	defer c.pinsMu.Unlock()
+	value, ok := cache[channelID]
+	return value, ok
+}
+
+// cachePin stores a channel's value in one of the pin caches.
+func (c *SlackClient) cachePin(cache map[string]string, channelID string, value string) {
+	c.pinsMu.Lock()
+	defer c.pinsMu.Unlock()
+	cache[channelID] = value
+}
+
+// historyDocFor returns the ID of the Slack history sheet for a channel, or ""
+// if the channel doesn't have one.
+func (c *SlackClient) historyDocFor(channelID string) (string, error) {
+	docID, ok := c.cachedPin(c.historyDocIDs, channelID)
+	if ok {
+		return docID, nil
+	}
+
+	channel, err := c.directory.Channel(channelID)
+	if err != nil {
+		return "", err
+	}
+
+	docID = ""
+	if regexp.MustCompile("^flare-").Match([]byte(channel.Name)) {
+		docID = c.pinnedValue(channel, historyPin)
+	}
+
+	// And write it back for caching purposes.
+	c.cachePin(c.historyDocIDs, channelID, docID)
+
+	return docID, nil
+}
+
+func (c *SlackClient) recordSlackHistory(message *Message) error {
+	docID, err := c.historyDocFor(message.Channel)
+	if err != nil {
+		return err
+	}
+
+	// If there's no doc, don't record the history. Not all channels need one.
+	if docID == "" {
+		return nil
+	}
+
+	doc, err := c.GoogleDocsServer.GetDoc(docID)
+	if err != nil {
+		fmt.Println("Unable to find slack history doc")
+		return err
+	}
+
+	// Slack retries events it thinks we missed; the ts makes sure a retried
+	// message never becomes a second row.
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	recorded, err := c.recordedHistoryFor(message.Channel, doc)
+	if err != nil {
+		fmt.Printf("Unable to read slack history: %s\n", err)
+		return err
+	}
+	if recorded[message.Timestamp] {
+		fmt.Printf("Message %s already recorded, skipping\n", message.Timestamp)
+		return nil
+	}
+
+	msgTime, err := helpers.SlackTimestampToJakartaTime(message.Timestamp)
+	if err != nil {
+		fmt.Printf("Failed to parse message timestamp %s: %s\n", message.Timestamp, err)
+	}
+	author, err := message.Author()
+	if err != nil {
+		author = message.AuthorId
+	}
+
+	text, redactions := c.Redactor.Redact(message.Text)
+	c.ReportRedactions(message.Channel, fmt.Sprintf("%s's message", author), redactions)
+
+	data := make([]interface{}, historyColumnPermalink+1)
+	data[historyColumnTime] = msgTime.Format(historyTimeFormat)
+	data[historyColumnAuthor] = author
+	data[historyColumnText] = text
+	// a leading ' keeps Sheets from turning the ts into a lossy number
+	data[historyColumnTs] = "'" + message.Timestamp
+	data[historyColumnThreadTs] = ""
+	if message.ThreadTimestamp != "" {
+		data[historyColumnThreadTs] = "'" + message.ThreadTimestamp
+	}
+	data[historyColumnSubType] = message.SubType
+	data[historyColumnPermalink] = c.permalink(message)
+
+	tab := c.historyTabName(msgTime, message.ThreadTimestamp)
+	if err = c.ensureHistoryTab(doc, tab); err != nil {
+		// the row is still worth writing without the header
+		fmt.Printf("Unable to set up slack history tab %s: %s\n", tab, err)
+	}
+
+	err = c.GoogleDocsServer.AppendSheetContent(doc, tab, data)
+	if err != nil {
+		fmt.Printf("Unable to write slack history: %s", err)
+		return err
+	}
+	recorded[message.Timestamp] = true
+
+	return nil
+}
+
+// recordedHistoryFor returns the set of message timestamps already in the
+// history sheet, reading them from the sheet the first time a channel is seen
+// so restarts don't lose track. Callers must hold historyMu.
+func (c *SlackClient) recordedHistoryFor(channelID string, doc *googledocs.Doc) (map[string]bool, error) {
+	if recorded, ok := c.recordedHistory[channelID]; ok {
+		return recorded, nil
+	}
+
+	rows, err := c.historyRows(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := map[string]bool{}
+	for _, row := range rows {
+		if len(row) > historyColumnTs {
+			if ts, ok := row[historyColumnTs].(string); ok && ts != "" {
+				recorded[ts] = true
+			}
+		}
+	}
+	c.recordedHistory[channelID] = recorded
+
+	return recorded, nil
+}
+
+// permalink builds a link to the message from its ts, falling back to asking
+// Slack when SLACK_DOMAIN isn't configured.
+func (c *SlackClient) permalink(message *Message) string {
+	if c.SlackDomain == "" {
+		link, err := c.Client.GetPermalink(&slack.PermalinkParameters{Channel: message.Channel, Ts: message.Timestamp})
+		if err != nil {
+			fmt.Printf("Unable to get permalink for %s: %s\n", message.Timestamp, err)
+			return ""
+		}
+		return link
+	}
+
+	link := fmt.Sprintf("%s/archives/%s/p%s", c.SlackDomain, message.Channel, strings.Replace(message.Timestamp, ".", "", 1))
+	if message.ThreadTimestamp != "" && message.ThreadTimestamp != message.Timestamp {
+		link = fmt.Sprintf("%s?thread_ts=%s&cid=%s", link, message.ThreadTimestamp, message.Channel)
+	}
+
+	return link
+}
+
+// historyExcerptMaxRows caps how much history a single reply can dump into the
+// channel.
+const historyExcerptMaxRows = 50
+
+// historyExcerptMaxText is how much of each message is shown in an excerpt.
+const historyExcerptMaxText = 200
+
+// historyEntry is one row of the Slack history sheet.
+type historyEntry struct {
+	Time      time.Time
+	Author    string
+	Text      string
+	Permalink string
+}
+
+// readSlackHistory returns every row of a channel's Slack history sheet, oldest
+// first.
+func (c *SlackClient) readSlackHistory(channelID string) ([]*historyEntry, error) {
+	docID, err := c.historyDocFor(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if docID == "" {
+		return nil, errNoHistoryDoc
+	}
+
+	doc, err := c.GoogleDocsServer.GetDoc(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.historyRows(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*historyEntry{}
+	for _, row := range rows {
+		entry := rowToHistoryEntry(row)
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// rowToHistoryEntry parses a sheet row, returning nil for rows that aren't
+// messages (e.g. a header). Older rows have no ts, so the time column is the
+// fallback.
+func rowToHistoryEntry(row []interface{}) *historyEntry {
+	cell := func(i int) string {
+		if i < len(row) {
+			if s, ok := row[i].(string); ok {
+				return s
+			}
+		}
+		return ""
+	}
+
+	entry := &historyEntry{
+		Author:    cell(historyColumnAuthor),
+		Text:      cell(historyColumnText),
+		Permalink: cell(historyColumnPermalink),
+	}
+
+	if t, err := helpers.SlackTimestampToJakartaTime(cell(historyColumnTs)); err == nil {
+		entry.Time = t
+		return entry
+	}
+	for _, layout := range []string{historyTimeFormat, time.RFC3339Nano, "2006-01-02 15:04:05 -0700 MST", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, cell(historyColumnTime), helpers.JakartaLocation()); err == nil {
+			entry.Time = t
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// formatHistoryExcerpt renders entries as one compact Slack message.
+func formatHistoryExcerpt(entries []*historyEntry) string {
+	if len(entries) > historyExcerptMaxRows {
+		entries = entries[len(entries)-historyExcerptMaxRows:]
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		text := strings.Join(strings.Fields(entry.Text), " ")
+		if runes := []rune(text); len(runes) > historyExcerptMaxText {
+			text = string(runes[:historyExcerptMaxText]) + "…"
+		}
+
+		stamp := entry.Time.Format("15:04:05")
+		if entry.Permalink != "" {
+			stamp = fmt.Sprintf("<%s|%s>", entry.Permalink, stamp)
+		}
+		lines = append(lines, fmt.Sprintf("`%s` *%s*: %s", stamp, entry.Author, text))
+	}
+
+	return strings.Join(lines, "\n")
+}
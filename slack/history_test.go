@@ -0,0 +1,58 @@
+package slack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/modern-pet/flarebot/flare"
+	"github.com/modern-pet/flarebot/googledocs"
+	slk "github.com/slack-go/slack"
+)
+
+func TestRecordSlackHistory(t *testing.T) {
+	docs := googledocs.NewFakeGoogleDocsServer()
+	historyDoc, err := docs.CreateFromTemplate("Flare: checkout is down (Slack History)", "history-template", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := newDirectory(nil, 0)
+	directory.storeUser(&slk.User{ID: "U1", Name: "ada"})
+	directory.storeUser(&slk.User{ID: "U2", Name: "grace"})
+	c := &SlackClient{
+		Service:         flare.New(nil, docs, &flare.Config{}),
+		HistorySheetTab: "{date}",
+		SlackDomain:     "https://modernpet.slack.com",
+		directory:       directory,
+		recordedHistory: map[string]map[string]bool{},
+		historyTabs:     map[string]bool{},
+		historyDocIDs:   map[string]string{},
+	}
+	c.cachePin(c.historyDocIDs, "C1", historyDoc.File.Id)
+
+	messages := []*Message{
+		{AuthorId: "U1", Timestamp: "1700000000.000100", Text: "checkout is down", Channel: "C1", directory: directory},
+		{AuthorId: "U2", Timestamp: "1700000060.000200", ThreadTimestamp: "1700000000.000100", SubType: "thread_broadcast", Text: "looking", Channel: "C1", directory: directory},
+		// Slack retrying the first message
+		{AuthorId: "U1", Timestamp: "1700000000.000100", Text: "checkout is down", Channel: "C1", directory: directory},
+	}
+	for _, message := range messages {
+		if err := c.recordSlackHistory(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := docs.FakeDoc(historyDoc.File.Id)
+	rows := fake.Tabs["2023-11-15"]
+	want := [][]interface{}{
+		{"Time", "Author", "Text", "Ts", "Thread ts", "Subtype", "Permalink"},
+		{"2023-11-15 05:13:20.000", "ada", "checkout is down", "1700000000.000100", "", "", "https://modernpet.slack.com/archives/C1/p1700000000000100"},
+		{"2023-11-15 05:14:20.000", "grace", "looking", "1700000060.000200", "1700000000.000100", "thread_broadcast", "https://modernpet.slack.com/archives/C1/p1700000060000200?thread_ts=1700000000.000100&cid=C1"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("history rows\n%v\nwant\n%v", rows, want)
+	}
+	if layout := fake.Layouts["2023-11-15"]; layout == nil || !reflect.DeepEqual(layout.Header, historyHeader) {
+		t.Errorf("the tab wasn't laid out: %+v", layout)
+	}
+}
@@ -8,12 +8,18 @@ import (
 )
 
 type Message struct {
-	AuthorId  string
-	Timestamp string
-	Text      string
-	Channel   string
-	api       *slk.Client
-	sender    func(string, string)
+	AuthorId string
+	// Timestamp is the message ts, which also identifies the message within
+	// its channel.
+	Timestamp       string
+	ThreadTimestamp string
+	ClientMsgID     string
+	SubType         string
+	Text            string
+	Files           []slackevents.File
+	Channel         string
+	directory       *directory
+	sender          func(string, string)
 }
 
 func (m *Message) Author() (string, error) {
@@ -24,8 +30,18 @@ func (m *Message) Author() (string, error) {
 	return user.Name, nil
 }
 
+// authorName is the author's Slack name, or their ID if they can't be looked
+// up.
+func (m *Message) authorName() string {
+	author, err := m.Author()
+	if err != nil {
+		return m.AuthorId
+	}
+	return author
+}
+
 func (m *Message) AuthorUser() (*slk.User, error) {
-	user, err := m.api.GetUserInfo(m.AuthorId)
+	user, err := m.directory.User(m.AuthorId)
 	if err != nil {
 		return nil, err
 	}
@@ -33,13 +49,17 @@ func (m *Message) AuthorUser() (*slk.User, error) {
 	return user, nil
 }
 
-func messageEventToMessage(evt *slackevents.MessageEvent, api *slk.Client) *Message {
+func messageEventToMessage(evt *slackevents.MessageEvent, directory *directory) *Message {
 	return &Message{
-		AuthorId:  evt.User,
-		Timestamp: evt.EventTimeStamp,
-		Text:      evt.Text,
-		Channel:   evt.Channel,
-		api:       api,
+		AuthorId:        evt.User,
+		Timestamp:       evt.TimeStamp,
+		ThreadTimestamp: evt.ThreadTimeStamp,
+		ClientMsgID:     evt.ClientMsgID,
+		SubType:         evt.SubType,
+		Text:            evt.Text,
+		Files:           evt.Files,
+		Channel:         evt.Channel,
+		directory:       directory,
 	}
 }
 
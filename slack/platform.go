@@ -0,0 +1,186 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/modern-pet/flarebot/flare"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// Platform is Slack as a flare.ChatPlatform.
+type Platform struct {
+	Client *socketmode.Client
+	// SlackDomain is the workspace URL, e.g. https://modernpet.slack.com, for
+	// channel links. Without it links go through slack.com.
+	SlackDomain string
+	directory   *directory
+}
+
+// NewPlatformFromEnv connects to the Slack workspace of the
+// SLACK_FLAREBOT_*_ACCESS_TOKEN tokens, and loads its people and channels.
+func NewPlatformFromEnv() (*Platform, error) {
+	appToken := os.Getenv("SLACK_FLAREBOT_APP_ACCESS_TOKEN")
+	if appToken == "" {
+		return nil, errors.New("SLACK_FLAREBOT_APP_ACCESS_TOKEN must be set")
+	}
+
+	if !strings.HasPrefix(appToken, "xapp-") {
+		return nil, errors.New("SLACK_FLAREBOT_APP_ACCESS_TOKEN must have the prefix \"xapp-\".")
+	}
+
+	botToken := os.Getenv("SLACK_FLAREBOT_BOT_ACCESS_TOKEN")
+	if botToken == "" {
+		return nil, errors.New("SLACK_FLAREBOT_BOT_ACCESS_TOKEN must be set.")
+	}
+
+	if !strings.HasPrefix(botToken, "xoxb-") {
+		return nil, errors.New("SLACK_FLAREBOT_BOT_ACCESS_TOKEN must have the prefix \"xoxb-\".")
+	}
+
+	api := slack.New(
+		botToken,
+		slack.OptionDebug(true),
+		slack.OptionAppLevelToken(appToken),
+		slack.OptionLog(log.New(os.Stdout, "api: ", log.Lshortfile|log.LstdFlags)),
+	)
+
+	client := socketmode.New(
+		api,
+		socketmode.OptionDebug(true),
+		socketmode.OptionLog(log.New(os.Stdout, "socketmode: ", log.Lshortfile|log.LstdFlags)),
+	)
+
+	directoryTTL := defaultDirectoryTTL
+	if ttl := os.Getenv("SLACK_DIRECTORY_TTL"); ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("SLACK_DIRECTORY_TTL is not a valid duration: %s", err)
+		}
+		directoryTTL = parsed
+	}
+
+	directory := newDirectory(api, directoryTTL)
+	if err := directory.Warm(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &Platform{
+		Client:      client,
+		SlackDomain: strings.TrimSuffix(os.Getenv("SLACK_DOMAIN"), "/"),
+		directory:   directory,
+	}, nil
+}
+
+func (p *Platform) Name() string {
+	return "Slack"
+}
+
+func (p *Platform) PostMessage(channelID string, text string) (string, error) {
+	_, timestamp, err := p.Client.PostMessage(channelID, slack.MsgOptionText(text, false))
+	return timestamp, err
+}
+
+func (p *Platform) Pin(channelID string, messageID string) error {
+	return p.Client.AddPin(channelID, slack.NewRefToMessage(channelID, messageID))
+}
+
+func (p *Platform) CreateChannel(name string) (*flare.Channel, error) {
+	channel, err := p.Client.CreateConversation(slack.CreateConversationParams{ChannelName: name, IsPrivate: false})
+	if err != nil {
+		return nil, err
+	}
+	return flareChannel(channel), nil
+}
+
+func (p *Platform) SetTopic(channelID string, topic string) error {
+	_, err := p.Client.SetTopicOfConversation(channelID, topic)
+	return err
+}
+
+func (p *Platform) Invite(channelID string, userIDs ...string) error {
+	_, err := p.Client.InviteUsersToConversation(channelID, userIDs...)
+	return err
+}
+
+func (p *Platform) Channel(channelID string) (*flare.Channel, error) {
+	channel, err := p.directory.Channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return flareChannel(channel), nil
+}
+
+func (p *Platform) ChannelMembers(channelID string) ([]*flare.User, error) {
+	users := []*flare.User{}
+	params := &slack.GetUsersInConversationParameters{ChannelID: channelID, Limit: directoryPageSize}
+	for {
+		members, cursor, err := p.Client.GetUsersInConversation(params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range members {
+			user, err := p.directory.User(id)
+			if err != nil {
+				log.Printf("Couldn't look up channel member %s: %s", id, err)
+				continue
+			}
+			users = append(users, flareUser(user))
+		}
+
+		if cursor == "" {
+			return users, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+func (p *Platform) User(userID string) (*flare.User, error) {
+	user, err := p.directory.User(userID)
+	if err != nil {
+		return nil, err
+	}
+	return flareUser(user), nil
+}
+
+func (p *Platform) UserByName(name string) (*flare.User, error) {
+	user, err := p.directory.UserByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return flareUser(user), nil
+}
+
+func (p *Platform) ChannelLink(channelID string) string {
+	if p.SlackDomain == "" {
+		return fmt.Sprintf("https://slack.com/app_redirect?channel=%s", channelID)
+	}
+	return fmt.Sprintf("%s/archives/%s", p.SlackDomain, channelID)
+}
+
+func (p *Platform) MentionChannel(channelID string) string {
+	return fmt.Sprintf("<#%s>", channelID)
+}
+
+func (p *Platform) MentionUser(userID string) string {
+	return fmt.Sprintf("<@%s>", userID)
+}
+
+func (p *Platform) MentionEveryone() string {
+	return "<!channel>"
+}
+
+func flareUser(user *slack.User) *flare.User {
+	return &flare.User{ID: user.ID, Name: user.Name, Email: user.Profile.Email, IsBot: user.IsBot}
+}
+
+func flareChannel(channel *slack.Channel) *flare.Channel {
+	return &flare.Channel{ID: channel.ID, Name: channel.Name, Topic: channel.Topic.Value}
+}
@@ -0,0 +1,71 @@
+package slack
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/modern-pet/flarebot/resources"
+	"github.com/slack-go/slack"
+)
+
+// resourcesBlocks lays out a Flare's resources as one message.
+func resourcesBlocks(res *resources.Resources) []slack.Block {
+	blocks := []slack.Block{}
+	section := func(text string) {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+	list := func(title string, bullet string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		section(fmt.Sprintf("*%s*\n%s %s", title, bullet, strings.Join(items, "\n"+bullet+" ")))
+	}
+	links := func(links []resources.Link) []string {
+		items := make([]string, 0, len(links))
+		for _, link := range links {
+			title := link.Title
+			if title == "" {
+				title = link.URL
+			}
+			items = append(items, fmt.Sprintf("<%s|%s>", link.URL, title))
+		}
+		return items
+	}
+
+	if res.Reminder != "" {
+		section(fmt.Sprintf("*Remember: %s*", res.Reminder))
+	}
+	if res.URL != "" {
+		section(fmt.Sprintf("*Flare resources:* %s", res.URL))
+	}
+	list("Runbooks", "•", links(res.Runbooks))
+	list("Dashboards", "•", links(res.Dashboards))
+	list("Escalation", "•", res.Escalation)
+	list("Checklist", ":white_large_square:", res.Checklist)
+
+	return blocks
+}
+
+// postFlareResources posts and pins the resources for a Flare of the given
+// type and priority in its channel.
+func (c *SlackClient) postFlareResources(channelID string, flareType string, priority string) {
+	res := c.Resources.For(flareType, priority)
+	if res.Empty() {
+		return
+	}
+
+	fallback := "Flare resources"
+	if res.Reminder != "" {
+		fallback = fmt.Sprintf("Remember: %s", res.Reminder)
+	}
+
+	_, ts, err := c.Client.PostMessage(channelID, slack.MsgOptionText(fallback, false), slack.MsgOptionBlocks(resourcesBlocks(res)...), slack.MsgOptionDisableLinkUnfurl())
+	if err != nil {
+		log.Printf("Couldn't post the Flare resources: %s", err)
+		return
+	}
+	if err = c.Client.AddPin(channelID, slack.NewRefToMessage(channelID, ts)); err != nil {
+		log.Printf("Couldn't pin the Flare resources: %s", err)
+	}
+}
@@ -1,14 +1,14 @@
 package slack
 
 import (
-	"errors"
 	"fmt"
-	"log"
 	"os"
 	"regexp"
-	"strings"
+	"sync"
 
-	"github.com/modern-pet/flarebot/googledocs"
+	"github.com/modern-pet/flarebot/alertmanager"
+	"github.com/modern-pet/flarebot/flare"
+	"github.com/modern-pet/flarebot/resources"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
@@ -25,7 +25,7 @@ type command struct {
 }
 
 var fireFlareCommand = &command{
-	regexp:      "[fF]ire (?:a )?(?:retroactive )?(?:.+emptive )?[fF]lare [pP]([012]) *(.*)",
+	regexp:      "[fF]ire (?:a )?((?i:retroactive) )?((?i:.+emptive) )?((?i:sensitive) )?[fF]lare [pP]([012]) *(.*)",
 	example:     "fire a flare p2 there is still no hottub on the roof",
 	description: "Fire a new Flare with the given priority and description",
 }
@@ -48,6 +48,48 @@ var flareMitigatedCommand = &command{
 	description: "Mark the Flare mitigated.",
 }
 
+var flareResolvedCommand = &command{
+	regexp:      "([Ff]lare )?(is )?resolved",
+	example:     "flare resolved",
+	description: "Mark the Flare resolved and start its postmortem doc.",
+}
+
+var startPostmortemCommand = &command{
+	regexp:      "[Ss]tart (?:a )?postmortem",
+	example:     "start postmortem",
+	description: "Start the postmortem doc for this Flare.",
+}
+
+var priorityCommand = &command{
+	regexp:      "[Pp]riority (?:is )?(?:now )?[pP]([012])",
+	example:     "priority p1",
+	description: "Change the priority of the Flare.",
+}
+
+var roleCommand = &command{
+	regexp:      "(<@\\w+(?:\\|[^>]*)?> is|[iI](?:'m| am)) (?:the )?([A-Za-z]+) lead",
+	example:     "@ben is comms lead",
+	description: "Give yourself or someone else a role, e.g. I am comms lead.",
+}
+
+var timelineCommand = &command{
+	regexp:      "[Tt]imeline (?:at (\\d{1,2}):(\\d{2}) )?(.+)",
+	example:     "timeline at 10:45 error rates are up in the oauth service",
+	description: "Add an event to the timeline in the Flare doc. Without a time, it's logged now.",
+}
+
+var statusPageOpenCommand = &command{
+	regexp:      "[Ss]tatus ?page open",
+	example:     "statuspage open",
+	description: "Open a public incident for this Flare on the status page.",
+}
+
+var statusPageUpdateCommand = &command{
+	regexp:      "[Ss]tatus ?page update (.+)",
+	example:     "statuspage update We've identified the issue and are rolling out a fix.",
+	description: "Post a public update to this Flare's status page incident.",
+}
+
 // not a flare
 var notAFlareCommand = &command{
 	regexp:      "([Ff]lare )?(is )?not a [Ff]lare",
@@ -55,6 +97,24 @@ var notAFlareCommand = &command{
 	description: "Mark the Flare not-a-flare.",
 }
 
+var historyLastCommand = &command{
+	regexp:      "[Hh]istory last (\\d+)",
+	example:     "history last 20",
+	description: "Show the last messages from the Slack log.",
+}
+
+var historyFromCommand = &command{
+	regexp:      "[Hh]istory from <?@?([^>|\\s]+)(?:\\|[^>]*)?>?",
+	example:     "history from @ben",
+	description: "Show the messages someone posted in this Flare.",
+}
+
+var historySinceCommand = &command{
+	regexp:      "[Hh]istory since (\\d{1,2}):(\\d{2})",
+	example:     "history since 10:30",
+	description: "Show the messages posted since a time (Jakarta time).",
+}
+
 // help command
 var helpCommand = &command{
 	regexp:      "[Hh]elp *$",
@@ -70,75 +130,87 @@ var helpAllCommand = &command{
 }
 
 var mainChannelCommands = []*command{helpCommand, helpAllCommand, fireFlareCommand}
-var flareChannelCommands = []*command{helpCommand, takingLeadCommand, flareMitigatedCommand, notAFlareCommand}
+var flareChannelCommands = []*command{helpCommand, takingLeadCommand, roleCommand, priorityCommand, timelineCommand, statusPageOpenCommand, statusPageUpdateCommand, flareMitigatedCommand, flareResolvedCommand, notAFlareCommand, startPostmortemCommand, historyLastCommand, historyFromCommand, historySinceCommand}
 var otherChannelCommands = []*command{helpAllCommand}
 
+// SlackClient is the Slack front end to the Flare workflow: it turns
+// messages and buttons into calls on the flare.Service, and keeps the Slack
+// log of Flare channels.
 type SlackClient struct {
-	Client                  *socketmode.Client
-	Username                string
-	UserID                  string
-	ExpectedChannel         string
-	GoogleDocsServer        *googledocs.GoogleDocsServer
-	GoogleDomain            string
-	GoogleFlareDocID        string
-	GoogleSlackHistoryDocID string
-	handlers                []*MessageHandler
-}
-
-func NewSlackClient(username string, expectedChannel string, googleDocsServer *googledocs.GoogleDocsServer, googleDomain string, googleFlareDocID string, googleSlackHistoryDocID string) (*SlackClient, error) {
-	appToken := os.Getenv("SLACK_FLAREBOT_APP_ACCESS_TOKEN")
-	if appToken == "" {
-		return nil, errors.New("SLACK_FLAREBOT_APP_ACCESS_TOKEN must be set")
-	}
-
-	if !strings.HasPrefix(appToken, "xapp-") {
-		return nil, errors.New("SLACK_FLAREBOT_APP_ACCESS_TOKEN must have the prefix \"xapp-\".")
-	}
-
-	botToken := os.Getenv("SLACK_FLAREBOT_BOT_ACCESS_TOKEN")
-	if botToken == "" {
-		return nil, errors.New("SLACK_FLAREBOT_BOT_ACCESS_TOKEN must be set.")
-	}
-
-	if !strings.HasPrefix(botToken, "xoxb-") {
-		return nil, errors.New("SLACK_FLAREBOT_BOT_ACCESS_TOKEN must have the prefix \"xoxb-\".")
-	}
-
-	api := slack.New(
-		botToken,
-		slack.OptionDebug(true),
-		slack.OptionAppLevelToken(appToken),
-		slack.OptionLog(log.New(os.Stdout, "api: ", log.Lshortfile|log.LstdFlags)),
-	)
-
-	client := socketmode.New(
-		api,
-		socketmode.OptionDebug(true),
-		socketmode.OptionLog(log.New(os.Stdout, "socketmode: ", log.Lshortfile|log.LstdFlags)),
-	)
+	*flare.Service
+	Client          *socketmode.Client
+	Username        string
+	UserID          string
+	ExpectedChannel string
+	HistorySheetTab string
+	SlackDomain     string
+	Resources       *resources.Sets
+	handlers        []*MessageHandler
+	directory       *directory
+
+	// AlertRules decide which Alertmanager alerts become Flares.
+	AlertRules alertmanager.Rules
+
+	// Alert groups flarebot knows about, by group ID. Notifications arrive
+	// from the HTTP server while Slack events are handled, so they're behind
+	// alertGroupsMu.
+	alertGroupsMu sync.Mutex
+	// alertGroupChannels are the channels of Flares fired for alert groups.
+	// The alert_group appProperty has them too, for after a restart.
+	alertGroupChannels map[string]string
+	alertPrompts       map[string]*alertPrompt
+	// firingAlertGroups have a Flare being fired for them, which takes a
+	// while. Notifications arriving meanwhile wait here for its channel.
+	firingAlertGroups map[string][]*alertmanager.Notification
+	// dismissedAlertGroups aren't asked about again until they resolve.
+	dismissedAlertGroups map[string]bool
+
+	historyMu       sync.Mutex
+	recordedHistory map[string]map[string]bool
+	historyTabs     map[string]bool
+
+	// historyDocIDs and flareFolderIDs cache the files pinned in Flare
+	// channels. Flares fired from alerts and the API add to them from other
+	// goroutines, so they're behind pinsMu.
+	pinsMu         sync.Mutex
+	historyDocIDs  map[string]string
+	flareFolderIDs map[string]string
+}
 
-	users, err := api.GetUsers()
+// NewSlackClient runs service's Flare workflow on platform, whose Flares
+// channel is service.FlaresChannel.
+func NewSlackClient(username string, platform *Platform, service *flare.Service, resourceSets *resources.Sets, alertRules alertmanager.Rules) (*SlackClient, error) {
+	// commands mention the bot by ID, and its own messages are skipped by it
+	user, err := platform.directory.UserByName(username)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get users with error: %s", err)
-	}
-	var userId string
-	for _, user := range users {
-		if user.Name == username {
-			userId = user.ID
-			break
-		}
+		return nil, fmt.Errorf("Failed to find the Slack user %s with error: %s", username, err)
 	}
+	userId := user.ID
 
+	client := platform.Client
+	directory := platform.directory
 	slackClient := &SlackClient{
-		Client:                  client,
-		Username:                username,
-		UserID:                  userId,
-		ExpectedChannel:         expectedChannel,
-		GoogleDocsServer:        googleDocsServer,
-		GoogleDomain:            googleDomain,
-		GoogleFlareDocID:        googleFlareDocID,
-		GoogleSlackHistoryDocID: googleSlackHistoryDocID,
+		Service:         service,
+		Client:          client,
+		Username:        username,
+		UserID:          userId,
+		ExpectedChannel: service.FlaresChannel,
+		HistorySheetTab: os.Getenv("HISTORY_SHEET_TAB"),
+		SlackDomain:     platform.SlackDomain,
+		Resources:       resourceSets,
+		AlertRules:      alertRules,
+		directory:       directory,
+		recordedHistory: map[string]map[string]bool{},
+		historyTabs:     map[string]bool{},
+		historyDocIDs:   map[string]string{},
+		flareFolderIDs:  map[string]string{},
+
+		alertGroupChannels:   map[string]string{},
+		alertPrompts:         map[string]*alertPrompt{},
+		firingAlertGroups:    map[string][]*alertmanager.Notification{},
+		dismissedAlertGroups: map[string]bool{},
 	}
+	service.OnChannelCreated = slackClient.flareChannelCreated
 
 	// Register all handlers
 	handlers := []*MessageHandler{}
@@ -151,14 +223,54 @@ func NewSlackClient(username string, expectedChannel string, googleDocsServer *g
 		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, takingLeadCommand.regexp)),
 		fn:      slackClient.takingLeadHandler,
 	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, roleCommand.regexp)),
+		fn:      slackClient.roleHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, priorityCommand.regexp)),
+		fn:      slackClient.priorityHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, timelineCommand.regexp)),
+		fn:      slackClient.timelineHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, statusPageOpenCommand.regexp)),
+		fn:      slackClient.statusPageOpenHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, statusPageUpdateCommand.regexp)),
+		fn:      slackClient.statusPageUpdateHandler,
+	})
 	handlers = append(handlers, &MessageHandler{
 		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, flareMitigatedCommand.regexp)),
 		fn:      slackClient.mitigateFlareHandler,
 	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, flareResolvedCommand.regexp)),
+		fn:      slackClient.resolveFlareHandler,
+	})
 	handlers = append(handlers, &MessageHandler{
 		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, notAFlareCommand.regexp)),
 		fn:      slackClient.notAFlareHandler,
 	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, startPostmortemCommand.regexp)),
+		fn:      slackClient.startPostmortemHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, historyLastCommand.regexp)),
+		fn:      slackClient.historyLastHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, historyFromCommand.regexp)),
+		fn:      slackClient.historyFromHandler,
+	})
+	handlers = append(handlers, &MessageHandler{
+		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, historySinceCommand.regexp)),
+		fn:      slackClient.historySinceHandler,
+	})
 	handlers = append(handlers, &MessageHandler{
 		pattern: regexp.MustCompile(fmt.Sprintf(regexPattern, slackClient.Username, slackClient.UserID, helpCommand.regexp)),
 		fn:      slackClient.helpHandler,
@@ -200,10 +312,30 @@ func NewSlackClient(username string, expectedChannel string, googleDocsServer *g
 					switch ev := innerEvent.Data.(type) {
 					case *slackevents.MessageEvent:
 						slackClient.handleMessage(ev)
+					case *slack.UserChangeEvent:
+						directory.handleUserChange(&ev.User)
+					case *slackevents.ChannelRenameEvent:
+						directory.handleChannelRename(ev.Channel.ID)
+					case *slackevents.MemberJoinedChannelEvent:
+						slackClient.ShareWithNewMember(ev.Channel)
 					}
 				default:
 					client.Debugf("unsupported Events API event received")
 				}
+			case socketmode.EventTypeInteractive:
+				callback, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					fmt.Printf("Ignored %+v\n", evt)
+					continue
+				}
+
+				client.Ack(*evt.Request)
+
+				if callback.Type == slack.InteractionTypeBlockActions {
+					for _, action := range callback.ActionCallback.BlockActions {
+						slackClient.handleBlockAction(&callback, action)
+					}
+				}
 			default:
 				fmt.Fprintf(os.Stderr, "Unexpected event type received: %s\n", evt.Type)
 			}
@@ -213,14 +345,23 @@ func NewSlackClient(username string, expectedChannel string, googleDocsServer *g
 	return slackClient, nil
 }
 
+// handleBlockAction handles a click on a button flarebot posted.
+func (c *SlackClient) handleBlockAction(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	switch action.ActionID {
+	case statusPageOpenAction, statusPageDismissAction:
+		c.handleStatusPageAction(callback, action)
+	case alertFireAction, alertDismissAction:
+		c.handleAlertAction(callback, action)
+	}
+}
+
 func (c *SlackClient) handleMessage(evt *slackevents.MessageEvent) {
-	m := messageEventToMessage(evt, &c.Client.Client)
+	m := messageEventToMessage(evt, c.directory)
 
 	var theMatch *MessageHandler
 
 	// If the message is from us, don't do anything
-	author, _ := m.Author()
-	if author == c.Username {
+	if m.AuthorId == c.UserID {
 		fmt.Println("Message is from us, skipping -------------------------")
 		return
 	}
@@ -237,4 +378,7 @@ func (c *SlackClient) handleMessage(evt *slackevents.MessageEvent) {
 	}
 
 	c.recordSlackHistory(m)
+	// copying files can take minutes, and the next Slack event waits for this
+	// one to be handled
+	go c.archiveSlackFiles(m)
 }
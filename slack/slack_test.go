@@ -0,0 +1,49 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestFireFlareCommandFlags(t *testing.T) {
+	pattern := regexp.MustCompile(fmt.Sprintf("<@%s|%s>:?\\W*%s", "flarebot", "U1", fireFlareCommand.regexp))
+
+	tests := []struct {
+		text        string
+		retroactive bool
+		preemptive  bool
+		sensitive   bool
+		priority    string
+		topic       string
+	}{
+		{"<@U1> fire a flare p1 checkout is down", false, false, false, "1", "checkout is down"},
+		{"<@U1> fire a sensitive flare p1 leaked keys", false, false, true, "1", "leaked keys"},
+		{"<@U1> fire a Sensitive Flare p1 leaked keys", false, false, true, "1", "leaked keys"},
+		{"<@U1> fire a SENSITIVE flare P0 leaked keys", false, false, true, "0", "leaked keys"},
+		{"<@U1> Fire a Retroactive flare p2 the hottub", true, false, false, "2", "the hottub"},
+		{"<@U1> fire a Pre-emptive flare p2 deploy freeze", false, true, false, "2", "deploy freeze"},
+		{"<@U1> fire a retroactive preemptive sensitive flare p2 all of them", true, true, true, "2", "all of them"},
+		{"<@U1> fire a flare p2 not a sensitive flare, or retroactive", false, false, false, "2", "not a sensitive flare, or retroactive"},
+	}
+	for _, test := range tests {
+		params := pattern.FindAllStringSubmatch(test.text, -1)
+		if len(params) == 0 {
+			t.Errorf("%q didn't match", test.text)
+			continue
+		}
+		match := params[0]
+		if got := match[1] != ""; got != test.retroactive {
+			t.Errorf("%q: retroactive = %t, want %t", test.text, got, test.retroactive)
+		}
+		if got := match[2] != ""; got != test.preemptive {
+			t.Errorf("%q: preemptive = %t, want %t", test.text, got, test.preemptive)
+		}
+		if got := match[3] != ""; got != test.sensitive {
+			t.Errorf("%q: sensitive = %t, want %t", test.text, got, test.sensitive)
+		}
+		if match[4] != test.priority || match[5] != test.topic {
+			t.Errorf("%q: priority %q topic %q, want %q %q", test.text, match[4], match[5], test.priority, test.topic)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package slack
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the buttons offering to open a status page incident.
+const (
+	statusPageOpenAction    = "statuspage_open"
+	statusPageDismissAction = "statuspage_dismiss"
+)
+
+// offerStatusPageIncident asks the Flare channel whether to open a public
+// incident for the Flare.
+func (c *SlackClient) offerStatusPageIncident(channelID string, priority string, topic string) {
+	if c.StatusPage == nil {
+		return
+	}
+
+	text := slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("This is a %s Flare. Should I open a public incident on the status page, titled \"%s\"?", priority, topic), false, false)
+	open := slack.NewButtonBlockElement(statusPageOpenAction, channelID, slack.NewTextBlockObject(slack.PlainTextType, "Open incident", false, false))
+	open.Style = slack.StylePrimary
+	dismiss := slack.NewButtonBlockElement(statusPageDismissAction, channelID, slack.NewTextBlockObject(slack.PlainTextType, "Not now", false, false))
+
+	c.Client.PostMessage(channelID,
+		slack.MsgOptionText(fmt.Sprintf("Should I open a public incident on the status page? Say @%s statuspage open to do it later.", c.Username), false),
+		slack.MsgOptionBlocks(slack.NewSectionBlock(text, nil, nil), slack.NewActionBlock("statuspage", open, dismiss)),
+	)
+}
+
+// answerOffer replaces the buttons of an offer flarebot posted with what was
+// done.
+func (c *SlackClient) answerOffer(callback *slack.InteractionCallback, text string) {
+	_, _, _, err := c.Client.UpdateMessage(callback.Channel.ID, callback.Message.Timestamp,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)),
+	)
+	if err != nil {
+		log.Printf("Couldn't update the offer: %s", err)
+	}
+}
+
+// handleStatusPageAction handles a click on the status page offer's buttons.
+func (c *SlackClient) handleStatusPageAction(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	who := callback.User.Name
+	if user, err := c.directory.User(callback.User.ID); err == nil {
+		who = user.Name
+	}
+
+	switch action.ActionID {
+	case statusPageOpenAction:
+		c.answerOffer(callback, fmt.Sprintf("<@%s> asked me to open a status page incident.", callback.User.ID))
+		c.OpenStatusPageIncident(callback.Channel.ID, who)
+	case statusPageDismissAction:
+		c.answerOffer(callback, fmt.Sprintf("<@%s> decided not to open a status page incident for now. Say @%s statuspage open to do it later.", callback.User.ID, c.Username))
+	}
+}
+
+func (c *SlackClient) statusPageOpenHandler(msg *Message, params [][]string) {
+	c.OpenStatusPageIncident(msg.Channel, msg.authorName())
+}
+
+func (c *SlackClient) statusPageUpdateHandler(msg *Message, params [][]string) {
+	c.UpdateStatusPage(msg.Channel, msg.authorName(), params[0][1])
+}
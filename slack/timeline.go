@@ -0,0 +1,52 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modern-pet/flarebot/helpers"
+	"github.com/slack-go/slack"
+)
+
+// lastOccurrence returns the most recent time it was hour:minute in Jakarta.
+func lastOccurrence(hour int, minute int) time.Time {
+	now := time.Now().In(helpers.JakartaLocation())
+	t := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+func (c *SlackClient) priorityHandler(msg *Message, params [][]string) {
+	c.SetPriority(msg.Channel, msg.authorName(), fmt.Sprintf("P%s", params[0][1]))
+}
+
+// roleUserRegexp pulls the user ID out of a mention like <@U123|ben>.
+var roleUserRegexp = regexp.MustCompile("<@(\\w+)(?:\\|[^>]*)?>")
+
+func (c *SlackClient) roleHandler(msg *Message, params [][]string) {
+	userID := msg.AuthorId
+	if match := roleUserRegexp.FindStringSubmatch(params[0][1]); len(match) > 1 {
+		userID = match[1]
+	}
+	c.SetRole(msg.Channel, userID, strings.ToLower(params[0][2]))
+}
+
+func (c *SlackClient) timelineHandler(msg *Message, params [][]string) {
+	when := time.Now()
+	if params[0][1] != "" {
+		hour, _ := strconv.Atoi(params[0][1])
+		minute, _ := strconv.Atoi(params[0][2])
+		if hour > 23 || minute > 59 {
+			c.Client.PostMessage(msg.Channel, slack.MsgOptionText("That doesn't look like a time, try e.g. timeline at 10:45 error rates are up", false))
+			return
+		}
+		when = lastOccurrence(hour, minute)
+	}
+
+	c.LogTimeline(msg.Channel, msg.authorName(), when, params[0][3])
+}
@@ -0,0 +1,203 @@
+// Package statuspage opens and updates public incidents through a
+// Statuspage-compatible REST API.
+package statuspage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is Atlassian Statuspage's API.
+const DefaultAPIURL = "https://api.statuspage.io/v1"
+
+// requestTimeout bounds each call to the status page.
+const requestTimeout = 30 * time.Second
+
+// Incident statuses.
+const (
+	StatusInvestigating = "investigating"
+	StatusIdentified    = "identified"
+	StatusMonitoring    = "monitoring"
+	StatusResolved      = "resolved"
+)
+
+// Config is how flarebot reaches the status page.
+type Config struct {
+	// APIURL is the base of the REST API, e.g. https://api.statuspage.io/v1.
+	APIURL string
+	APIKey string
+	PageID string
+}
+
+// ConfigFromEnv reads the STATUSPAGE_* configuration. It returns nil if
+// STATUSPAGE_API_KEY isn't set, meaning incidents aren't opened.
+func ConfigFromEnv() (*Config, error) {
+	apiKey := os.Getenv("STATUSPAGE_API_KEY")
+	if apiKey == "" {
+		return nil, nil
+	}
+
+	config := &Config{
+		APIURL: strings.TrimSuffix(os.Getenv("STATUSPAGE_API_URL"), "/"),
+		APIKey: apiKey,
+		PageID: os.Getenv("STATUSPAGE_PAGE_ID"),
+	}
+	if config.APIURL == "" {
+		config.APIURL = DefaultAPIURL
+	}
+	if config.PageID == "" {
+		return nil, errors.New("STATUSPAGE_PAGE_ID must be set when STATUSPAGE_API_KEY is")
+	}
+
+	return config, nil
+}
+
+// Client talks to the status page.
+type Client struct {
+	Config     *Config
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the configured status page.
+func New(config *Config) *Client {
+	return &Client{Config: config, HTTPClient: &http.Client{Timeout: requestTimeout}}
+}
+
+// NewFromEnv returns a Client configured by the STATUSPAGE_* variables, or nil
+// if the status page isn't configured.
+func NewFromEnv() (*Client, error) {
+	config, err := ConfigFromEnv()
+	if err != nil || config == nil {
+		return nil, err
+	}
+	return New(config), nil
+}
+
+// Error is a request the status page rejected.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("status page returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status page returned %d: %s", e.StatusCode, e.Message)
+}
+
+// do sends a request to the REST API and decodes the JSON response into out,
+// if it isn't nil.
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.Config.APIURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "OAuth "+c.Config.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		statusErr := &Error{StatusCode: resp.StatusCode}
+		var details struct {
+			Error   interface{} `json:"error"`
+			Message string      `json:"message"`
+		}
+		if json.Unmarshal(data, &details) == nil {
+			statusErr.Message = details.Message
+			if details.Error != nil {
+				statusErr.Message = fmt.Sprint(details.Error)
+			}
+		}
+		return statusErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Incident is a status page incident.
+type Incident struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Shortlink string `json:"shortlink"`
+}
+
+// incidentRequest is the body of incident creates and updates.
+type incidentRequest struct {
+	Incident incidentFields `json:"incident"`
+}
+
+type incidentFields struct {
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+func (c *Client) incidentsPath() string {
+	return fmt.Sprintf("/pages/%s/incidents", url.PathEscape(c.Config.PageID))
+}
+
+// CreateIncident opens an incident in the investigating state, with body as
+// its first update.
+func (c *Client) CreateIncident(name string, body string) (*Incident, error) {
+	incident := &Incident{}
+	request := incidentRequest{Incident: incidentFields{Name: name, Status: StatusInvestigating, Body: body}}
+	if err := c.do(http.MethodPost, c.incidentsPath(), request, incident); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
+
+// UpdateIncident posts an update to an incident. The status is left alone if
+// it's "".
+func (c *Client) UpdateIncident(id string, status string, body string) (*Incident, error) {
+	incident := &Incident{}
+	request := incidentRequest{Incident: incidentFields{Status: status, Body: body}}
+	if err := c.do(http.MethodPatch, c.incidentsPath()+"/"+url.PathEscape(id), request, incident); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
+
+// GetIncident looks up an incident by ID.
+func (c *Client) GetIncident(id string) (*Incident, error) {
+	incident := &Incident{}
+	if err := c.do(http.MethodGet, c.incidentsPath()+"/"+url.PathEscape(id), nil, incident); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
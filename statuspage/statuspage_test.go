@@ -0,0 +1,122 @@
+package statuspage
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// request is a request the test server received.
+type request struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// newTestClient returns a Client for a server answering with handle, and the
+// requests it received.
+func newTestClient(t *testing.T, handle func(w http.ResponseWriter, r *http.Request)) (*Client, *[]request) {
+	t.Helper()
+	requests := []request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "OAuth key" {
+			t.Errorf("%s %s was authorized with %q", r.Method, r.URL, auth)
+		}
+		received := request{Method: r.Method, Path: r.URL.RequestURI()}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &received.Body); err != nil {
+				t.Errorf("%s %s sent %q: %s", r.Method, r.URL, data, err)
+			}
+		}
+		requests = append(requests, received)
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(&Config{APIURL: server.URL, APIKey: "key", PageID: "page1"}), &requests
+}
+
+func TestIncidents(t *testing.T) {
+	var requests *[]request
+	client, requests := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// the incident takes the status it's given
+		sent := (*requests)[len(*requests)-1].Body["incident"].(map[string]interface{})
+		status, _ := sent["status"].(string)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "inc1", "name": "Checkout is down", "status": status, "shortlink": "https://stspg.io/1"})
+	})
+
+	incident, err := client.CreateIncident("Checkout is down", "We're looking into it.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *incident != (Incident{ID: "inc1", Name: "Checkout is down", Status: StatusInvestigating, Shortlink: "https://stspg.io/1"}) {
+		t.Errorf("created %+v", incident)
+	}
+	if _, err = client.UpdateIncident("inc1", StatusMonitoring, "A fix is out."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.UpdateIncident("inc1", "", "Still watching."); err != nil {
+		t.Fatal(err)
+	}
+	incident, err = client.UpdateIncident("inc1", StatusResolved, "All better.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incident.Status != StatusResolved {
+		t.Errorf("resolved %+v", incident)
+	}
+
+	want := []request{
+		{Method: http.MethodPost, Path: "/pages/page1/incidents", Body: map[string]interface{}{"incident": map[string]interface{}{"name": "Checkout is down", "status": "investigating", "body": "We're looking into it."}}},
+		{Method: http.MethodPatch, Path: "/pages/page1/incidents/inc1", Body: map[string]interface{}{"incident": map[string]interface{}{"status": "monitoring", "body": "A fix is out."}}},
+		{Method: http.MethodPatch, Path: "/pages/page1/incidents/inc1", Body: map[string]interface{}{"incident": map[string]interface{}{"body": "Still watching."}}},
+		{Method: http.MethodPatch, Path: "/pages/page1/incidents/inc1", Body: map[string]interface{}{"incident": map[string]interface{}{"status": "resolved", "body": "All better."}}},
+	}
+	if !reflect.DeepEqual(*requests, want) {
+		t.Errorf("requests\n%+v\nwant\n%+v", *requests, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"error", http.StatusUnauthorized, `{"error": "Could not authenticate"}`, "status page returned 401: Could not authenticate"},
+		{"error list", http.StatusUnprocessableEntity, `{"error": ["Name can't be blank"]}`, "status page returned 422: [Name can't be blank]"},
+		{"message", http.StatusNotFound, `{"message": "Incident not found"}`, "status page returned 404: Incident not found"},
+		{"no details", http.StatusBadGateway, `<html>Bad Gateway</html>`, "status page returned 502"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				io.WriteString(w, test.body)
+			})
+
+			for _, call := range []func() (*Incident, error){
+				func() (*Incident, error) { return client.CreateIncident("Checkout is down", "") },
+				func() (*Incident, error) { return client.UpdateIncident("inc1", StatusResolved, "") },
+				func() (*Incident, error) { return client.GetIncident("inc1") },
+			} {
+				incident, err := call()
+				var statusErr *Error
+				if incident != nil || !errors.As(err, &statusErr) || statusErr.StatusCode != test.status {
+					t.Fatalf("got %+v, %v, want a %d", incident, err, test.status)
+				}
+				if err.Error() != test.message {
+					t.Errorf("got %q, want %q", err.Error(), test.message)
+				}
+			}
+		})
+	}
+}
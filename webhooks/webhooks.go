@@ -0,0 +1,339 @@
+// Package webhooks tells other tools about Flares by posting signed JSON
+// events to configured URLs.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Events a webhook can subscribe to.
+const (
+	EventFired           = "flare.fired"
+	EventPriorityChanged = "flare.priority_changed"
+	EventLeadAssigned    = "flare.lead_assigned"
+	EventMitigated       = "flare.mitigated"
+	EventResolved        = "flare.resolved"
+	EventNotAFlare       = "flare.not_a_flare"
+)
+
+// Events are all the events, in the order a Flare usually goes through them.
+var Events = []string{EventFired, EventPriorityChanged, EventLeadAssigned, EventMitigated, EventResolved, EventNotAFlare}
+
+// PayloadVersion is the version of the Payload format. It changes when fields
+// are removed or change meaning, not when they're added.
+const PayloadVersion = 1
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Flarebot-Event"
+	HeaderDelivery  = "X-Flarebot-Delivery"
+	HeaderTimestamp = "X-Flarebot-Timestamp"
+	HeaderSignature = "X-Flarebot-Signature"
+)
+
+const (
+	// requestTimeout bounds each delivery attempt.
+	requestTimeout = 10 * time.Second
+	// maxAttempts is how many times a delivery is tried.
+	maxAttempts = 5
+	// initialBackoff doubles after every failed attempt.
+	initialBackoff = 2 * time.Second
+	// logSize is how many deliveries are kept in the delivery log.
+	logSize = 200
+)
+
+// webhookMetrics counts deliveries, failures and retries per event, e.g.
+// "flare.fired.deliveries", published through expvar.
+var webhookMetrics = expvar.NewMap("webhooks")
+
+// Endpoint is a URL events are posted to.
+type Endpoint struct {
+	URL string `json:"url"`
+	// Secret signs every delivery, see Sign.
+	Secret string `json:"secret"`
+	// Events are the events posted to the URL. Empty means all of them.
+	Events []string `json:"events,omitempty"`
+}
+
+func (e *Endpoint) validate() error {
+	if !strings.HasPrefix(e.URL, "http://") && !strings.HasPrefix(e.URL, "https://") {
+		return fmt.Errorf("url %q isn't an http(s) URL", e.URL)
+	}
+	if e.Secret == "" {
+		return fmt.Errorf("%s has no secret", e.URL)
+	}
+	for _, event := range e.Events {
+		if !known(event) {
+			return fmt.Errorf("unknown event %s for %s, expected one of %s", event, e.URL, strings.Join(Events, ", "))
+		}
+	}
+	return nil
+}
+
+func (e *Endpoint) wants(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, wanted := range e.Events {
+		if wanted == event {
+			return true
+		}
+	}
+	return false
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Flare is a Flare as described in a payload.
+type Flare struct {
+	Number    string `json:"number"`
+	ChannelID string `json:"channel_id,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Priority  string `json:"priority"`
+	Summary   string `json:"summary"`
+	State     string `json:"state"`
+	Type      string `json:"type,omitempty"`
+	Lead      string `json:"lead,omitempty"`
+	Reporter  string `json:"reporter,omitempty"`
+	// Links are URLs by what they are, e.g. "channel", "flare_doc".
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Version    int       `json:"version"`
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Actor is who made the event happen, by Slack name.
+	Actor string `json:"actor,omitempty"`
+	Flare *Flare `json:"flare"`
+	// Previous are the values of Flare fields before the event changed them,
+	// e.g. {"priority": "P2"}.
+	Previous map[string]string `json:"previous,omitempty"`
+}
+
+// Sign is the signature of a delivery: "sha256=" and the hex HMAC-SHA256,
+// keyed by the endpoint's secret, of the timestamp header, a "." and the body.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivery is an attempt to post an event to an endpoint, as kept in the
+// delivery log.
+type Delivery struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	URL        string    `json:"url"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	Started    time.Time `json:"started"`
+	// Finished is zero while the delivery is still being tried.
+	Finished time.Time `json:"finished"`
+}
+
+// Dispatcher posts events to the endpoints subscribed to them.
+type Dispatcher struct {
+	endpoints  []*Endpoint
+	HTTPClient *http.Client
+	// Backoff is the wait before the first retry, doubling after that.
+	Backoff time.Duration
+
+	mu         sync.Mutex
+	deliveries []*Delivery
+}
+
+// New returns a Dispatcher for the endpoints.
+func New(endpoints []*Endpoint) (*Dispatcher, error) {
+	for i, endpoint := range endpoints {
+		if endpoint == nil {
+			return nil, fmt.Errorf("webhook %d is empty", i)
+		}
+		if err := endpoint.validate(); err != nil {
+			return nil, fmt.Errorf("invalid webhook %d: %s", i, err)
+		}
+	}
+
+	return &Dispatcher{
+		endpoints:  endpoints,
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+		Backoff:    initialBackoff,
+	}, nil
+}
+
+// NewFromConfig builds a Dispatcher from the WEBHOOKS configuration value, a
+// JSON array of endpoints. It returns nil for an empty value, meaning no
+// webhooks.
+func NewFromConfig(configJSON string) (*Dispatcher, error) {
+	if configJSON == "" {
+		return nil, nil
+	}
+
+	endpoints := []*Endpoint{}
+	if err := json.Unmarshal([]byte(configJSON), &endpoints); err != nil {
+		return nil, fmt.Errorf("WEBHOOKS is not a JSON array of webhooks: %s", err)
+	}
+	return New(endpoints)
+}
+
+// Send posts an event about a Flare to every endpoint subscribed to it.
+// Deliveries happen in the background, with retries; see Deliveries for how
+// they went.
+func (d *Dispatcher) Send(event string, actor string, flare *Flare, previous map[string]string) {
+	if d == nil {
+		return
+	}
+
+	payload := &Payload{
+		Version:    PayloadVersion,
+		ID:         uuid.New().String(),
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Actor:      actor,
+		Flare:      flare,
+		Previous:   previous,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Couldn't encode %s webhook: %s", event, err)
+		return
+	}
+
+	for _, endpoint := range d.endpoints {
+		if !endpoint.wants(event) {
+			continue
+		}
+		delivery := &Delivery{ID: payload.ID, Event: event, URL: endpoint.URL, Started: time.Now()}
+		d.logDelivery(delivery)
+		go d.deliver(endpoint, delivery, body)
+	}
+}
+
+// deliver posts body to an endpoint until it's accepted or attempts run out.
+func (d *Dispatcher) deliver(endpoint *Endpoint, delivery *Delivery, body []byte) {
+	backoff := d.Backoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		status, err := d.post(endpoint, delivery, body)
+		retryable := err != nil && (status == 0 || status == http.StatusTooManyRequests || status >= 500)
+
+		d.mu.Lock()
+		delivery.Attempts = attempt
+		delivery.StatusCode = status
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		delivery.Delivered = err == nil
+		if err == nil || !retryable || attempt == maxAttempts {
+			delivery.Finished = time.Now()
+		}
+		d.mu.Unlock()
+
+		webhookMetrics.Add(delivery.Event+".deliveries", 1)
+		if err == nil {
+			return
+		}
+		webhookMetrics.Add(delivery.Event+".failures", 1)
+		if !retryable || attempt == maxAttempts {
+			log.Printf("Webhook %s %s to %s failed for good after %d attempts: %s", delivery.Event, delivery.ID, endpoint.URL, attempt, err)
+			return
+		}
+
+		log.Printf("Webhook %s %s to %s failed (attempt %d/%d), retrying in %s: %s", delivery.Event, delivery.ID, endpoint.URL, attempt, maxAttempts, backoff, err)
+		webhookMetrics.Add(delivery.Event+".retries", 1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt, returning the response status, if any.
+func (d *Dispatcher) post(endpoint *Endpoint, delivery *Delivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "flarebot-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New(resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// logDelivery adds a delivery to the log, dropping the oldest ones past
+// logSize.
+func (d *Dispatcher) logDelivery(delivery *Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > logSize {
+		d.deliveries = d.deliveries[len(d.deliveries)-logSize:]
+	}
+}
+
+// Deliveries returns the delivery log, newest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *d.deliveries[i])
+	}
+	return deliveries
+}
+
+// ServeDeliveries serves the delivery log as JSON, newest first.
+func (d *Dispatcher) ServeDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries := d.Deliveries()
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
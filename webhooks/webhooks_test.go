@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	want := "sha256=a9b70b1a22c285fb25477ec774c190fae0e2a3c5a98f6eb6f5b840181023eef1"
+	if signature := Sign("secret", "1700000000", []byte(`{"event":"flare.fired"}`)); signature != want {
+		t.Errorf("signed %s, want %s", signature, want)
+	}
+	if Sign("other", "1700000000", []byte(`{"event":"flare.fired"}`)) == want {
+		t.Error("the signature doesn't depend on the secret")
+	}
+	if Sign("secret", "1700000001", []byte(`{"event":"flare.fired"}`)) == want {
+		t.Error("the signature doesn't depend on the timestamp")
+	}
+}
+
+func TestEndpointWants(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  string
+		wants  bool
+	}{
+		{"all events", nil, EventResolved, true},
+		{"subscribed", []string{EventFired, EventResolved}, EventResolved, true},
+		{"not subscribed", []string{EventFired}, EventMitigated, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := &Endpoint{URL: "https://example.com/hook", Secret: "secret", Events: test.events}
+			if wants := endpoint.wants(test.event); wants != test.wants {
+				t.Errorf("wants %s = %t, want %t", test.event, wants, test.wants)
+			}
+		})
+	}
+}
+
+// newTestDispatcher returns a Dispatcher posting events to a server that
+// answers each attempt with the next of statuses, then 204, and the attempts
+// it received.
+func newTestDispatcher(t *testing.T, events []string, statuses ...int) (*Dispatcher, func() []*http.Request) {
+	t.Helper()
+	var mu sync.Mutex
+	received := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if signature := Sign("secret", r.Header.Get(HeaderTimestamp), body); r.Header.Get(HeaderSignature) != signature {
+			t.Errorf("signed %s, want %s", r.Header.Get(HeaderSignature), signature)
+		}
+
+		mu.Lock()
+		received = append(received, r)
+		status := http.StatusNoContent
+		if len(received) <= len(statuses) {
+			status = statuses[len(received)-1]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	dispatcher, err := New([]*Endpoint{{URL: server.URL, Secret: "secret", Events: events}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Backoff = time.Millisecond
+	return dispatcher, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+// finished waits for the delivery log's only delivery to be finished.
+func finished(t *testing.T, dispatcher *Dispatcher) Delivery {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		if deliveries := dispatcher.Deliveries(); len(deliveries) == 1 && !deliveries[0].Finished.IsZero() {
+			return deliveries[0]
+		}
+	}
+	t.Fatalf("the delivery didn't finish: %+v", dispatcher.Deliveries())
+	return Delivery{}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		attempts  int
+		delivered bool
+	}{
+		{"accepted", nil, 1, true},
+		{"rate limited", []int{http.StatusTooManyRequests}, 2, true},
+		{"unavailable", []int{http.StatusServiceUnavailable, http.StatusInternalServerError}, 3, true},
+		{"down", []int{500, 500, 500, 500, 500}, maxAttempts, false},
+		{"invalid", []int{http.StatusBadRequest}, 1, false},
+		{"gone", []int{http.StatusNotFound}, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dispatcher, received := newTestDispatcher(t, nil, test.statuses...)
+
+			dispatcher.Send(EventFired, "ada", &Flare{Number: "7", Priority: "P1", Summary: "checkout is down", State: "fired"}, nil)
+			delivery := finished(t, dispatcher)
+
+			if delivery.Attempts != test.attempts || len(received()) != test.attempts {
+				t.Errorf("tried %d times, received %d, want %d", delivery.Attempts, len(received()), test.attempts)
+			}
+			if delivery.Delivered != test.delivered {
+				t.Errorf("delivered %t, want %t: %+v", delivery.Delivered, test.delivered, delivery)
+			}
+			if !test.delivered && delivery.Error == "" {
+				t.Error("the failure wasn't logged")
+			}
+		})
+	}
+}
+
+func TestSendSkipsUnwantedEvents(t *testing.T) {
+	dispatcher, received := newTestDispatcher(t, []string{EventResolved})
+
+	dispatcher.Send(EventFired, "ada", &Flare{Number: "7"}, nil)
+	if deliveries := dispatcher.Deliveries(); len(deliveries) != 0 {
+		t.Errorf("delivered %+v to an endpoint that only wants %s", deliveries, EventResolved)
+	}
+
+	dispatcher.Send(EventResolved, "ada", &Flare{Number: "7"}, map[string]string{"state": "mitigated"})
+	finished(t, dispatcher)
+	requests := received()
+	if len(requests) != 1 || requests[0].Header.Get(HeaderEvent) != EventResolved {
+		t.Errorf("received %d requests, want one %s", len(requests), EventResolved)
+	}
+}
+
+func TestDeliveryLog(t *testing.T) {
+	dispatcher := &Dispatcher{}
+	for i := 0; i < logSize+5; i++ {
+		dispatcher.logDelivery(&Delivery{ID: fmt.Sprint(i)})
+	}
+
+	deliveries := dispatcher.Deliveries()
+	if len(deliveries) != logSize {
+		t.Fatalf("kept %d deliveries, want %d", len(deliveries), logSize)
+	}
+	if newest, oldest := deliveries[0].ID, deliveries[logSize-1].ID; newest != fmt.Sprint(logSize+4) || oldest != "5" {
+		t.Errorf("kept %s to %s, want %d to 5", newest, oldest, logSize+4)
+	}
+
+	recorder := httptest.NewRecorder()
+	dispatcher.ServeDeliveries(recorder, httptest.NewRequest(http.MethodGet, "/debug/webhooks", nil))
+	served := []Delivery{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &served); err != nil || len(served) != logSize || served[0].ID != deliveries[0].ID {
+		t.Errorf("served %d deliveries: %v", len(served), err)
+	}
+
+	var none *Dispatcher
+	recorder = httptest.NewRecorder()
+	none.ServeDeliveries(recorder, httptest.NewRequest(http.MethodGet, "/debug/webhooks", nil))
+	if body := recorder.Body.String(); body != "[]\n" {
+		t.Errorf("served %q without webhooks, want []", body)
+	}
+}